@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/releasehub-com/spot/builder/internal/buildkit"
+	"github.com/releasehub-com/spot/builder/internal/credentials"
+	"github.com/releasehub-com/spot/builder/internal/k8s"
+	"github.com/releasehub-com/spot/builder/internal/registries"
+	"github.com/releasehub-com/spot/builder/internal/source"
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var (
+	ErrCommandUnknown    = errors.New("unknown command")
+	ErrRepositoryMissing = errors.New("--repo is required, unless the build is loaded with --from-build")
+	ErrBuildkitNotReady  = errors.New("buildkit is not reachable, start buildkitd and point BUILDKIT_HOST at it")
+	ErrFlagInvalid       = errors.New("invalid flag")
+)
+
+const kUsage = `Usage:
+  builder                 Build the image of the Build referenced by BUILD_REFERENCE, inside the cluster.
+  builder build [flags]   Build an image from a git repository, outside of the cluster.
+
+Flags of build:
+`
+
+// Flag that can be repeated, a comma separated value is split in as many values.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, strings.Split(value, ",")...)
+	return nil
+}
+
+// LocalBuild are the options of `builder build`. It runs the same source, buildkit and registry
+// steps as the builder running in the cluster, without a Build to report to. A Build can still be
+// loaded from a cluster with a kubeconfig to reproduce it, the flags take precedence over its spec.
+type LocalBuild struct {
+	Repository     string
+	Commit         string
+	Ref            string
+	Context        string
+	Dockerfile     string
+	Depth          int
+	SparseCheckout bool
+	Submodules     bool
+	LFS            bool
+
+	Push         string
+	Tags         listFlag
+	Platforms    listFlag
+	Target       string
+	Attestations listFlag
+	Arguments    listFlag
+	Secrets      listFlag
+
+	FromBuild  string
+	Kubeconfig string
+	Workdir    string
+}
+
+// Subcommands of the builder, any other argument is left to the builder running in the cluster.
+var kCommands = map[string]func(ctx context.Context, args []string) error{
+	"build":  runLocalBuild,
+	"help":   printUsage,
+	"-h":     printUsage,
+	"--help": printUsage,
+}
+
+func isCommand(name string) bool {
+	_, ok := kCommands[name]
+	return ok
+}
+
+// Run the subcommand of the builder.
+func runCommand(ctx context.Context, name string, args []string) error {
+	command, ok := kCommands[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrCommandUnknown, name)
+	}
+
+	return command(ctx, args)
+}
+
+func printUsage(ctx context.Context, args []string) error {
+	fmt.Fprint(os.Stderr, kUsage)
+	newBuildFlags(&LocalBuild{}).PrintDefaults()
+	return nil
+}
+
+func newBuildFlags(opts *LocalBuild) *flag.FlagSet {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), kUsage)
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&opts.Repository, "repo", "", "URL of the git repository to build.")
+	flags.StringVar(&opts.Commit, "commit", "", "Commit to check out. The head of --ref is checked out when empty.")
+	flags.StringVar(&opts.Ref, "ref", "", "Branch, tag or reference the commit belongs to.")
+	flags.StringVar(&opts.Context, "context", ".", "Build context, relative to the root of the repository.")
+	flags.StringVar(&opts.Dockerfile, "dockerfile", "", "Dockerfile, relative to the root of the repository. Defaults to the Dockerfile of the context.")
+	flags.IntVar(&opts.Depth, "depth", spot.DefaultRepositoryDepth, "Depth of the history to fetch, zero fetches the whole history.")
+	flags.BoolVar(&opts.SparseCheckout, "sparse-checkout", false, "Only check out the build context and the Dockerfile's directory.")
+	flags.BoolVar(&opts.Submodules, "submodules", false, "Check out the submodules recursively.")
+	flags.BoolVar(&opts.LFS, "lfs", false, "Fetch the Git LFS files.")
+
+	flags.StringVar(&opts.Push, "push", "", "Repository the image is pushed to (ie. ghcr.io/org/app). The image is only built when empty.")
+	flags.Var(&opts.Tags, "tag", "Tag the image is pushed with, can be repeated.")
+	flags.Var(&opts.Platforms, "platform", "Platform the image is built for (os/arch[/variant]), can be repeated.")
+	flags.StringVar(&opts.Target, "target", "", "Stage of the Dockerfile to build.")
+	flags.Var(&opts.Attestations, "attest", "Attestation attached to the image (sbom, provenance), can be repeated.")
+	flags.Var(&opts.Arguments, "build-arg", "Build argument (NAME=VALUE), can be repeated.")
+	flags.Var(&opts.Secrets, "secret", "Build secret (ID=PATH) where PATH is the file holding the secret's value, can be repeated.")
+
+	flags.StringVar(&opts.FromBuild, "from-build", "", "Build (namespace/name) whose spec is used as the defaults of the flags.")
+	flags.StringVar(&opts.Kubeconfig, "kubeconfig", "", "Kubeconfig used with --from-build. Defaults to KUBECONFIG or ~/.kube/config.")
+	flags.StringVar(&opts.Workdir, "workdir", "", "Directory the source is fetched and the image exported to. Defaults to a new temporary directory.")
+
+	return flags
+}
+
+func runLocalBuild(ctx context.Context, args []string) error {
+	logger := log.FromContext(ctx)
+
+	opts := &LocalBuild{}
+	flags := newBuildFlags(opts)
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	if opts.FromBuild != "" {
+		if err := opts.loadBuild(ctx, flags); err != nil {
+			return err
+		}
+	}
+
+	if opts.Repository == "" {
+		return ErrRepositoryMissing
+	}
+
+	arguments, err := parsePairs(opts.Arguments, "--build-arg")
+	if err != nil {
+		return err
+	}
+
+	var buildArguments buildkit.Arguments
+	for _, pair := range arguments {
+		buildArguments = append(buildArguments, buildkit.Argument{Name: pair[0], Value: pair[1]})
+	}
+
+	secrets, err := parsePairs(opts.Secrets, "--secret")
+	if err != nil {
+		return err
+	}
+
+	var buildSecrets buildkit.Secrets
+	for _, pair := range secrets {
+		path, err := filepath.Abs(pair[1])
+		if err != nil {
+			return err
+		}
+		buildSecrets = append(buildSecrets, buildkit.Secret{Name: pair[0], Path: path})
+	}
+
+	if err := opts.prepareWorkdir(); err != nil {
+		return err
+	}
+
+	if err := exec.CommandContext(ctx, "buildctl", "debug", "workers").Run(); err != nil {
+		return fmt.Errorf("%w: %s", ErrBuildkitNotReady, err)
+	}
+
+	creds, err := localCredentials(opts.Repository)
+	if err != nil {
+		return err
+	}
+
+	src, err := source.Git(ctx, source.RepositoryOpts{
+		BuildContext:   opts.Context,
+		Dockerfile:     opts.Dockerfile,
+		Host:           opts.Repository,
+		Reference:      plumbing.NewHashReference(plumbing.ReferenceName(opts.Ref), plumbing.NewHash(opts.Commit)),
+		Credentials:    creds,
+		Depth:          opts.Depth,
+		SparseCheckout: opts.SparseCheckout,
+		Submodules:     opts.Submodules,
+		LFS:            opts.LFS,
+	})
+	if err != nil {
+		return err
+	}
+
+	commit, err := src.Ref()
+	if err != nil {
+		return err
+	}
+	logger.Info("Checked out the repository", "commit", commit)
+
+	index, err := buildkit.Build(ctx, src, buildkit.BuildOpts{
+		Secrets:      buildSecrets,
+		Arguments:    buildArguments,
+		Platforms:    opts.Platforms,
+		Target:       opts.Target,
+		Attestations: opts.Attestations,
+		Progress:     &buildkit.Progress{Output: os.Stdout},
+	})
+	if err != nil {
+		return err
+	}
+
+	if opts.Push == "" {
+		logger.Info("Built the image, it wasn't pushed", "layout", buildkit.ImagePath)
+		return nil
+	}
+
+	// The registries are accessed with the docker config of the machine and the
+	// credentials of the cloud providers available in the environment.
+	images, err := registries.Upload(ctx, index, []registries.Destination{{URL: opts.Push, Tags: opts.Tags}}, registries.NewKeychain(nil).WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Pushed the image", "reference", images[0].Reference, "tags", images[0].Tags)
+	return nil
+}
+
+// The sources and buildkit work in the temporary directory, a new one for every
+// build so that nothing is left over from a previous build on the same machine.
+func (opts *LocalBuild) prepareWorkdir() error {
+	if opts.Workdir == "" {
+		workdir, err := os.MkdirTemp("", "spot-build-")
+		if err != nil {
+			return err
+		}
+		opts.Workdir = workdir
+	}
+
+	if err := os.Setenv("TMPDIR", opts.Workdir); err != nil {
+		return err
+	}
+
+	buildkit.ImagePath = filepath.Join(opts.Workdir, "image")
+	return nil
+}
+
+// Load the Build from the cluster and use its spec as the defaults of the flags.
+func (opts *LocalBuild) loadBuild(ctx context.Context, flags *flag.FlagSet) error {
+	namespace, name, ok := strings.Cut(opts.FromBuild, "/")
+	if !ok || namespace == "" || name == "" {
+		return fmt.Errorf("%w: --from-build needs to be namespace/name, got %s", ErrFlagInvalid, opts.FromBuild)
+	}
+
+	client, err := k8s.NewClient(ctx, &spot.GroupVersion, opts.Kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	build, err := client.GetBuild(ctx, []string{namespace, name})
+	if err != nil {
+		return err
+	}
+
+	return opts.applyBuild(ctx, flags, build)
+}
+
+// Use the spec of the Build as the defaults of the flags that weren't set. Only the source and the
+// build's options are loaded, the image is pushed only if --push is set so that reproducing a build
+// doesn't overwrite the images of the cluster.
+func (opts *LocalBuild) applyBuild(ctx context.Context, flags *flag.FlagSet, build *spot.Build) error {
+	repository := build.Spec.Image.Repository.DeepCopy()
+	if repository != nil {
+		repository.Default()
+	}
+
+	if repository == nil || repository.GetType() != spot.SourceTypeGit || repository.Git == nil {
+		return fmt.Errorf("%w: only builds of git repositories can be built locally", ErrSourceTypeUnsupported)
+	}
+
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	setDefault := func(name string, value string) {
+		if !set[name] && value != "" {
+			_ = flags.Set(name, value)
+		}
+	}
+
+	git := repository.Git
+	setDefault("repo", git.URL)
+	setDefault("commit", git.Reference.Hash)
+	setDefault("ref", git.Reference.Name)
+	setDefault("context", repository.Context)
+	setDefault("dockerfile", repository.Dockerfile)
+	if git.Depth != nil {
+		setDefault("depth", fmt.Sprint(*git.Depth))
+	}
+	setDefault("sparse-checkout", fmt.Sprint(git.SparseCheckout))
+	setDefault("submodules", fmt.Sprint(git.Submodules))
+	setDefault("lfs", fmt.Sprint(git.LFS))
+
+	if build.Spec.Image.Registry.Target != nil {
+		setDefault("target", *build.Spec.Image.Registry.Target)
+	}
+	setDefault("platform", strings.Join(build.Spec.Image.Platforms, ","))
+
+	if attestations := build.Spec.Image.Attestations; attestations != nil {
+		if attestations.SBOM {
+			setDefault("attest", "sbom")
+		}
+		if attestations.Provenance {
+			setDefault("attest", "provenance")
+		}
+	}
+
+	if !set["build-arg"] {
+		for _, argument := range build.Spec.Arguments {
+			_ = flags.Set("build-arg", fmt.Sprintf("%s=%s", argument.Name, argument.Value))
+		}
+	}
+
+	// The values of the secrets live in the cluster, they need to be passed with --secret.
+	for _, secret := range build.Spec.Secrets {
+		if !hasPair(opts.Secrets, secret.Name) {
+			log.FromContext(ctx).Info("The build uses a secret that wasn't set with --secret", "secret", secret.Name)
+		}
+	}
+
+	return nil
+}
+
+func parsePairs(values []string, flagName string) ([][2]string, error) {
+	var pairs [][2]string
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%w: %s needs to be KEY=VALUE, got %s", ErrFlagInvalid, flagName, value)
+		}
+
+		pairs = append(pairs, [2]string{key, val})
+	}
+
+	return pairs, nil
+}
+
+func hasPair(values []string, key string) bool {
+	for _, value := range values {
+		if k, _, _ := strings.Cut(value, "="); k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Credentials of the repository outside of the cluster: basic auth from GIT_USERNAME and GIT_PASSWORD
+// (ie. a personal access token) or the SSH key at GIT_SSH_KEY, verified with GIT_SSH_KNOWN_HOSTS or
+// ~/.ssh/known_hosts. The repository is cloned anonymously otherwise.
+func localCredentials(repository string) (credentials.Credentials, error) {
+	if password := os.Getenv("GIT_PASSWORD"); password != "" {
+		return credentials.Credentials{{
+			Host:     repository,
+			Type:     credentials.TypeBasicAuth,
+			Username: os.Getenv("GIT_USERNAME"),
+			Password: password,
+		}}, nil
+	}
+
+	if keyPath := os.Getenv("GIT_SSH_KEY"); keyPath != "" {
+		key, err := os.ReadFile(keyPath)
+		if err != nil {
+			return nil, err
+		}
+
+		knownHosts := os.Getenv("GIT_SSH_KNOWN_HOSTS")
+		if knownHosts == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+		}
+
+		return credentials.Credentials{{
+			Host:           repository,
+			Type:           credentials.TypeSSH,
+			PrivateKey:     key,
+			KnownHostsPath: knownHosts,
+		}}, nil
+	}
+
+	return nil, nil
+}
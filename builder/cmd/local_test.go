@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/releasehub-com/spot/builder/internal/buildkit"
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+var _ = Describe("Local build", func() {
+	It("only dispatches the known subcommands", func() {
+		Expect(isCommand("build")).To(BeTrue())
+		Expect(isCommand("--help")).To(BeTrue())
+		Expect(isCommand("default/my-build")).To(BeFalse())
+
+		Expect(runCommand(context.Background(), "deploy", nil)).To(MatchError(ErrCommandUnknown))
+	})
+
+	It("parses the KEY=VALUE pairs", func() {
+		pairs, err := parsePairs([]string{"VERSION=1.2.0", "EMPTY=", "URL=https://release.com/?a=b"}, "--build-arg")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pairs).To(Equal([][2]string{{"VERSION", "1.2.0"}, {"EMPTY", ""}, {"URL", "https://release.com/?a=b"}}))
+
+		_, err = parsePairs([]string{"VERSION"}, "--build-arg")
+		Expect(err).To(MatchError(ErrFlagInvalid))
+
+		_, err = parsePairs([]string{"=1.2.0"}, "--build-arg")
+		Expect(err).To(MatchError(ErrFlagInvalid))
+	})
+
+	It("finds a pair by its key", func() {
+		Expect(hasPair([]string{"npm=.npmrc", "token"}, "npm")).To(BeTrue())
+		Expect(hasPair([]string{"npm=.npmrc", "token"}, "token")).To(BeTrue())
+		Expect(hasPair([]string{"npm=.npmrc"}, "np")).To(BeFalse())
+		Expect(hasPair(nil, "npm")).To(BeFalse())
+	})
+
+	Context("with a build loaded from the cluster", func() {
+		var build *spot.Build
+
+		BeforeEach(func() {
+			depth := int32(10)
+			target := "release"
+			build = &spot.Build{Spec: spot.BuildSpec{
+				Image: spot.ImageSpec{
+					Repository: &spot.RepositorySpec{
+						Context:    "app",
+						Dockerfile: "app/Dockerfile",
+						Git: &spot.GitSource{
+							URL:       "https://github.com/spot/app.git",
+							Reference: spot.GitReference{Name: "main", Hash: "0123456789012345678901234567890123456789"},
+							Depth:     &depth,
+							LFS:       true,
+						},
+					},
+					Registry:     spot.RegistrySpec{Target: &target},
+					Platforms:    []string{"linux/amd64", "linux/arm64"},
+					Attestations: &spot.AttestationSpec{SBOM: true},
+				},
+				Arguments: []spot.BuildArgument{{Name: "VERSION", Value: "1.2.0"}},
+			}}
+		})
+
+		It("uses the spec as the defaults of the flags", func() {
+			opts := &LocalBuild{}
+			flags := newBuildFlags(opts)
+			Expect(flags.Parse(nil)).To(Succeed())
+			Expect(opts.applyBuild(context.Background(), flags, build)).To(Succeed())
+
+			Expect(opts.Repository).To(Equal("https://github.com/spot/app.git"))
+			Expect(opts.Ref).To(Equal("main"))
+			Expect(opts.Commit).To(Equal("0123456789012345678901234567890123456789"))
+			Expect(opts.Context).To(Equal("app"))
+			Expect(opts.Dockerfile).To(Equal("app/Dockerfile"))
+			Expect(opts.Depth).To(Equal(10))
+			Expect(opts.LFS).To(BeTrue())
+			Expect(opts.Submodules).To(BeFalse())
+			Expect(opts.Target).To(Equal("release"))
+			Expect([]string(opts.Platforms)).To(Equal([]string{"linux/amd64", "linux/arm64"}))
+			Expect([]string(opts.Attestations)).To(Equal([]string{"sbom"}))
+			Expect([]string(opts.Arguments)).To(Equal([]string{"VERSION=1.2.0"}))
+		})
+
+		It("gives precedence to the flags that are set", func() {
+			opts := &LocalBuild{}
+			flags := newBuildFlags(opts)
+			Expect(flags.Parse([]string{
+				"--repo", "/src/app", "--ref", "feature", "--depth", "0", "--lfs=false",
+				"--platform", "linux/amd64", "--build-arg", "VERSION=dev",
+			})).To(Succeed())
+			Expect(opts.applyBuild(context.Background(), flags, build)).To(Succeed())
+
+			Expect(opts.Repository).To(Equal("/src/app"))
+			Expect(opts.Ref).To(Equal("feature"))
+			Expect(opts.Commit).To(Equal("0123456789012345678901234567890123456789"))
+			Expect(opts.Depth).To(Equal(0))
+			Expect(opts.LFS).To(BeFalse())
+			Expect([]string(opts.Platforms)).To(Equal([]string{"linux/amd64"}))
+			Expect([]string(opts.Arguments)).To(Equal([]string{"VERSION=dev"}))
+		})
+
+		It("migrates the legacy fields of the repository", func() {
+			build.Spec.Image.Repository = &spot.RepositorySpec{
+				Context:   "app",
+				URL:       "https://github.com/spot/legacy.git",
+				Reference: &spot.GitReference{Name: "main"},
+			}
+
+			opts := &LocalBuild{}
+			flags := newBuildFlags(opts)
+			Expect(flags.Parse(nil)).To(Succeed())
+			Expect(opts.applyBuild(context.Background(), flags, build)).To(Succeed())
+
+			Expect(opts.Repository).To(Equal("https://github.com/spot/legacy.git"))
+			Expect(opts.Ref).To(Equal("main"))
+			Expect(build.Spec.Image.Repository.URL).To(Equal("https://github.com/spot/legacy.git"))
+		})
+
+		It("only builds git repositories", func() {
+			build.Spec.Image.Repository = &spot.RepositorySpec{
+				Type:    spot.SourceTypeTarball,
+				Tarball: &spot.TarballSource{URL: "https://release.com/app.tar.gz"},
+			}
+
+			opts := &LocalBuild{}
+			flags := newBuildFlags(opts)
+			Expect(flags.Parse(nil)).To(Succeed())
+			Expect(opts.applyBuild(context.Background(), flags, build)).To(MatchError(ErrSourceTypeUnsupported))
+		})
+	})
+
+	Context("workdir", func() {
+		var imagePath string
+
+		BeforeEach(func() {
+			imagePath = buildkit.ImagePath
+			DeferCleanup(func() { buildkit.ImagePath = imagePath })
+			GinkgoT().Setenv("TMPDIR", GinkgoT().TempDir())
+		})
+
+		It("creates a new temporary directory when none is set", func() {
+			parent := os.TempDir()
+
+			opts := &LocalBuild{}
+			Expect(opts.prepareWorkdir()).To(Succeed())
+
+			Expect(opts.Workdir).To(BeADirectory())
+			Expect(filepath.Dir(opts.Workdir)).To(Equal(parent))
+			Expect(filepath.Base(opts.Workdir)).To(HavePrefix("spot-build-"))
+			Expect(os.Getenv("TMPDIR")).To(Equal(opts.Workdir))
+			Expect(buildkit.ImagePath).To(Equal(filepath.Join(opts.Workdir, "image")))
+		})
+
+		It("uses the directory that is set", func() {
+			workdir := GinkgoT().TempDir()
+
+			opts := &LocalBuild{Workdir: workdir}
+			Expect(opts.prepareWorkdir()).To(Succeed())
+
+			Expect(opts.Workdir).To(Equal(workdir))
+			Expect(os.Getenv("TMPDIR")).To(Equal(workdir))
+			Expect(buildkit.ImagePath).To(Equal(filepath.Join(workdir, "image")))
+		})
+	})
+})
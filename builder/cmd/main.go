@@ -2,24 +2,39 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/releasehub-com/spot/builder/internal/buildkit"
+	"github.com/releasehub-com/spot/builder/internal/credentials"
 	"github.com/releasehub-com/spot/builder/internal/k8s"
+	"github.com/releasehub-com/spot/builder/internal/logs"
 	"github.com/releasehub-com/spot/builder/internal/registries"
+	"github.com/releasehub-com/spot/builder/internal/scanner"
+	"github.com/releasehub-com/spot/builder/internal/signing"
 	"github.com/releasehub-com/spot/builder/internal/source"
 	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	core "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/utils/env"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
 
+var ErrSourceTypeUnsupported = errors.New("source type is not supported")
+
+// How often the progress of the build is reported to the Build.
+const kProgressInterval = 5 * time.Second
+
 func main() {
 	log.SetLogger(zap.New(zap.UseDevMode(true)))
 
@@ -27,7 +42,17 @@ func main() {
 	logger := log.FromContext(ctx)
 	spot.AddToScheme(scheme.Scheme)
 
-	client, err := k8s.NewClient(ctx, &spot.GroupVersion)
+	// Subcommands run outside of the cluster, the builder otherwise
+	// builds the Build it was scheduled for.
+	if len(os.Args) > 1 && isCommand(os.Args[1]) {
+		if err := runCommand(ctx, os.Args[1], os.Args[2:]); err != nil {
+			logger.Error(err, "Command failed", "command", os.Args[1])
+			os.Exit(1)
+		}
+		return
+	}
+
+	client, err := k8s.NewClient(ctx, &spot.GroupVersion, "")
 	if err != nil {
 		handleFatalErr(ctx, client, err)
 	}
@@ -37,23 +62,32 @@ func main() {
 		handleFatalErr(ctx, client, err)
 	}
 
-	var src *source.Repository
-	if err := client.MonitorCondition(ctx, build, spot.BuildConditionSource, func(ctx context.Context, _ *spot.Build) error {
-		logger.Info("Configuring data for repository access")
-		secrets, err := source.SecretsFromReader(strings.NewReader(os.Getenv("REPOSITORY_SECRETS")))
+	logger.Info("Setting up credentials for the registries")
+	registryCreds, err := credentials.FromReader(strings.NewReader(os.Getenv("REGISTRY_CREDENTIALS")))
+	if err != nil {
+		handleFatalErr(ctx, client, err)
+	}
+	// The providers are cancelled along with the build.
+	keychain := registries.NewKeychain(registryCreds).WithContext(ctx)
+
+	var src source.Source
+	if err := client.MonitorCondition(ctx, build, spot.BuildConditionSource, func(ctx context.Context, build *spot.Build) error {
+		src, err = newSource(ctx, client, build, keychain)
 		if err != nil {
 			return err
 		}
 
-		opts := source.RepositoryOpts{
-			BuildContext: os.Getenv("REPOSITORY_CONTEXT"),
-			Host:         os.Getenv("REPOSITORY_URL"),
-			Reference:    plumbing.NewHashReference(plumbing.NewBranchReferenceName(os.Getenv("REPOSITORY_BRANCH")), plumbing.NewHash(os.Getenv("REPOSITORY_COMMIT"))),
-			Secrets:      secrets,
+		ref, err := src.Ref()
+		if err != nil {
+			return err
 		}
 
-		src, err = source.Git(ctx, opts)
-		return err
+		if spot.SourceType(os.Getenv("REPOSITORY_TYPE")) == spot.SourceTypeGit {
+			build.Status.Commit = ref
+		} else {
+			build.Status.SourceRef = ref
+		}
+		return nil
 	}); err != nil {
 		handleFatalErr(ctx, client, err)
 	}
@@ -71,32 +105,268 @@ func main() {
 
 	var imageIndex v1.ImageIndex
 	if err := client.MonitorCondition(ctx, build, spot.BuildConditionBuilding, func(ctx context.Context, build *spot.Build) error {
-		secrets, arguments, err := buildkit.ParseAttributes(ctx, strings.NewReader(os.Getenv("BUILD_ARGUMENTS")), strings.NewReader(os.Getenv("BUILD_SECRETS")))
+		secrets, arguments, err := buildkit.ParseAttributes(ctx, strings.NewReader(os.Getenv("BUILD_SECRETS")), strings.NewReader(os.Getenv("BUILD_ARGUMENTS")))
 		if err != nil {
 			return err
 		}
 
-		imageIndex, err = buildkit.Build(ctx, src, secrets, arguments)
+		var platforms []string
+		if value := os.Getenv("IMAGE_PLATFORMS"); value != "" {
+			platforms = strings.Split(value, ",")
+		}
+
+		var attestations []string
+		if value := os.Getenv("IMAGE_ATTESTATIONS"); value != "" {
+			attestations = strings.Split(value, ",")
+		}
+
+		progress := &buildkit.Progress{Output: os.Stdout}
+		stopReporting := client.ReportProgress(ctx, build, kProgressInterval, progress.Summary)
+		imageIndex, err = buildkit.Build(ctx, src, buildkit.BuildOpts{
+			Secrets:      secrets,
+			Arguments:    arguments,
+			Platforms:    platforms,
+			Target:       os.Getenv("IMAGE_TARGET"),
+			Attestations: attestations,
+			Progress:     progress,
+		})
+		stopReporting()
+
+		// The logs are stored whether the build succeeded or not, failed
+		// builds are the ones where the logs are the most useful.
+		store := &logs.ConfigMapStore{Interface: client.Clientset}
+		if buildLogs, storeErr := store.Save(ctx, build, progress.Steps()); storeErr != nil {
+			logger.Error(storeErr, "Couldn't store the logs for the build")
+		} else {
+			build.Status.Logs = buildLogs
+		}
+
 		return err
 	}); err != nil {
 		handleFatalErr(ctx, client, err)
 	}
 
-	logger.Info("Setting up credentials for the registries")
-	keychain, err := registries.NewKeychain(strings.NewReader(os.Getenv("REGISTRY_SECRETS")))
-	if err != nil {
-		handleFatalErr(ctx, client, err)
+	// The image is scanned in the OCI layout exported by buildkit, before anything is pushed, so an image
+	// with vulnerabilities at or above the threshold never reaches the registries and no tag is moved.
+	if databasePath := os.Getenv("SCAN_DATABASE"); databasePath != "" {
+		if err := client.MonitorCondition(ctx, build, spot.BuildConditionScan, func(ctx context.Context, build *spot.Build) error {
+			return scanImage(ctx, build, imageIndex, databasePath)
+		}); err != nil {
+			handleFatalErr(ctx, client, err)
+		}
 	}
 
 	if err := client.MonitorCondition(ctx, build, spot.BuildConditionRegistry, func(ctx context.Context, build *spot.Build) error {
-		image, err := registries.Upload(ctx, imageIndex, env.GetString("IMAGE_URL", ""), keychain)
-		build.Status.Image = image
-		return err
+		var tags []string
+		if value := os.Getenv("IMAGE_TAGS"); value != "" {
+			tags = strings.Split(value, ",")
+		}
+
+		destinations := []registries.Destination{{URL: env.GetString("IMAGE_URL", ""), Tags: tags}}
+		if value := os.Getenv("IMAGE_MIRRORS"); value != "" {
+			var mirrors []registries.Destination
+			if err := json.Unmarshal([]byte(value), &mirrors); err != nil {
+				return err
+			}
+			destinations = append(destinations, mirrors...)
+		}
+
+		return pushImage(ctx, build, imageIndex, destinations, keychain)
 	}); err != nil {
 		handleFatalErr(ctx, client, err)
 	}
 }
 
+// Push the image to the destinations and sign every image that was pushed. Only the first destination, the
+// image's own registry, fails the push. A mirror the image couldn't be pushed to, or signed on, is recorded in
+// the build's status.
+func pushImage(ctx context.Context, build *spot.Build, index v1.ImageIndex, destinations []registries.Destination, keychain authn.Keychain) error {
+	images, err := registries.Upload(ctx, index, destinations, keychain)
+	errs := make([]error, len(destinations))
+	var uploadErr *registries.UploadError
+	if errors.As(err, &uploadErr) {
+		copy(errs, uploadErr.Errors)
+	} else if err != nil {
+		return err
+	}
+
+	err = signImages(ctx, images, errs, keychain)
+
+	build.Status.Image = images[0]
+	build.Status.Mirrors = mirrorsStatus(destinations, images, errs)
+	if err != nil {
+		return err
+	}
+
+	if uploadErr != nil && uploadErr.Errors[0] != nil {
+		return fmt.Errorf("%w: %s: %s", registries.ErrUploadFailed, destinations[0].URL, uploadErr.Errors[0])
+	}
+
+	return errs[0]
+}
+
+// Every mirror, the destinations following the image's, is listed in the status in the order of
+// IMAGE_MIRRORS with the error of the push, or of the signature, when the image couldn't be pushed to it.
+func mirrorsStatus(destinations []registries.Destination, images []*spot.BuildImage, errs []error) []spot.BuildMirror {
+	var mirrors []spot.BuildMirror
+	for i := 1; i < len(destinations); i++ {
+		mirror := spot.BuildMirror{URL: destinations[i].URL, Image: images[i]}
+		if errs[i] != nil {
+			mirror.Error = errs[i].Error()
+		}
+
+		mirrors = append(mirrors, mirror)
+	}
+
+	return mirrors
+}
+
+// Scan the image against the offline database mounted by the operator. The summary is stored in
+// the build's status even when the build fails because of the vulnerabilities at or above the threshold.
+func scanImage(ctx context.Context, build *spot.Build, index v1.ImageIndex, databasePath string) error {
+	db, err := scanner.OpenDatabase(databasePath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	findings, err := scanner.Scan(ctx, index, db)
+	if err != nil {
+		return err
+	}
+
+	build.Status.Vulnerabilities, err = scanner.Summarize(findings, spot.Severity(os.Getenv("SCAN_THRESHOLD")))
+	return err
+}
+
+// Sign every image that was pushed when the build is configured to sign its image, with the
+// key pair mounted by the operator or keyless with the service account token mounted for Fulcio.
+// The error of each image is recorded in the errors of the destinations, the error returned is
+// only for a signer that can't be set up.
+func signImages(ctx context.Context, images []*spot.BuildImage, errs []error, keychain authn.Keychain) error {
+	var signer signing.Signer
+	if keyPath := os.Getenv("SIGNING_KEY"); keyPath != "" {
+		key, err := os.ReadFile(keyPath)
+		if err != nil {
+			return err
+		}
+
+		password, err := os.ReadFile(os.Getenv("SIGNING_PASSWORD"))
+		if err != nil {
+			return err
+		}
+
+		if signer, err = signing.NewKeySigner(key, password); err != nil {
+			return err
+		}
+	} else if tokenPath := os.Getenv("SIGNING_IDENTITY_TOKEN"); tokenPath != "" {
+		signer = &signing.KeylessSigner{
+			FulcioURL: os.Getenv("SIGNING_FULCIO_URL"),
+			RekorURL:  os.Getenv("SIGNING_REKOR_URL"),
+			TokenPath: tokenPath,
+		}
+	}
+
+	if signer == nil {
+		return nil
+	}
+
+	for i, image := range images {
+		if errs[i] != nil || image == nil {
+			continue
+		}
+
+		ref, err := name.NewDigest(image.Reference)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		image.Signature, errs[i] = signing.Sign(ctx, ref, signer, keychain)
+	}
+
+	return nil
+}
+
+// Fetch the source of the build in the filesystem. The type of the source
+// decides which of the REPOSITORY_* variables are used.
+func newSource(ctx context.Context, client *k8s.Client, build *spot.Build, keychain authn.Keychain) (source.Source, error) {
+	logger := log.FromContext(ctx)
+	logger.Info("Configuring data for repository access")
+
+	creds, err := credentials.FromReader(strings.NewReader(os.Getenv("REPOSITORY_CREDENTIALS")))
+	if err != nil {
+		return nil, err
+	}
+
+	buildContext := os.Getenv("REPOSITORY_CONTEXT")
+	dockerfile := os.Getenv("REPOSITORY_DOCKERFILE")
+
+	switch sourceType := spot.SourceType(env.GetString("REPOSITORY_TYPE", string(spot.SourceTypeGit))); sourceType {
+	case spot.SourceTypeGit:
+		opts := source.RepositoryOpts{
+			BuildContext: buildContext,
+			Dockerfile:   dockerfile,
+			Host:         os.Getenv("REPOSITORY_URL"),
+			Reference:    plumbing.NewHashReference(plumbing.ReferenceName(os.Getenv("REPOSITORY_REF")), plumbing.NewHash(os.Getenv("REPOSITORY_COMMIT"))),
+			Credentials:  creds,
+		}
+
+		if opts.Depth, err = env.GetInt("REPOSITORY_DEPTH", spot.DefaultRepositoryDepth); err != nil {
+			return nil, err
+		}
+
+		if opts.SparseCheckout, err = env.GetBool("REPOSITORY_SPARSE_CHECKOUT", false); err != nil {
+			return nil, err
+		}
+
+		if opts.Submodules, err = env.GetBool("REPOSITORY_SUBMODULES", false); err != nil {
+			return nil, err
+		}
+
+		if opts.LFS, err = env.GetBool("REPOSITORY_LFS", false); err != nil {
+			return nil, err
+		}
+
+		return source.Git(ctx, opts)
+
+	case spot.SourceTypeTarball:
+		return source.Tarball(ctx, source.TarballOpts{
+			BuildContext: buildContext,
+			Dockerfile:   dockerfile,
+			URL:          os.Getenv("REPOSITORY_URL"),
+			Checksum:     os.Getenv("REPOSITORY_CHECKSUM"),
+			Credentials:  creds,
+		})
+
+	case spot.SourceTypeOCI:
+		return source.OCIArtifact(ctx, source.OCIOpts{
+			BuildContext: buildContext,
+			Dockerfile:   dockerfile,
+			Reference:    os.Getenv("REPOSITORY_URL"),
+			Keychain:     keychain,
+		})
+
+	case spot.SourceTypeConfigMap:
+		var items []core.KeyToPath
+		if err := json.Unmarshal([]byte(env.GetString("REPOSITORY_CONFIGMAP_ITEMS", "[]")), &items); err != nil {
+			return nil, err
+		}
+
+		return source.ConfigMap(ctx, source.ConfigMapOpts{
+			BuildContext: buildContext,
+			Dockerfile:   dockerfile,
+			Namespace:    build.Namespace,
+			Name:         os.Getenv("REPOSITORY_CONFIGMAP"),
+			Items:        items,
+			Client:       client.Clientset,
+		})
+
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrSourceTypeUnsupported, sourceType)
+	}
+}
+
 // handle unrecoverable error by attempting to update the Build custom resource one last
 // time and then panicking. This is the last chance to tell the operator the reason why this build is failing.
 func handleFatalErr(ctx context.Context, client *k8s.Client, err error) {
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/releasehub-com/spot/builder/internal/registries"
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+var _ = Describe("Push", func() {
+	var host string
+
+	BeforeEach(func() {
+		server := httptest.NewServer(registry.New())
+		DeferCleanup(server.Close)
+
+		u, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		host = u.Host
+	})
+
+	It("records the mirrors the image couldn't be pushed to without failing", func() {
+		image, err := random.Image(64, 1)
+		Expect(err).NotTo(HaveOccurred())
+		index := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: image})
+
+		var build spot.Build
+		err = pushImage(context.Background(), &build, index, []registries.Destination{
+			{URL: host + "/app", Tags: []string{"main"}},
+			{URL: "127.0.0.1:1/app", Tags: []string{"main"}},
+			{URL: host + "/mirror", Tags: []string{"main"}},
+		}, authn.DefaultKeychain)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(build.Status.Image).NotTo(BeNil())
+		Expect(build.Status.Mirrors).To(HaveLen(2))
+		Expect(build.Status.Mirrors[0].Image).To(BeNil())
+		Expect(build.Status.Mirrors[0].Error).NotTo(BeEmpty())
+		Expect(build.Status.Mirrors[1].Image).NotTo(BeNil())
+		Expect(build.Status.Mirrors[1].Error).To(BeEmpty())
+	})
+
+	It("fails when the image can't be pushed to its registry", func() {
+		image, err := random.Image(64, 1)
+		Expect(err).NotTo(HaveOccurred())
+		index := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: image})
+
+		var build spot.Build
+		err = pushImage(context.Background(), &build, index, []registries.Destination{
+			{URL: "127.0.0.1:1/app", Tags: []string{"main"}},
+			{URL: host + "/mirror", Tags: []string{"main"}},
+		}, authn.DefaultKeychain)
+		Expect(err).To(MatchError(registries.ErrUploadFailed))
+
+		Expect(build.Status.Image).To(BeNil())
+		Expect(build.Status.Mirrors).To(HaveLen(1))
+		Expect(build.Status.Mirrors[0].Image).NotTo(BeNil())
+	})
+})
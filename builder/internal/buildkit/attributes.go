@@ -4,22 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"io"
-	"os"
 
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 type Argument struct {
-	Key   string `json:"key"`
+	Name  string `json:"name"`
 	Value string `json:"value"`
 }
 type Arguments []Argument
 
+// Secret values are mounted in the pod by the operator, the builder
+// only receives the path where the value for the secret is stored.
+// Buildkit reads the value directly from that file.
 type Secret struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
-
-	File *os.File
+	Name string `json:"name"`
+	Path string `json:"path"`
 }
 type Secrets []Secret
 
@@ -31,7 +31,6 @@ func ParseAttributes(ctx context.Context, secretReader, argumentReader io.Reader
 
 	logger.Info("Decoding Build Secrets")
 	if err := secretDecoder.Decode(&secrets); err != nil {
-
 		return nil, nil, err
 	}
 
@@ -40,36 +39,8 @@ func ParseAttributes(ctx context.Context, secretReader, argumentReader io.Reader
 
 	logger.Info("Decoding Build Arguments")
 	if err := argumentDecoder.Decode(&arguments); err != nil {
-
 		return nil, nil, err
 	}
 
 	return secrets, arguments, nil
 }
-
-// Buildkit needs the secret to be stored to a file
-// so the secret is going to be stored in a temporary file
-func (s *Secret) Store() (string, error) {
-	if s.File != nil {
-		return s.File.Name(), nil
-	}
-
-	file, err := os.CreateTemp("", s.Key)
-	if err != nil {
-		return "", err
-	}
-
-	if _, err := file.WriteString(s.Value); err != nil {
-		return "", err
-	}
-
-	return file.Name(), nil
-}
-
-func (s *Secret) RemoveFile() error {
-	if s.File != nil {
-		return os.Remove(s.File.Name())
-	}
-
-	return nil
-}
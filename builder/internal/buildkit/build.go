@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
+	"strings"
 
 	gcr "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
@@ -14,48 +16,107 @@ import (
 
 var ImagePath = fmt.Sprintf("%s/%s", os.TempDir(), "image")
 
-// Build the repository into an ImageIndex (OCI Standard)
-// The context is set around the repository which means it needs to be
+type BuildOpts struct {
+	Secrets   Secrets
+	Arguments Arguments
+
+	// Platforms the image is built for. When more than one platform
+	// is set, buildkit creates an index with one manifest per platform.
+	// If empty, buildkit defaults to the platform of the worker.
+	Platforms []string
+
+	// Target is the stage to build in a multi-stage Dockerfile. If empty,
+	// the last stage of the Dockerfile is built.
+	Target string
+
+	// Attestations buildkit generates and attaches to the image (ie. sbom, provenance).
+	Attestations []string
+
+	// If set, buildctl reports its progress as a JSON stream that
+	// is recorded in Progress.
+	Progress *Progress
+}
+
+// Build the source into an ImageIndex (OCI Standard)
+// The context is set around the source which means it needs to be
 // present in the filesystem.
 //
 // The build execute buildkit as a system command directly and
-// pipes both STDOUT and STDERR to their respective file descriptor.
+// pipes both STDOUT and STDERR to their respective file descriptor. When
+// a Progress is set in the BuildOpts, STDERR is recorded by the Progress instead.
 //
 // The error that returns from Build is any error that is returned from the buildkit
 // process.
 //
+// If platforms are set in the BuildOpts, they are passed down to the dockerfile frontend
+// and every platform ends up as a manifest in the resulting index.
+//
 // The ImageIndex is generated from go-containerregistry and is a valid
 // OCI ImageIndex that can be exported to any container registry.
-func Build(ctx context.Context, repo *source.Repository, secrets Secrets, arguments Arguments) (gcr.ImageIndex, error) {
+func Build(ctx context.Context, src source.Source, opts BuildOpts) (gcr.ImageIndex, error) {
 	logger := log.FromContext(ctx)
 
-	logger.Info("Starting a build from a Repo", "Path", repo.BuildContext())
+	logger.Info("Starting a build from a Source", "Path", src.BuildContext())
 
 	cmd := exec.CommandContext(ctx, "buildctl", "build", "--frontend", "dockerfile.v0")
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	cmd.Args = append(cmd.Args, "--local", fmt.Sprintf("context=%s", repo.BuildContext()))
-	cmd.Args = append(cmd.Args, "--local", fmt.Sprintf("dockerfile=%s", repo.BuildContext()))
+	cmd.Args = append(cmd.Args, "--local", fmt.Sprintf("context=%s", src.BuildContext()))
+	cmd.Args = append(cmd.Args, "--local", fmt.Sprintf("dockerfile=%s", path.Dir(src.Dockerfile())))
+	cmd.Args = append(cmd.Args, "--opt", fmt.Sprintf("filename=%s", path.Base(src.Dockerfile())))
 	cmd.Args = append(cmd.Args, "--output", fmt.Sprintf("type=oci,dest=%s,tar=false", ImagePath))
 
-	for _, arg := range arguments {
-		cmd.Args = append(cmd.Args, "--opt", fmt.Sprintf("build-arg:%s=%s", arg.Key, arg.Value))
+	if opts.Target != "" {
+		cmd.Args = append(cmd.Args, "--opt", fmt.Sprintf("target=%s", opts.Target))
 	}
 
-	for _, secret := range secrets {
-		path, err := secret.Store()
-		if err != nil {
-			return nil, err
-		}
+	if len(opts.Platforms) != 0 {
+		logger.Info("Building for multiple platforms", "Platforms", opts.Platforms)
+		cmd.Args = append(cmd.Args, "--opt", fmt.Sprintf("platform=%s", strings.Join(opts.Platforms, ",")))
+	}
 
-		logger.Info("Storing secret at a temporary path", "Path", path)
-		cmd.Args = append(cmd.Args, "--secret", fmt.Sprintf("id=%s,src=%s", secret.Key, path))
+	for _, attestation := range opts.Attestations {
+		cmd.Args = append(cmd.Args, "--opt", fmt.Sprintf("attest:%s=", attestation))
 	}
 
-	err := cmd.Run()
-	if err != nil {
+	for _, arg := range opts.Arguments {
+		cmd.Args = append(cmd.Args, "--opt", fmt.Sprintf("build-arg:%s=%s", arg.Name, arg.Value))
+	}
+
+	for _, secret := range opts.Secrets {
+		logger.Info("Mounting secret for the build", "Name", secret.Name)
+		cmd.Args = append(cmd.Args, "--secret", fmt.Sprintf("id=%s,src=%s", secret.Name, secret.Path))
+	}
+
+	if err := run(ctx, cmd, opts.Progress); err != nil {
 		return nil, err
 	}
 
 	return layout.ImageIndexFromPath(ImagePath)
 }
+
+// Run the buildctl command. If progress is set, the progress stream that
+// buildctl writes to STDERR is consumed by it instead of being piped to the process' STDERR.
+func run(ctx context.Context, cmd *exec.Cmd, progress *Progress) error {
+	if progress == nil {
+		return cmd.Run()
+	}
+
+	cmd.Args = append(cmd.Args, "--progress", "rawjson")
+	cmd.Stderr = nil
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	if err := progress.Consume(stderr); err != nil {
+		log.FromContext(ctx).Error(err, "Couldn't read the progress of the build")
+	}
+
+	return cmd.Wait()
+}
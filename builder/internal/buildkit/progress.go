@@ -0,0 +1,220 @@
+package buildkit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+// Maximum size of a single line emitted by buildctl. A line holds
+// a whole SolveStatus and can get big when a step outputs a lot of logs.
+const kMaxProgressLineSize = 16 * 1024 * 1024
+
+// The following types mirror the SolveStatus that buildctl emits, one per line,
+// when it runs with `--progress=rawjson`. Only the fields used by the builder are
+// decoded.
+type solveStatus struct {
+	Vertexes []vertex       `json:"Vertexes"`
+	Statuses []vertexStatus `json:"Statuses"`
+	Logs     []vertexLog    `json:"Logs"`
+}
+
+type vertex struct {
+	Digest    string     `json:"Digest"`
+	Name      string     `json:"Name"`
+	Started   *time.Time `json:"Started"`
+	Completed *time.Time `json:"Completed"`
+	Cached    bool       `json:"Cached"`
+	Error     string     `json:"Error"`
+}
+
+type vertexStatus struct {
+	ID      string `json:"ID"`
+	Current int64  `json:"Current"`
+}
+
+type vertexLog struct {
+	Vertex string `json:"Vertex"`
+	Data   []byte `json:"Data"`
+}
+
+// Step is a single operation executed by buildkit. For a dockerfile,
+// most of the steps map to an instruction (ie. `[2/5] RUN make`).
+type Step struct {
+	Name      string     `json:"name"`
+	Digest    string     `json:"digest"`
+	Cached    bool       `json:"cached,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Started   *time.Time `json:"started,omitempty"`
+	Completed *time.Time `json:"completed,omitempty"`
+	Output    string     `json:"output,omitempty"`
+}
+
+// Progress aggregates the progress stream of buildctl into steps. The steps
+// are kept in the order buildkit reported them first.
+//
+// It's safe to read the steps while the stream is being consumed.
+type Progress struct {
+	// Output is where a human readable version of the progress is written to.
+	// If nil, nothing is written.
+	Output io.Writer
+
+	mu    sync.Mutex
+	steps []*Step
+	index map[string]*Step
+
+	// Bytes downloaded for each of the layers pulled.
+	layers map[string]int64
+}
+
+// Consume reads the stream until EOF. Lines that are not part of the progress
+// stream, like the error buildctl prints when it fails, are forwarded to the Output.
+func (p *Progress) Consume(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), kMaxProgressLineSize)
+
+	for scanner.Scan() {
+		var status solveStatus
+		if err := json.Unmarshal(scanner.Bytes(), &status); err != nil {
+			p.print("%s\n", scanner.Text())
+			continue
+		}
+
+		p.update(&status)
+	}
+
+	return scanner.Err()
+}
+
+// Steps returns a copy of all the steps recorded so far.
+func (p *Progress) Steps() []Step {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	steps := make([]Step, len(p.steps))
+	for i, step := range p.steps {
+		steps[i] = *step
+	}
+
+	return steps
+}
+
+func (p *Progress) update(status *solveStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.index == nil {
+		p.index = map[string]*Step{}
+	}
+
+	for _, v := range status.Vertexes {
+		step, ok := p.index[v.Digest]
+		if !ok {
+			step = &Step{Digest: v.Digest}
+			p.index[v.Digest] = step
+			p.steps = append(p.steps, step)
+		}
+
+		wasCompleted := step.Completed != nil
+
+		step.Name = v.Name
+		step.Cached = v.Cached
+		step.Error = v.Error
+		step.Started = v.Started
+		step.Completed = v.Completed
+
+		if !ok {
+			p.print("#%d %s\n", len(p.steps), step.Name)
+		}
+
+		if !wasCompleted && step.Completed != nil {
+			p.print("#%d %s\n", p.number(step), step.state())
+		}
+	}
+
+	for _, s := range status.Statuses {
+		// Buildkit reports the download of a layer with the layer's
+		// digest as the ID of the status.
+		if !strings.HasPrefix(s.ID, "sha256:") {
+			continue
+		}
+
+		if p.layers == nil {
+			p.layers = map[string]int64{}
+		}
+		p.layers[s.ID] = s.Current
+	}
+
+	for _, l := range status.Logs {
+		step, ok := p.index[l.Vertex]
+		if !ok {
+			continue
+		}
+
+		step.Output += string(l.Data)
+		p.print("#%d %s", p.number(step), l.Data)
+	}
+}
+
+// Summary of the steps recorded so far.
+func (p *Progress) Summary() spot.BuildProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var summary spot.BuildProgress
+	for _, step := range p.steps {
+		summary.Total++
+
+		if step.Completed != nil {
+			summary.Completed++
+			if step.Cached {
+				summary.Cached++
+			}
+			continue
+		}
+
+		// The current step is the last one that started and that's not one of buildkit's internal step.
+		if step.Started != nil && !strings.HasPrefix(step.Name, "[internal]") {
+			summary.CurrentStep = step.Name
+		}
+	}
+
+	for _, current := range p.layers {
+		summary.BytesPulled += current
+	}
+
+	return summary
+}
+
+func (p *Progress) number(step *Step) int {
+	for i, s := range p.steps {
+		if s == step {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+func (p *Progress) print(format string, args ...any) {
+	if p.Output != nil {
+		fmt.Fprintf(p.Output, format, args...)
+	}
+}
+
+func (s *Step) state() string {
+	switch {
+	case s.Error != "":
+		return fmt.Sprintf("ERROR %s", s.Error)
+	case s.Cached:
+		return "CACHED"
+	default:
+		return "DONE"
+	}
+}
@@ -0,0 +1,59 @@
+package buildkit
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Progress", func() {
+	It("aggregates the stream into steps", func() {
+		stream := strings.Join([]string{
+			`{"Vertexes":[{"Digest":"sha256:a","Name":"[internal] load build definition from Dockerfile","Started":"2023-09-01T10:00:00Z"}]}`,
+			`{"Vertexes":[{"Digest":"sha256:a","Name":"[internal] load build definition from Dockerfile","Started":"2023-09-01T10:00:00Z","Completed":"2023-09-01T10:00:01Z"}]}`,
+			`{"Vertexes":[{"Digest":"sha256:b","Name":"[2/2] RUN make","Started":"2023-09-01T10:00:01Z"}]}`,
+			`{"Logs":[{"Vertex":"sha256:b","Stream":1,"Data":"Y29tcGlsaW5nCg=="}]}`,
+			`{"Vertexes":[{"Digest":"sha256:b","Name":"[2/2] RUN make","Started":"2023-09-01T10:00:01Z","Completed":"2023-09-01T10:00:02Z","Error":"exit code: 2"}]}`,
+			`error: failed to solve: process "/bin/sh -c make" did not complete successfully: exit code: 2`,
+		}, "\n")
+
+		var output strings.Builder
+		progress := &Progress{Output: &output}
+		Expect(progress.Consume(strings.NewReader(stream))).To(Succeed())
+
+		steps := progress.Steps()
+		Expect(steps).To(HaveLen(2))
+		Expect(steps[0].Completed).NotTo(BeNil())
+		Expect(steps[1].Name).To(Equal("[2/2] RUN make"))
+		Expect(steps[1].Output).To(Equal("compiling\n"))
+		Expect(steps[1].Error).To(Equal("exit code: 2"))
+
+		Expect(output.String()).To(ContainSubstring("#2 compiling"))
+		Expect(output.String()).To(ContainSubstring("#2 ERROR exit code: 2"))
+		Expect(output.String()).To(ContainSubstring("error: failed to solve"))
+	})
+})
+
+var _ = Describe("Progress summary", func() {
+	It("counts the steps and the bytes pulled", func() {
+		stream := strings.Join([]string{
+			`{"Vertexes":[{"Digest":"sha256:a","Name":"[internal] load metadata for docker.io/library/alpine:latest","Started":"2023-09-01T10:00:00Z","Completed":"2023-09-01T10:00:01Z"}]}`,
+			`{"Vertexes":[{"Digest":"sha256:b","Name":"[1/3] FROM docker.io/library/alpine","Started":"2023-09-01T10:00:01Z","Completed":"2023-09-01T10:00:02Z"}]}`,
+			`{"Statuses":[{"ID":"sha256:layer1","Vertex":"sha256:b","Current":512,"Total":1024}]}`,
+			`{"Statuses":[{"ID":"sha256:layer1","Vertex":"sha256:b","Current":1024,"Total":1024},{"ID":"extracting sha256:layer1","Vertex":"sha256:b","Current":0}]}`,
+			`{"Vertexes":[{"Digest":"sha256:c","Name":"[2/3] COPY . .","Started":"2023-09-01T10:00:02Z","Completed":"2023-09-01T10:00:02Z","Cached":true}]}`,
+			`{"Vertexes":[{"Digest":"sha256:d","Name":"[3/3] RUN make","Started":"2023-09-01T10:00:03Z"}]}`,
+		}, "\n")
+
+		progress := &Progress{}
+		Expect(progress.Consume(strings.NewReader(stream))).To(Succeed())
+
+		summary := progress.Summary()
+		Expect(summary.Total).To(Equal(4))
+		Expect(summary.Completed).To(Equal(3))
+		Expect(summary.Cached).To(Equal(1))
+		Expect(summary.BytesPulled).To(Equal(int64(1024)))
+		Expect(summary.CurrentStep).To(Equal("[3/3] RUN make"))
+	})
+})
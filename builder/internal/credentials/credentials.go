@@ -0,0 +1,168 @@
+package credentials
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+var ErrCredentialNotFound = errors.New("Credential not found")
+var ErrCredentialTypeUnsupported = errors.New("Credential type not supported")
+
+// Types of credentials, they match the types set on the Build by the operator.
+const (
+	TypeBasicAuth    = "basic-auth"
+	TypeSSH          = "ssh"
+	TypeGitHubApp    = "github-app"
+	TypeDockerConfig = "docker-config"
+)
+
+// Keys of the secret mounted for each type of credential.
+const (
+	usernameKey       = "username"
+	passwordKey       = "password"
+	sshPrivateKeyKey  = "ssh-privatekey"
+	knownHostsKey     = "known_hosts"
+	appIDKey          = "app-id"
+	installationIDKey = "installation-id"
+	appPrivateKeyKey  = "private-key"
+	dockerConfigKey   = ".dockerconfigjson"
+)
+
+// Credentials are mounted in the pod by the operator, each in its own
+// directory with a file for each of the keys of the credential's secret.
+// The operator passes a JSON payload that maps each host to its directory.
+type Credentials []Credential
+type Credential struct {
+	Host string
+	Type string
+
+	// Basic-auth credentials
+	Username string
+	Password string
+
+	// SSH credentials, the known hosts are kept as a path since
+	// that's what the ssh transport expects.
+	PrivateKey     []byte
+	KnownHostsPath string
+
+	// GitHub App credentials
+	AppID          string
+	InstallationID string
+	AppPrivateKey  []byte
+
+	// Docker config credentials, kept as a path as the config can hold
+	// credentials for more than one registry.
+	DockerConfigPath string
+}
+
+// FromReader decodes the JSON payload and reads the values of each of
+// the credentials from the filesystem, depending on their type.
+func FromReader(r io.Reader) (Credentials, error) {
+	var mounts []struct {
+		Host string `json:"host"`
+		Type string `json:"type"`
+		Path string `json:"path"`
+	}
+
+	decoder := json.NewDecoder(r)
+	if err := decoder.Decode(&mounts); err != nil {
+		return nil, err
+	}
+
+	var credentials Credentials
+	for _, mount := range mounts {
+		credential := Credential{Host: mount.Host, Type: mount.Type}
+		read := func(key string) ([]byte, error) {
+			return os.ReadFile(path.Join(mount.Path, key))
+		}
+
+		var err error
+		switch mount.Type {
+		case "", TypeBasicAuth:
+			credential.Type = TypeBasicAuth
+			credential.Username, err = readString(read, usernameKey)
+			if err == nil {
+				credential.Password, err = readString(read, passwordKey)
+			}
+
+		case TypeSSH:
+			credential.PrivateKey, err = read(sshPrivateKeyKey)
+			credential.KnownHostsPath = path.Join(mount.Path, knownHostsKey)
+
+		case TypeGitHubApp:
+			credential.AppID, err = readString(read, appIDKey)
+			if err == nil {
+				credential.InstallationID, err = readString(read, installationIDKey)
+			}
+			if err == nil {
+				credential.AppPrivateKey, err = read(appPrivateKeyKey)
+			}
+
+		case TypeDockerConfig:
+			credential.DockerConfigPath = path.Join(mount.Path, dockerConfigKey)
+
+		default:
+			err = fmt.Errorf("%w: %s", ErrCredentialTypeUnsupported, mount.Type)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, nil
+}
+
+func readString(read func(string) ([]byte, error), key string) (string, error) {
+	data, err := read(key)
+	return strings.TrimSpace(string(data)), err
+}
+
+// ForHost returns the credential for the host or ErrCredentialNotFound if
+// none were configured for it. An exact match is preferred, otherwise a credential
+// configured for the same hostname is used, ie. a credential set for `github.com` is used
+// for `https://github.com/releasehub-com/spot` and `git@github.com:releasehub-com/spot.git`.
+func (c Credentials) ForHost(host string) (*Credential, error) {
+	for _, credential := range c {
+		if credential.Host == host {
+			return &credential, nil
+		}
+	}
+
+	hostname := Hostname(host)
+	for _, credential := range c {
+		if hostname != "" && Hostname(credential.Host) == hostname {
+			return &credential, nil
+		}
+	}
+
+	return nil, ErrCredentialNotFound
+}
+
+// Hostname extracts the hostname out of a URL, an scp-like git address
+// (`git@github.com:org/repo.git`) or a plain hostname.
+func Hostname(address string) string {
+	if u, err := url.Parse(address); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+
+	// scp-like syntax, or a bare host with an optional path.
+	if i := strings.Index(address, "@"); i >= 0 {
+		address = address[i+1:]
+	}
+
+	fields := strings.FieldsFunc(address, func(r rune) bool { return r == ':' || r == '/' })
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return fields[0]
+}
@@ -0,0 +1,71 @@
+package credentials
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Credentials", func() {
+	It("reads the username and password mounted for each host", func() {
+		dir := GinkgoT().TempDir()
+		Expect(os.WriteFile(path.Join(dir, "username"), []byte("spot"), 0600)).To(Succeed())
+		Expect(os.WriteFile(path.Join(dir, "password"), []byte("s3cr3t\n"), 0600)).To(Succeed())
+
+		creds, err := FromReader(strings.NewReader(fmt.Sprintf(`[{"host": "ghcr.io", "path": %q}]`, dir)))
+		Expect(err).NotTo(HaveOccurred())
+
+		credential, err := creds.ForHost("ghcr.io")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credential.Username).To(Equal("spot"))
+		Expect(credential.Password).To(Equal("s3cr3t"))
+
+		_, err = creds.ForHost("docker.io")
+		Expect(err).To(MatchError(ErrCredentialNotFound))
+	})
+
+	It("reads ssh and GitHub App credentials", func() {
+		ssh := GinkgoT().TempDir()
+		Expect(os.WriteFile(path.Join(ssh, "ssh-privatekey"), []byte("key"), 0600)).To(Succeed())
+
+		app := GinkgoT().TempDir()
+		Expect(os.WriteFile(path.Join(app, "app-id"), []byte("1234\n"), 0600)).To(Succeed())
+		Expect(os.WriteFile(path.Join(app, "installation-id"), []byte("5678"), 0600)).To(Succeed())
+		Expect(os.WriteFile(path.Join(app, "private-key"), []byte("pem"), 0600)).To(Succeed())
+
+		creds, err := FromReader(strings.NewReader(fmt.Sprintf(`[
+			{"host": "git@gitlab.com:spot/app.git", "type": "ssh", "path": %q},
+			{"host": "github.com", "type": "github-app", "path": %q}
+		]`, ssh, app)))
+		Expect(err).NotTo(HaveOccurred())
+
+		credential, err := creds.ForHost("git@gitlab.com:spot/app.git")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credential.Type).To(Equal(TypeSSH))
+		Expect(credential.PrivateKey).To(Equal([]byte("key")))
+		Expect(credential.KnownHostsPath).To(Equal(path.Join(ssh, "known_hosts")))
+
+		credential, err = creds.ForHost("https://github.com/releasehub-com/spot")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credential.Type).To(Equal(TypeGitHubApp))
+		Expect(credential.AppID).To(Equal("1234"))
+		Expect(credential.InstallationID).To(Equal("5678"))
+	})
+
+	It("rejects unknown credential types", func() {
+		_, err := FromReader(strings.NewReader(`[{"host": "github.com", "type": "oauth", "path": "/tmp"}]`))
+		Expect(err).To(MatchError(ErrCredentialTypeUnsupported))
+	})
+
+	It("extracts the hostname of repository addresses", func() {
+		Expect(Hostname("https://github.com/releasehub-com/spot")).To(Equal("github.com"))
+		Expect(Hostname("ssh://git@github.com:22/releasehub-com/spot.git")).To(Equal("github.com"))
+		Expect(Hostname("git@github.com:releasehub-com/spot.git")).To(Equal("github.com"))
+		Expect(Hostname("ghcr.io")).To(Equal("ghcr.io"))
+		Expect(Hostname("")).To(Equal(""))
+	})
+})
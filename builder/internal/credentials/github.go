@@ -0,0 +1,131 @@
+package credentials
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var ErrGitHubAppPrivateKeyInvalid = errors.New("GitHub App private key is not a valid RSA key")
+var ErrGitHubAppTokenFailed = errors.New("couldn't mint a GitHub App installation token")
+
+// Username to use with an installation token when cloning over HTTPS.
+const GitHubAppUsername = "x-access-token"
+
+// GitHubAPIURL returns the URL of the GitHub API for the host of a repository. Repositories
+// hosted on github.com use the public API, any other host is treated as a GitHub Enterprise server.
+func GitHubAPIURL(host string) string {
+	hostname := Hostname(host)
+	if hostname == "github.com" {
+		return "https://api.github.com"
+	}
+
+	return fmt.Sprintf("https://%s/api/v3", hostname)
+}
+
+// GitHubAppToken mints an installation token for the GitHub App credential. The app authenticates
+// with a short-lived JWT signed by its private key and exchanges it for a token scoped to the installation.
+// The token is valid for an hour, which is plenty for a build.
+func GitHubAppToken(ctx context.Context, client *http.Client, apiURL string, credential *Credential) (string, error) {
+	jwt, err := githubAppJWT(credential, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("%s/app/installations/%s/access_tokens", apiURL, credential.InstallationID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("%w: %s", ErrGitHubAppTokenFailed, resp.Status)
+	}
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	return body.Token, nil
+}
+
+// The JWT is backdated by a minute to allow for clock drift, and expires
+// before the 10 minutes limit GitHub enforces.
+func githubAppJWT(credential *Credential, now time.Time) (string, error) {
+	key, err := parseRSAPrivateKey(credential.AppPrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": credential.AppID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encoding := base64.RawURLEncoding
+	payload := encoding.EncodeToString(header) + "." + encoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(payload))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return payload + "." + encoding.EncodeToString(signature), nil
+}
+
+// GitHub generates PKCS#1 keys, PKCS#8 keys are accepted as well in
+// case the key was converted.
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrGitHubAppPrivateKeyInvalid
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrGitHubAppPrivateKeyInvalid, err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrGitHubAppPrivateKeyInvalid
+	}
+
+	return rsaKey, nil
+}
@@ -0,0 +1,85 @@
+package credentials
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GitHub App", func() {
+	var key *rsa.PrivateKey
+	var credential *Credential
+
+	BeforeEach(func() {
+		var err error
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+
+		credential = &Credential{
+			Type:           TypeGitHubApp,
+			AppID:          "1234",
+			InstallationID: "5678",
+			AppPrivateKey: pem.EncodeToMemory(&pem.Block{
+				Type:  "RSA PRIVATE KEY",
+				Bytes: x509.MarshalPKCS1PrivateKey(key),
+			}),
+		}
+	})
+
+	It("exchanges a JWT signed by the app for an installation token", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(r.URL.Path).To(Equal("/app/installations/5678/access_tokens"))
+
+			jwt := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+			Expect(jwt).To(HaveLen(3))
+
+			signature, err := base64.RawURLEncoding.DecodeString(jwt[2])
+			Expect(err).NotTo(HaveOccurred())
+			digest := sha256.Sum256([]byte(jwt[0] + "." + jwt[1]))
+			Expect(rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature)).To(Succeed())
+
+			payload, err := base64.RawURLEncoding.DecodeString(jwt[1])
+			Expect(err).NotTo(HaveOccurred())
+			var claims map[string]any
+			Expect(json.Unmarshal(payload, &claims)).To(Succeed())
+			Expect(claims).To(HaveKeyWithValue("iss", "1234"))
+
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"token": "ghs_installation"}`))
+		}))
+		defer server.Close()
+
+		token, err := GitHubAppToken(context.Background(), server.Client(), server.URL, credential)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal("ghs_installation"))
+	})
+
+	It("fails when GitHub refuses to mint a token", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		_, err := GitHubAppToken(context.Background(), server.Client(), server.URL, credential)
+		Expect(err).To(MatchError(ErrGitHubAppTokenFailed))
+	})
+
+	It("uses the public API for github.com and the enterprise API otherwise", func() {
+		Expect(GitHubAPIURL("https://github.com/releasehub-com/spot")).To(Equal("https://api.github.com"))
+		Expect(GitHubAPIURL("https://git.example.com/spot/app")).To(Equal("https://git.example.com/api/v3"))
+	})
+})
@@ -2,18 +2,28 @@ package k8s
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 type Client struct {
 	*rest.RESTClient
+
+	// Clientset for the core resources (ConfigMaps, etc.) as the
+	// RESTClient is configured for Spot's custom resources.
+	Clientset kubernetes.Interface
 }
 
 // Task represents a function that wraps around a condition
@@ -24,12 +34,18 @@ type Client struct {
 type Task func(context.Context, *spot.Build) error
 
 // Create a new Client that can communicate with the k8s cluster.
-// This client will use the pod's service account to connect to the cluster
-// and so requires read-write-list permissions on the Build CRD.
-func NewClient(ctx context.Context, groupVersion *schema.GroupVersion) (*Client, error) {
-	config, err := rest.InClusterConfig()
+// Inside the cluster, the client uses the pod's service account to connect to the cluster
+// and so requires read-write-list permissions on the Build CRD. Outside of it, the client
+// is configured by the kubeconfig, the default one (KUBECONFIG, ~/.kube/config) when empty.
+func NewClient(ctx context.Context, groupVersion *schema.GroupVersion, kubeconfig string) (*Client, error) {
+	config, err := restConfig(kubeconfig)
 	if err != nil {
-		panic(err.Error())
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(rest.CopyConfig(config))
+	if err != nil {
+		return nil, err
 	}
 
 	config.NegotiatedSerializer = scheme.Codecs.WithoutConversion()
@@ -42,7 +58,19 @@ func NewClient(ctx context.Context, groupVersion *schema.GroupVersion) (*Client,
 		return nil, err
 	}
 
-	return &Client{client}, nil
+	return &Client{client, clientset}, nil
+}
+
+func restConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig == "" {
+		if config, err := rest.InClusterConfig(); err == nil {
+			return config, nil
+		}
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
 }
 
 // Return a Build custom resource from the k8s cluster. The build holds all the information
@@ -73,13 +101,17 @@ func (c *Client) GetBuild(ctx context.Context, references []string) (*spot.Build
 
 // Monitor condition takes a conditionType and a Task. It will set the condition's status throughout the lifecycle of a task.
 // Each task's lifecycle is identical from the condition status' perspective where it starts by
-// updating the condition to be InProgress, once the task is finished, it will check if it returned any error.
-// Depending on whether an error exist, the Condition's Status will either be Success or Error.
+// updating the condition to be Started, once the task is finished, it will check if it returned any error.
+// Depending on whether an error exist, the Condition's Status will either be True or False. When the task
+// fails, the error is recorded as the condition's message.
 //
 // It's important to understand that this function will make 3 PUT request to the REST API and this can't run in parallel.
 func (c *Client) MonitorCondition(ctx context.Context, build *spot.Build, conditionType spot.BuildConditionType, fn Task) error {
-	if condition := build.Status.GetCondition(conditionType); condition.Status != spot.ConditionInProgress {
-		condition.Status = spot.ConditionInProgress
+	if condition := build.Status.GetCondition(conditionType); condition.Status != meta.ConditionUnknown || condition.Reason != spot.ConditionReasonStarted {
+		condition.Status = meta.ConditionUnknown
+		condition.Reason = spot.ConditionReasonStarted
+		condition.Message = ""
+		condition.ObservedGeneration = build.Generation
 		build.Status.SetCondition(condition)
 
 		if err := c.updateBuildStatus(ctx, build); err != nil {
@@ -89,7 +121,10 @@ func (c *Client) MonitorCondition(ctx context.Context, build *spot.Build, condit
 
 	if err := fn(ctx, build); err != nil {
 		condition := build.Status.GetCondition(conditionType)
-		condition.Status = spot.ConditionError
+		condition.Status = meta.ConditionFalse
+		condition.Reason = spot.ConditionReasonFailed
+		condition.Message = err.Error()
+		condition.ObservedGeneration = build.Generation
 		build.Status.SetCondition(condition)
 
 		if err := c.updateBuildStatus(ctx, build); err != nil {
@@ -100,7 +135,10 @@ func (c *Client) MonitorCondition(ctx context.Context, build *spot.Build, condit
 	}
 
 	condition := build.Status.GetCondition(conditionType)
-	condition.Status = spot.ConditionSuccess
+	condition.Status = meta.ConditionTrue
+	condition.Reason = spot.ConditionReasonSucceeded
+	condition.Message = ""
+	condition.ObservedGeneration = build.Generation
 	build.Status.SetCondition(condition)
 
 	if err := c.updateBuildStatus(ctx, build); err != nil {
@@ -110,6 +148,74 @@ func (c *Client) MonitorCondition(ctx context.Context, build *spot.Build, condit
 	return nil
 }
 
+// ReportProgress patches the build's progress every interval with the value returned by fn, as long
+// as it changed. The reporting goes on until the returned function is called. Stopping the reporter
+// blocks until the last progress is patched so that the build can safely be used afterward.
+//
+// The build must not be modified by anything else while the progress is being reported.
+func (c *Client) ReportProgress(ctx context.Context, build *spot.Build, interval time.Duration, fn func() spot.BuildProgress) (stop func()) {
+	logger := log.FromContext(ctx)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				if err := c.patchProgress(ctx, build, fn()); err != nil {
+					logger.Error(err, "Couldn't update the progress of the build")
+				}
+				return
+			}
+
+			progress := fn()
+			if current := build.Status.Progress; current != nil {
+				previous := *current
+				previous.LastUpdateTime = meta.Time{}
+				if previous == progress {
+					continue
+				}
+			}
+
+			if err := c.patchProgress(ctx, build, progress); err != nil {
+				logger.Error(err, "Couldn't update the progress of the build")
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// The progress is patched instead of updating the whole status as the progress is
+// the only field the reporter owns.
+func (c *Client) patchProgress(ctx context.Context, build *spot.Build, progress spot.BuildProgress) error {
+	progress.LastUpdateTime = meta.Now()
+	patch, err := json.Marshal(map[string]any{
+		"status": map[string]any{
+			"progress": progress,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	result := c.Patch(types.MergePatchType).Resource("builds").SubResource("status").Namespace(build.Namespace).Name(build.Name).Body(patch).Do(ctx)
+	if err := result.Error(); err != nil {
+		return err
+	}
+
+	return result.Into(build)
+}
+
 func (c *Client) updateBuildStatus(ctx context.Context, build *spot.Build) error {
 	result := c.Put().Resource("builds").SubResource("status").Namespace(build.Namespace).Name(build.Name).Body(build).Do(ctx)
 	if err := result.Error(); err != nil {
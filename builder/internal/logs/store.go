@@ -0,0 +1,166 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/releasehub-com/spot/builder/internal/buildkit"
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// A ConfigMap can't exceed 1MiB, the chunks are kept well under
+// that limit to leave room for the metadata.
+const kMaxChunkSize = 512 * 1024
+
+// Prefix of a step's output when it had to be truncated to fit in a chunk.
+const kTruncated = "[truncated]\n"
+
+// Label set on every ConfigMap that stores logs for a build. It can
+// be used to retrieve the logs with kubectl.
+const BuildLabel = "spot.release.com/build"
+
+// Store persists the steps of a build to a location that
+// outlives the pod that ran the build.
+type Store interface {
+	Save(ctx context.Context, build *spot.Build, steps []buildkit.Step) (*spot.BuildLogs, error)
+	Load(ctx context.Context, logs *spot.BuildLogs) ([]buildkit.Step, error)
+}
+
+// ConfigMapStore stores the steps in ConfigMaps that are owned by the Build. The ConfigMaps
+// are garbage collected by kubernetes when the Build is deleted.
+type ConfigMapStore struct {
+	kubernetes.Interface
+}
+
+var _ Store = &ConfigMapStore{}
+
+// Save the steps in as many ConfigMaps as needed. A step is never split between ConfigMaps, if a single
+// step is bigger than what a ConfigMap can hold, the beginning of its output is truncated.
+func (s *ConfigMapStore) Save(ctx context.Context, build *spot.Build, steps []buildkit.Step) (*spot.BuildLogs, error) {
+	logs := &spot.BuildLogs{}
+	chunk := map[string]string{}
+	size := 0
+
+	flush := func() error {
+		configMap := &core.ConfigMap{
+			ObjectMeta: meta.ObjectMeta{
+				Namespace:    build.Namespace,
+				GenerateName: fmt.Sprintf("%s-logs-", build.Name),
+				Labels: map[string]string{
+					BuildLabel: build.Name,
+				},
+				OwnerReferences: []meta.OwnerReference{{
+					APIVersion: spot.GroupVersion.String(),
+					Kind:       "Build",
+					Name:       build.Name,
+					UID:        build.UID,
+				}},
+			},
+			Data: chunk,
+		}
+
+		configMap, err := s.CoreV1().ConfigMaps(build.Namespace).Create(ctx, configMap, meta.CreateOptions{})
+		if err != nil {
+			return err
+		}
+
+		logs.ConfigMaps = append(logs.ConfigMaps, *spot.NewReference(configMap))
+		chunk = map[string]string{}
+		size = 0
+		return nil
+	}
+
+	for i, step := range steps {
+		data, err := encode(step)
+		if err != nil {
+			return nil, err
+		}
+
+		if size+len(data) > kMaxChunkSize && len(chunk) != 0 {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+
+		chunk[fmt.Sprintf("step-%d.json", i+1)] = data
+		size += len(data)
+	}
+
+	if len(chunk) != 0 {
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	return logs, nil
+}
+
+// Load the steps stored in the ConfigMaps referenced by the BuildLogs, in the order they were executed.
+func (s *ConfigMapStore) Load(ctx context.Context, logs *spot.BuildLogs) ([]buildkit.Step, error) {
+	type numbered struct {
+		number int
+		step   buildkit.Step
+	}
+
+	var all []numbered
+	for _, ref := range logs.ConfigMaps {
+		configMap, err := s.CoreV1().ConfigMaps(ref.Namespace).Get(ctx, ref.Name, meta.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		for key, data := range configMap.Data {
+			var n numbered
+			if _, err := fmt.Sscanf(key, "step-%d.json", &n.number); err != nil {
+				continue
+			}
+
+			if err := json.Unmarshal([]byte(data), &n.step); err != nil {
+				return nil, err
+			}
+
+			all = append(all, n)
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].number < all[j].number
+	})
+
+	steps := make([]buildkit.Step, len(all))
+	for i, n := range all {
+		steps[i] = n.step
+	}
+
+	return steps, nil
+}
+
+func encode(step buildkit.Step) (string, error) {
+	data, err := json.Marshal(step)
+	if err != nil {
+		return "", err
+	}
+
+	// Only the end of the output is kept as it's usually where
+	// the error that made the step fail is. The output is escaped when encoded
+	// which means it might take more than one pass to fit within a chunk.
+	for len(data) > kMaxChunkSize && step.Output != kTruncated {
+		overflow := len(data) - kMaxChunkSize + len(kTruncated)
+		if overflow >= len(step.Output) {
+			step.Output = kTruncated
+		} else {
+			step.Output = kTruncated + step.Output[overflow:]
+		}
+
+		if data, err = json.Marshal(step); err != nil {
+			return "", err
+		}
+	}
+
+	return string(data), nil
+}
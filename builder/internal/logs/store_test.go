@@ -0,0 +1,66 @@
+package logs
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/releasehub-com/spot/builder/internal/buildkit"
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+var _ = Describe("ConfigMapStore", func() {
+	var ctx = context.Background()
+	var build = &spot.Build{ObjectMeta: meta.ObjectMeta{Name: "backend", Namespace: "spot-system"}}
+
+	// The fake clientset doesn't support GenerateName.
+	var newClientset = func() *fake.Clientset {
+		clientset := fake.NewSimpleClientset()
+		clientset.PrependReactor("create", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			configMap := action.(k8stesting.CreateAction).GetObject().(*core.ConfigMap)
+			configMap.Name = configMap.GenerateName + rand.String(5)
+			return false, nil, nil
+		})
+		return clientset
+	}
+
+	It("stores the steps in chunks and loads them back in order", func() {
+		steps := []buildkit.Step{
+			{Name: "[1/3] FROM alpine", Output: strings.Repeat("a", kMaxChunkSize/2)},
+			{Name: "[2/3] COPY . .", Output: strings.Repeat("b", kMaxChunkSize/2)},
+			{Name: "[3/3] RUN make", Error: "exit code: 2"},
+		}
+
+		store := &ConfigMapStore{Interface: newClientset()}
+		logs, err := store.Save(ctx, build, steps)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(logs.ConfigMaps).To(HaveLen(2))
+
+		loaded, err := store.Load(ctx, logs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(Equal(steps))
+	})
+
+	It("truncates the beginning of a step that doesn't fit in a chunk", func() {
+		steps := []buildkit.Step{
+			{Name: "[1/1] RUN make", Output: strings.Repeat("a", kMaxChunkSize) + "the end"},
+		}
+
+		store := &ConfigMapStore{Interface: newClientset()}
+		logs, err := store.Save(ctx, build, steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		loaded, err := store.Load(ctx, logs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded[0].Output).To(HavePrefix(kTruncated))
+		Expect(loaded[0].Output).To(HaveSuffix("the end"))
+	})
+})
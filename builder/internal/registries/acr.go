@@ -0,0 +1,139 @@
+package registries
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/releasehub-com/spot/builder/internal/credentials"
+)
+
+var ErrACRUnexpectedResponse = errors.New("unexpected response from Azure")
+
+const (
+	kACRAuthorityHost = "https://login.microsoftonline.com/"
+	kACRScope         = "https://management.azure.com/.default"
+	kACRAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+	// ACR expects this username when authenticating with a refresh token.
+	kACRUsername = "00000000-0000-0000-0000-000000000000"
+)
+
+// ACR resolves the credentials of the Azure Container Registries with the federated
+// token the pod is given through workload identity. The token is exchanged for an AAD
+// access token, which is then exchanged for a refresh token of the registry.
+//
+// The exchange endpoint defaults to the registry's and can be overridden.
+type ACR struct {
+	ClientID      string
+	TenantID      string
+	TokenFile     string
+	AuthorityHost string
+
+	ExchangeEndpoint string
+
+	Client *http.Client
+}
+
+// Create an ACR provider configured with the environment that AKS injects in
+// pods running with a service account using workload identity.
+func NewACRFromEnv() *ACR {
+	authority := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authority == "" {
+		authority = kACRAuthorityHost
+	}
+
+	return &ACR{
+		ClientID:      os.Getenv("AZURE_CLIENT_ID"),
+		TenantID:      os.Getenv("AZURE_TENANT_ID"),
+		TokenFile:     os.Getenv("AZURE_FEDERATED_TOKEN_FILE"),
+		AuthorityHost: authority,
+		Client:        http.DefaultClient,
+	}
+}
+
+func (a *ACR) Resolve(ctx context.Context, registry string) (*Credential, error) {
+	if !strings.HasSuffix(registry, ".azurecr.io") || a.ClientID == "" || a.TenantID == "" || a.TokenFile == "" {
+		return nil, credentials.ErrCredentialNotFound
+	}
+
+	assertion, err := os.ReadFile(a.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimSuffix(a.AuthorityHost, "/"), a.TenantID)
+	if err := a.post(ctx, endpoint, url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_id":             {a.ClientID},
+		"scope":                 {kACRScope},
+		"client_assertion_type": {kACRAssertionType},
+		"client_assertion":      {strings.TrimSpace(string(assertion))},
+	}, &token); err != nil {
+		return nil, err
+	}
+
+	var exchange struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	endpoint = a.ExchangeEndpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s/oauth2/exchange", registry)
+	}
+
+	if err := a.post(ctx, endpoint, url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {registry},
+		"tenant":       {a.TenantID},
+		"access_token": {token.AccessToken},
+	}, &exchange); err != nil {
+		return nil, err
+	}
+
+	if exchange.RefreshToken == "" {
+		return nil, fmt.Errorf("%w: no refresh token for %s", ErrACRUnexpectedResponse, registry)
+	}
+
+	return &Credential{Username: kACRUsername, Password: exchange.RefreshToken}, nil
+}
+
+func (a *ACR) post(ctx context.Context, endpoint string, form url.Values, response any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s: %s", ErrACRUnexpectedResponse, resp.Status, data)
+	}
+
+	return json.Unmarshal(data, response)
+}
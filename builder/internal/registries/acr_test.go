@@ -0,0 +1,72 @@
+package registries
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/releasehub-com/spot/builder/internal/credentials"
+)
+
+var _ = Describe("ACR", func() {
+	const registry = "spot.azurecr.io"
+
+	var provider *ACR
+
+	BeforeEach(func() {
+		aad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.URL.Path).To(Equal("/tenant/oauth2/v2.0/token"))
+			Expect(r.ParseForm()).To(Succeed())
+			Expect(r.PostForm.Get("client_id")).To(Equal("client"))
+			Expect(r.PostForm.Get("client_assertion")).To(Equal("federated"))
+			Expect(r.PostForm.Get("client_assertion_type")).To(Equal(kACRAssertionType))
+
+			_, _ = io.WriteString(w, `{"access_token": "aad-token", "token_type": "Bearer"}`)
+		}))
+		DeferCleanup(aad.Close)
+
+		exchange := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.ParseForm()).To(Succeed())
+			Expect(r.PostForm.Get("grant_type")).To(Equal("access_token"))
+			Expect(r.PostForm.Get("service")).To(Equal(registry))
+			Expect(r.PostForm.Get("tenant")).To(Equal("tenant"))
+			Expect(r.PostForm.Get("access_token")).To(Equal("aad-token"))
+
+			_, _ = io.WriteString(w, `{"refresh_token": "refresh-token"}`)
+		}))
+		DeferCleanup(exchange.Close)
+
+		tokenFile := path.Join(GinkgoT().TempDir(), "token")
+		Expect(os.WriteFile(tokenFile, []byte("federated"), 0600)).To(Succeed())
+
+		provider = &ACR{
+			ClientID:         "client",
+			TenantID:         "tenant",
+			TokenFile:        tokenFile,
+			AuthorityHost:    aad.URL + "/",
+			ExchangeEndpoint: exchange.URL,
+		}
+	})
+
+	It("exchanges the federated token for a refresh token of the registry", func() {
+		credential, err := provider.Resolve(context.TODO(), registry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credential).To(Equal(&Credential{Username: kACRUsername, Password: "refresh-token"}))
+	})
+
+	It("doesn't have credentials for other registries or without workload identity", func() {
+		_, err := provider.Resolve(context.TODO(), "registry.example.com")
+		Expect(err).To(MatchError(credentials.ErrCredentialNotFound))
+
+		provider.TokenFile = ""
+		_, err = provider.Resolve(context.TODO(), registry)
+		Expect(err).To(MatchError(credentials.ErrCredentialNotFound))
+	})
+})
@@ -0,0 +1,110 @@
+package registries
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/releasehub-com/spot/builder/internal/credentials"
+)
+
+var ErrDockerConfigInvalid = errors.New("docker config is invalid")
+
+// The hostnames docker uses interchangeably for Docker Hub.
+const kDockerHub = "index.docker.io"
+
+// DockerConfig resolves the credentials out of docker config files, the format of
+// `~/.docker/config.json` and of the `kubernetes.io/dockerconfigjson` secrets. Files are read
+// when resolving, in order, and missing files are ignored.
+type DockerConfig struct {
+	Paths []string
+}
+
+// Create a DockerConfig provider reading the files, followed by the docker config of the user
+// running the builder: `$DOCKER_CONFIG/config.json` or `~/.docker/config.json`.
+func NewDockerConfig(paths ...string) *DockerConfig {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = path.Join(home, ".docker")
+		}
+	}
+
+	if dir != "" {
+		paths = append(paths, path.Join(dir, "config.json"))
+	}
+
+	return &DockerConfig{Paths: paths}
+}
+
+func (d *DockerConfig) Resolve(ctx context.Context, registry string) (*Credential, error) {
+	registry = normalizeRegistry(registry)
+	for _, p := range d.Paths {
+		data, err := os.ReadFile(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		var config struct {
+			Auths map[string]struct {
+				Auth     string `json:"auth"`
+				Username string `json:"username"`
+				Password string `json:"password"`
+			} `json:"auths"`
+		}
+
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrDockerConfigInvalid, p, err)
+		}
+
+		for host, auth := range config.Auths {
+			if normalizeRegistry(host) != registry {
+				continue
+			}
+
+			if auth.Auth == "" {
+				return &Credential{Username: auth.Username, Password: auth.Password}, nil
+			}
+
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %s", ErrDockerConfigInvalid, p, err)
+			}
+
+			username, password, ok := strings.Cut(string(decoded), ":")
+			if !ok {
+				return nil, fmt.Errorf("%w: %s: auth for %s is not formatted as username:password", ErrDockerConfigInvalid, p, host)
+			}
+
+			return &Credential{Username: username, Password: password}, nil
+		}
+	}
+
+	return nil, credentials.ErrCredentialNotFound
+}
+
+// The keys of docker configs are often URLs (`https://index.docker.io/v1/`), they
+// are matched against the registry on their hostname.
+func normalizeRegistry(registry string) string {
+	registry = strings.TrimPrefix(registry, "https://")
+	registry = strings.TrimPrefix(registry, "http://")
+	if i := strings.Index(registry, "/"); i >= 0 {
+		registry = registry[:i]
+	}
+
+	switch registry {
+	case "docker.io", "registry-1.docker.io":
+		return kDockerHub
+	}
+
+	return registry
+}
@@ -0,0 +1,279 @@
+package registries
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/releasehub-com/spot/builder/internal/credentials"
+)
+
+var ErrECRUnexpectedResponse = errors.New("unexpected response from AWS")
+
+// Hostname of the ECR private registries, the region the registry is in is
+// the second group.
+var kECRHost = regexp.MustCompile(`^\d{12}\.dkr\.ecr(-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+const (
+	kECRTarget      = "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken"
+	kECRContentType = "application/x-amz-json-1.1"
+	kECRSession     = "spot-builder"
+)
+
+// ECR resolves the credentials of the ECR registries with the web identity the pod
+// is given through IAM roles for service accounts(IRSA). The role is assumed and its
+// temporary credentials are exchanged for a registry token.
+//
+// The endpoints default to the regional endpoints of AWS and can be overridden, ie. for
+// VPC endpoints.
+type ECR struct {
+	RoleARN   string
+	TokenFile string
+	Region    string
+
+	STSEndpoint string
+	ECREndpoint string
+
+	Client *http.Client
+}
+
+// Create an ECR provider configured with the environment that EKS injects in
+// pods running with a service account annotated with an IAM role.
+func NewECRFromEnv() *ECR {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	return &ECR{
+		RoleARN:     os.Getenv("AWS_ROLE_ARN"),
+		TokenFile:   os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"),
+		Region:      region,
+		STSEndpoint: os.Getenv("AWS_ENDPOINT_URL_STS"),
+		ECREndpoint: os.Getenv("AWS_ENDPOINT_URL_ECR"),
+		Client:      http.DefaultClient,
+	}
+}
+
+func (e *ECR) Resolve(ctx context.Context, registry string) (*Credential, error) {
+	matches := kECRHost.FindStringSubmatch(registry)
+	if matches == nil || e.RoleARN == "" || e.TokenFile == "" {
+		return nil, credentials.ErrCredentialNotFound
+	}
+	region := matches[2]
+
+	creds, err := e.assumeRole(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := e.ECREndpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://api.ecr.%s.amazonaws.com/", region)
+	}
+
+	body := []byte("{}")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", kECRContentType)
+	req.Header.Set("X-Amz-Target", kECRTarget)
+	signV4(req, body, creds, region, "ecr", time.Now())
+
+	var response struct {
+		AuthorizationData []struct {
+			AuthorizationToken string `json:"authorizationToken"`
+		} `json:"authorizationData"`
+	}
+
+	data, err := e.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+
+	if len(response.AuthorizationData) == 0 {
+		return nil, fmt.Errorf("%w: no authorization data for %s", ErrECRUnexpectedResponse, registry)
+	}
+
+	token, err := base64.StdEncoding.DecodeString(response.AuthorizationData[0].AuthorizationToken)
+	if err != nil {
+		return nil, err
+	}
+
+	username, password, ok := strings.Cut(string(token), ":")
+	if !ok {
+		return nil, fmt.Errorf("%w: authorization token is not formatted as username:password", ErrECRUnexpectedResponse)
+	}
+
+	return &Credential{Username: username, Password: password}, nil
+}
+
+// Assume the role with the web identity token, the call doesn't need to be signed.
+func (e *ECR) assumeRole(ctx context.Context, region string) (*awsCredentials, error) {
+	token, err := os.ReadFile(e.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.Region != "" {
+		region = e.Region
+	}
+
+	endpoint := e.STSEndpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://sts.%s.amazonaws.com/", region)
+	}
+
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {e.RoleARN},
+		"RoleSessionName":  {kECRSession},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	data, err := e.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Credentials awsCredentials `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+
+	if err := xml.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+
+	if response.Credentials.AccessKeyID == "" {
+		return nil, fmt.Errorf("%w: no credentials returned for %s", ErrECRUnexpectedResponse, e.RoleARN)
+	}
+
+	return &response.Credentials, nil
+}
+
+func (e *ECR) do(req *http.Request) ([]byte, error) {
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s: %s", ErrECRUnexpectedResponse, resp.Status, data)
+	}
+
+	return data, nil
+}
+
+type awsCredentials struct {
+	AccessKeyID     string `xml:"AccessKeyId"`
+	SecretAccessKey string `xml:"SecretAccessKey"`
+	SessionToken    string `xml:"SessionToken"`
+}
+
+// Sign the request with AWS Signature Version 4. Every header set on the request
+// is signed, along with the host.
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html
+func signV4(req *http.Request, body []byte, creds *awsCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	payload := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format("20060102T150405Z"),
+		scope,
+		hex.EncodeToString(hashed[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,106 @@
+package registries
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/releasehub-com/spot/builder/internal/credentials"
+)
+
+var _ = Describe("ECR", func() {
+	const registry = "123456789012.dkr.ecr.us-west-2.amazonaws.com"
+
+	var provider *ECR
+	var stsRequest url.Values
+
+	BeforeEach(func() {
+		stsRequest = nil
+		sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.ParseForm()).To(Succeed())
+			stsRequest = r.PostForm
+
+			_, _ = io.WriteString(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIAEXAMPLE</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>session</SessionToken>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`)
+		}))
+		DeferCleanup(sts.Close)
+
+		ecr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Header.Get("X-Amz-Target")).To(Equal(kECRTarget))
+			Expect(r.Header.Get("X-Amz-Security-Token")).To(Equal("session"))
+			Expect(r.Header.Get("Authorization")).To(HavePrefix("AWS4-HMAC-SHA256 Credential=ASIAEXAMPLE/"))
+			Expect(r.Header.Get("Authorization")).To(ContainSubstring("/us-west-2/ecr/aws4_request"))
+
+			token := base64.StdEncoding.EncodeToString([]byte("AWS:password"))
+			_, _ = io.WriteString(w, `{"authorizationData": [{"authorizationToken": "`+token+`"}]}`)
+		}))
+		DeferCleanup(ecr.Close)
+
+		tokenFile := path.Join(GinkgoT().TempDir(), "token")
+		Expect(os.WriteFile(tokenFile, []byte("web-identity\n"), 0600)).To(Succeed())
+
+		provider = &ECR{
+			RoleARN:     "arn:aws:iam::123456789012:role/builder",
+			TokenFile:   tokenFile,
+			STSEndpoint: sts.URL,
+			ECREndpoint: ecr.URL,
+		}
+	})
+
+	It("exchanges the web identity for a registry token", func() {
+		credential, err := provider.Resolve(context.TODO(), registry)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(credential).To(Equal(&Credential{Username: "AWS", Password: "password"}))
+
+		Expect(stsRequest.Get("Action")).To(Equal("AssumeRoleWithWebIdentity"))
+		Expect(stsRequest.Get("RoleArn")).To(Equal(provider.RoleARN))
+		Expect(stsRequest.Get("WebIdentityToken")).To(Equal("web-identity"))
+	})
+
+	It("doesn't have credentials for other registries or without a web identity", func() {
+		_, err := provider.Resolve(context.TODO(), "registry.example.com")
+		Expect(err).To(MatchError(credentials.ErrCredentialNotFound))
+
+		provider.RoleARN = ""
+		_, err = provider.Resolve(context.TODO(), registry)
+		Expect(err).To(MatchError(credentials.ErrCredentialNotFound))
+	})
+
+	It("signs requests with signature version 4", func() {
+		// get-vanilla from the AWS Signature Version 4 test suite.
+		req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		now, err := time.Parse("20060102T150405Z", "20150830T123600Z")
+		Expect(err).NotTo(HaveOccurred())
+
+		signV4(req, nil, &awsCredentials{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		}, "us-east-1", "service", now)
+
+		Expect(req.Header.Get("Authorization")).To(Equal(strings.Join([]string{
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request",
+			"SignedHeaders=host;x-amz-date",
+			"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		}, ", ")))
+	})
+})
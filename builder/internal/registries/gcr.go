@@ -0,0 +1,106 @@
+package registries
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/releasehub-com/spot/builder/internal/credentials"
+)
+
+var ErrGCRUnexpectedResponse = errors.New("unexpected response from the metadata server")
+
+const (
+	kGCRMetadataHost = "metadata.google.internal"
+	kGCRTokenPath    = "/computeMetadata/v1/instance/service-accounts/default/token"
+	kGCRUsername     = "oauth2accesstoken"
+)
+
+// GCR resolves the credentials of Container Registry and Artifact Registry with the
+// access token of the service account the pod runs as, through workload identity.
+// The token is issued by the metadata server, when the server can't be reached the
+// builder isn't running on GCP and the provider doesn't have credentials.
+type GCR struct {
+	MetadataHost string
+	Client       *http.Client
+}
+
+// Create a GCR provider using the metadata host set in the environment, the
+// default metadata server otherwise.
+func NewGCRFromEnv() *GCR {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = kGCRMetadataHost
+	}
+
+	return &GCR{
+		MetadataHost: host,
+		Client:       http.DefaultClient,
+	}
+}
+
+func (g *GCR) Resolve(ctx context.Context, registry string) (*Credential, error) {
+	if !isGCRHost(registry) {
+		return nil, credentials.ErrCredentialNotFound
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s", g.MetadataHost, kGCRTokenPath), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	if errors.As(err, &dnsErr) || errors.As(err, &opErr) {
+		return nil, credentials.ErrCredentialNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s: %s", ErrGCRUnexpectedResponse, resp.Status, data)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, err
+	}
+
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("%w: no access token", ErrGCRUnexpectedResponse)
+	}
+
+	return &Credential{Username: kGCRUsername, Password: token.AccessToken}, nil
+}
+
+// Container Registry is served from `gcr.io` and its regional hosts(`eu.gcr.io`), Artifact
+// Registry from a host for each location(`us-central1-docker.pkg.dev`).
+func isGCRHost(registry string) bool {
+	return registry == "gcr.io" ||
+		strings.HasSuffix(registry, ".gcr.io") ||
+		strings.HasSuffix(registry, "-docker.pkg.dev")
+}
@@ -0,0 +1,56 @@
+package registries
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/releasehub-com/spot/builder/internal/credentials"
+)
+
+var _ = Describe("GCR", func() {
+	var provider *GCR
+
+	BeforeEach(func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.URL.Path).To(Equal(kGCRTokenPath))
+
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			_, _ = io.WriteString(w, `{"access_token": "token", "expires_in": 3599, "token_type": "Bearer"}`)
+		}))
+		DeferCleanup(server.Close)
+
+		u, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		provider = &GCR{MetadataHost: u.Host}
+	})
+
+	It("uses the access token of the service account for Container Registry and Artifact Registry", func() {
+		for _, registry := range []string{"gcr.io", "eu.gcr.io", "us-central1-docker.pkg.dev"} {
+			credential, err := provider.Resolve(context.TODO(), registry)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credential).To(Equal(&Credential{Username: "oauth2accesstoken", Password: "token"}))
+		}
+	})
+
+	It("doesn't have credentials for other registries", func() {
+		_, err := provider.Resolve(context.TODO(), "registry.example.com")
+		Expect(err).To(MatchError(credentials.ErrCredentialNotFound))
+	})
+
+	It("doesn't have credentials when the metadata server can't be reached", func() {
+		provider.MetadataHost = "127.0.0.1:1"
+
+		_, err := provider.Resolve(context.TODO(), "gcr.io")
+		Expect(err).To(MatchError(credentials.ErrCredentialNotFound))
+	})
+})
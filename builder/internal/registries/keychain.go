@@ -1,20 +1,49 @@
 package registries
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
+	"sync"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/releasehub-com/spot/builder/internal/credentials"
+	"golang.org/x/sync/singleflight"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+// How long a provider has to resolve the credentials for a registry.
+const kResolveTimeout = 30 * time.Second
+
 // Keychain is the umbrella wrapping all the logic to extract the any authentication
 // fields that the builder support. The authentication token origin can change quite a lot
-// between location where the cluster runs. It should be noted that this is subject to change a
-// lot as I get more exposure to the different environnments.
-type Keychain map[Domain]Credential
+// between location where the cluster runs, so the keychain asks each of its providers in order
+// and uses the first one that has credentials for the registry.
+//
+// Credentials are cached for the lifetime of the keychain, which is the lifetime of a build. Every
+// token issued by the cloud providers is valid for at least an hour.
+type Keychain struct {
+	providers []Provider
+
+	// Context the providers are called with, see WithContext.
+	ctx   context.Context
+	cache *credentialCache
+}
 
-type Domain string
+// Cache shared by a keychain and the copies returned by WithContext. The providers are called
+// without holding the lock, concurrent lookups of the same registry share a single call.
+type credentialCache struct {
+	mu          sync.Mutex
+	credentials map[string]*Credential
+	lookups     singleflight.Group
+}
+
+// Provider resolves the credentials for a registry. Providers return ErrCredentialNotFound
+// for the registries they don't handle so the keychain can move on to the next provider.
+type Provider interface {
+	Resolve(ctx context.Context, registry string) (*Credential, error)
+}
 
 type Credential struct {
 	Username string `json:"username"`
@@ -26,44 +55,59 @@ type Credential struct {
 // Keychain can be used with the container registry
 // as a way to authenticate to any private registry
 //
-// Currently, the logic expects the user/password to already be set up
-// for the registry provider.
-// The Keychain is created off the JSON payload from the reader
-// and needs to follow the structure of the private struct define in the
-// method.
-func NewKeychain(r io.Reader) (Keychain, error) {
-	type cred struct {
-		Host        string `json:"host"`
-		AccessKey   string `json:"access_key"`
-		SecretToken string `json:"secret_token"`
-	}
-	var creds []cred
+// The credentials mounted in the pod by the operator come first, followed by the docker
+// config of the pod and the credentials of the cloud the cluster runs in (ECR, GCR/Artifact Registry
+// and ACR). The cloud providers are only used when the pod is configured for their workload identity.
+func NewKeychain(creds credentials.Credentials) *Keychain {
+	static := Static{}
+	var configs []string
+	for _, c := range creds {
+		if c.Type == credentials.TypeDockerConfig {
+			configs = append(configs, c.DockerConfigPath)
+			continue
+		}
 
-	decoder := json.NewDecoder(r)
-	if err := decoder.Decode(&creds); err != nil {
-		return nil, err
+		static[c.Host] = Credential{
+			Username: c.Username,
+			Password: c.Password,
+		}
 	}
 
-	kc := Keychain{}
+	return NewKeychainWithProviders(
+		static,
+		NewDockerConfig(configs...),
+		NewECRFromEnv(),
+		NewGCRFromEnv(),
+		NewACRFromEnv(),
+	)
+}
 
-	for _, c := range creds {
-		kc[Domain(c.Host)] = Credential{
-			Username: c.AccessKey,
-			Password: c.SecretToken,
-		}
+// Create a Keychain that resolves the credentials with the providers, in order.
+func NewKeychainWithProviders(providers ...Provider) *Keychain {
+	return &Keychain{
+		providers: providers,
+		ctx:       context.Background(),
+		cache:     &credentialCache{credentials: map[string]*Credential{}},
 	}
+}
 
-	return kc, nil
+// WithContext returns a copy of the keychain that calls the providers with the context, which
+// cancels their requests when the build is cancelled. The copy shares the cache of the keychain.
+func (kc *Keychain) WithContext(ctx context.Context) *Keychain {
+	bound := *kc
+	bound.ctx = ctx
+	return &bound
 }
 
 // Resolve returns an Authenticator that will be used by the container registry
 // to authenticate the session.
-func (kc Keychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
-	host := target.RegistryStr()
-	credential, ok := kc[Domain(host)]
+func (kc *Keychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	ctx, cancel := context.WithTimeout(kc.ctx, kResolveTimeout)
+	defer cancel()
 
-	if !ok {
-		return nil, fmt.Errorf("couldn't find credentials for the host: %s", host)
+	credential, err := kc.credential(ctx, target.RegistryStr())
+	if err != nil {
+		return nil, err
 	}
 
 	return authn.FromConfig(authn.AuthConfig{
@@ -71,3 +115,60 @@ func (kc Keychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
 		Password: credential.Password,
 	}), nil
 }
+
+func (kc *Keychain) credential(ctx context.Context, registry string) (*Credential, error) {
+	kc.cache.mu.Lock()
+	credential, ok := kc.cache.credentials[registry]
+	kc.cache.mu.Unlock()
+
+	if ok {
+		return credential, nil
+	}
+
+	value, err, _ := kc.cache.lookups.Do(registry, func() (any, error) {
+		credential, err := kc.lookup(ctx, registry)
+		if err != nil {
+			return nil, err
+		}
+
+		kc.cache.mu.Lock()
+		kc.cache.credentials[registry] = credential
+		kc.cache.mu.Unlock()
+		return credential, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*Credential), nil
+}
+
+func (kc *Keychain) lookup(ctx context.Context, registry string) (*Credential, error) {
+	for _, provider := range kc.providers {
+		credential, err := provider.Resolve(ctx, registry)
+		if errors.Is(err, credentials.ErrCredentialNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("couldn't resolve the credentials for %s: %w", registry, err)
+		}
+
+		log.FromContext(ctx).Info("Resolved credentials", "registry", registry, "provider", fmt.Sprintf("%T", provider))
+		return credential, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", credentials.ErrCredentialNotFound, registry)
+}
+
+// Static credentials, indexed by the registry they are for.
+type Static map[string]Credential
+
+func (s Static) Resolve(ctx context.Context, registry string) (*Credential, error) {
+	credential, ok := s[registry]
+	if !ok {
+		return nil, credentials.ErrCredentialNotFound
+	}
+
+	return &credential, nil
+}
@@ -0,0 +1,195 @@
+package registries
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/releasehub-com/spot/builder/internal/credentials"
+)
+
+// Provider counting how many times it was asked for credentials.
+type countingProvider struct {
+	Static
+	calls int
+}
+
+func (c *countingProvider) Resolve(ctx context.Context, registry string) (*Credential, error) {
+	c.calls++
+	return c.Static.Resolve(ctx, registry)
+}
+
+// Provider blocking on the registries of release until the channel is closed.
+type blockingProvider struct {
+	Static
+	release map[string]chan struct{}
+}
+
+func (b *blockingProvider) Resolve(ctx context.Context, registry string) (*Credential, error) {
+	if release, ok := b.release[registry]; ok {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return b.Static.Resolve(ctx, registry)
+}
+
+var _ = Describe("Keychain", func() {
+	resolve := func(keychain authn.Keychain, registry string) (*authn.AuthConfig, error) {
+		reg, err := name.NewRegistry(registry)
+		Expect(err).NotTo(HaveOccurred())
+
+		auth, err := keychain.Resolve(reg)
+		if err != nil {
+			return nil, err
+		}
+
+		return auth.Authorization()
+	}
+
+	It("uses the first provider with credentials for the registry", func() {
+		keychain := NewKeychainWithProviders(
+			Static{"registry.example.com": Credential{Username: "first", Password: "secret"}},
+			Static{
+				"registry.example.com": Credential{Username: "second", Password: "secret"},
+				"other.example.com":    Credential{Username: "other", Password: "secret"},
+			},
+		)
+
+		config, err := resolve(keychain, "registry.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Username).To(Equal("first"))
+
+		config, err = resolve(keychain, "other.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Username).To(Equal("other"))
+	})
+
+	It("returns ErrCredentialNotFound when no provider has credentials", func() {
+		keychain := NewKeychainWithProviders(Static{})
+
+		_, err := resolve(keychain, "registry.example.com")
+		Expect(err).To(MatchError(credentials.ErrCredentialNotFound))
+	})
+
+	It("caches the credentials of each registry", func() {
+		provider := &countingProvider{Static: Static{"registry.example.com": Credential{Username: "user"}}}
+		keychain := NewKeychainWithProviders(provider)
+
+		for i := 0; i < 3; i++ {
+			_, err := resolve(keychain, "registry.example.com")
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(provider.calls).To(Equal(1))
+	})
+
+	It("resolves other registries while a provider is slow", func() {
+		release := make(chan struct{})
+		provider := &blockingProvider{
+			Static: Static{
+				"slow.example.com": Credential{Username: "slow"},
+				"fast.example.com": Credential{Username: "fast"},
+			},
+			release: map[string]chan struct{}{"slow.example.com": release},
+		}
+		keychain := NewKeychainWithProviders(provider)
+
+		slow := make(chan string)
+		go func() {
+			defer GinkgoRecover()
+			config, err := resolve(keychain, "slow.example.com")
+			Expect(err).NotTo(HaveOccurred())
+			slow <- config.Username
+		}()
+
+		config, err := resolve(keychain, "fast.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Username).To(Equal("fast"))
+
+		close(release)
+		Eventually(slow).Should(Receive(Equal("slow")))
+	})
+
+	It("calls the providers with the context of the keychain", func() {
+		provider := &blockingProvider{
+			Static:  Static{"registry.example.com": Credential{Username: "user"}},
+			release: map[string]chan struct{}{"registry.example.com": make(chan struct{})},
+		}
+
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+
+		_, err := resolve(NewKeychainWithProviders(provider).WithContext(ctx), "registry.example.com")
+		Expect(err).To(MatchError(context.Canceled))
+	})
+
+	It("reads the docker config mounted from a dockerconfigjson secret", func() {
+		dir := GinkgoT().TempDir()
+		GinkgoT().Setenv("DOCKER_CONFIG", GinkgoT().TempDir())
+
+		Expect(os.WriteFile(path.Join(dir, ".dockerconfigjson"), []byte(`{"auths": {"registry.example.com": {"username": "user", "password": "secret"}}}`), 0600)).To(Succeed())
+		keychain := NewKeychain(credentials.Credentials{
+			{Host: "registry.example.com", Type: credentials.TypeDockerConfig, DockerConfigPath: path.Join(dir, ".dockerconfigjson")},
+		})
+
+		config, err := resolve(keychain, "registry.example.com")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Username).To(Equal("user"))
+		Expect(config.Password).To(Equal("secret"))
+	})
+
+	Context("DockerConfig", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+		})
+
+		write := func(name, content string) string {
+			p := path.Join(dir, name)
+			Expect(os.WriteFile(p, []byte(content), 0600)).To(Succeed())
+			return p
+		}
+
+		It("decodes the auth of the registry", func() {
+			auth := base64.StdEncoding.EncodeToString([]byte("user:pass:word"))
+			config := write("config.json", `{"auths": {"https://index.docker.io/v1/": {"auth": "`+auth+`"}}}`)
+
+			credential, err := (&DockerConfig{Paths: []string{config}}).Resolve(context.TODO(), "index.docker.io")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credential).To(Equal(&Credential{Username: "user", Password: "pass:word"}))
+		})
+
+		It("reads the files in order and ignores the missing ones", func() {
+			first := write("first.json", `{"auths": {"registry.example.com": {"username": "first"}}}`)
+			second := write("second.json", `{"auths": {"registry.example.com": {"username": "second"}, "docker.io": {"username": "hub"}}}`)
+
+			provider := &DockerConfig{Paths: []string{path.Join(dir, "missing.json"), first, second}}
+			credential, err := provider.Resolve(context.TODO(), "registry.example.com")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credential.Username).To(Equal("first"))
+
+			credential, err = provider.Resolve(context.TODO(), "index.docker.io")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(credential.Username).To(Equal("hub"))
+
+			_, err = provider.Resolve(context.TODO(), "other.example.com")
+			Expect(err).To(MatchError(credentials.ErrCredentialNotFound))
+		})
+
+		It("fails on an invalid config", func() {
+			config := write("config.json", `{"auths": {"registry.example.com": {"auth": "not base64"}}}`)
+
+			_, err := (&DockerConfig{Paths: []string{config}}).Resolve(context.TODO(), "registry.example.com")
+			Expect(err).To(MatchError(ErrDockerConfigInvalid))
+		})
+	})
+})
@@ -2,10 +2,12 @@ package registries
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"strings"
+	"sync"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	gcr "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
@@ -13,36 +15,259 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-// Upload the given imageIndex to the registy at `url`
-func Upload(ctx context.Context, index gcr.ImageIndex, url string, keychain Keychain) (*spot.BuildImage, error) {
+var ErrUploadFailed = errors.New("image couldn't be pushed")
+
+// Destination is a repository the image is pushed to, with its tags.
+type Destination struct {
+	URL  string   `json:"url"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+// UploadError is returned by Upload when the image couldn't be pushed to some of the destinations. It
+// matches ErrUploadFailed.
+type UploadError struct {
+	// Errors of the destinations, in their order. The error of a destination the image was pushed to is nil.
+	Errors       []error
+	destinations []Destination
+}
+
+func (e *UploadError) Error() string {
+	var failures []string
+	for i, err := range e.Errors {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", e.destinations[i].URL, err))
+		}
+	}
+
+	return fmt.Sprintf("%s: %s", ErrUploadFailed, strings.Join(failures, "; "))
+}
+
+func (e *UploadError) Unwrap() error {
+	return ErrUploadFailed
+}
+
+// Upload the image to every destination, concurrently. The credentials of each destination are resolved by the keychain
+// from its host. The images are returned in the order of the destinations, the image of a destination the push failed for
+// is nil and the error is an UploadError with the error of each destination.
+func Upload(ctx context.Context, index gcr.ImageIndex, destinations []Destination, keychain authn.Keychain) ([]*spot.BuildImage, error) {
+	images := make([]*spot.BuildImage, len(destinations))
+	errs := make([]error, len(destinations))
+
+	var wg sync.WaitGroup
+	for i, destination := range destinations {
+		wg.Add(1)
+		go func(i int, destination Destination) {
+			defer wg.Done()
+			images[i], errs[i] = upload(ctx, index, destination.URL, destination.Tags, keychain)
+		}(i, destination)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return images, &UploadError{Errors: errs, destinations: destinations}
+		}
+	}
+
+	return images, nil
+}
+
+// Upload the image to the repository at `url` with every tag. The image is pushed once and each tag points
+// to the same manifest. When no tag is given, the image is pushed with the tag of the url, `latest` if it has none.
+//
+// Buildkit exports the image as an OCI layout where the index wraps the image that was built. The wrapped image,
+// or image index for multi-platform builds, is what gets pushed so the digest that is reported is the one a
+// client pulling any of the tags gets.
+func upload(ctx context.Context, index gcr.ImageIndex, url string, tags []string, keychain authn.Keychain) (*spot.BuildImage, error) {
 	logger := log.FromContext(ctx)
 
 	ref, err := name.ParseReference(url)
 	if err != nil {
 		return nil, err
 	}
+	repository := ref.Context()
 
-	logger.Info("Uploading the index", "reference", ref)
+	if len(tags) == 0 {
+		tags = []string{ref.Identifier()}
+	}
 
-	if err := remote.WriteIndex(ref, index, remote.WithAuthFromKeychain(keychain)); err != nil {
+	image, descriptor, err := unwrap(index)
+	if err != nil {
 		return nil, err
 	}
 
-	manifest, err := index.IndexManifest()
-	if err != nil {
+	refs := map[name.Reference]remote.Taggable{}
+	for _, tag := range tags {
+		refs[repository.Tag(tag)] = image
+	}
+
+	logger.Info("Uploading the image", "repository", repository.String(), "digest", descriptor.Digest.String(), "tags", tags)
+	if err := remote.MultiWrite(refs, remote.WithContext(ctx), remote.WithAuthFromKeychain(keychain)); err != nil {
 		return nil, err
 	}
 
-	metadata, err := json.Marshal(manifest)
+	metadata, err := image.RawManifest()
 	if err != nil {
 		return nil, err
 	}
 
-	registry := os.Getenv("IMAGE_URL")
-	imageTag := os.Getenv("IMAGE_TAG")
+	var platforms []spot.BuildImagePlatform
+	var attestations []spot.BuildImageAttestation
+	if child, ok := image.(gcr.ImageIndex); ok {
+		if platforms, err = Platforms(child); err != nil {
+			return nil, err
+		}
+
+		if attestations, err = Attestations(child); err != nil {
+			return nil, err
+		}
+	} else if descriptor.Platform != nil {
+		platforms = []spot.BuildImagePlatform{{
+			Platform: descriptor.Platform.String(),
+			Digest:   descriptor.Digest.String(),
+		}}
+	}
 
 	return &spot.BuildImage{
-		URL:      fmt.Sprint(registry, ":", imageTag),
-		Metadata: string(metadata),
+		URL:          url,
+		Digest:       descriptor.Digest.String(),
+		Reference:    repository.Digest(descriptor.Digest.String()).String(),
+		Tags:         tags,
+		Metadata:     string(metadata),
+		Platforms:    platforms,
+		Attestations: attestations,
 	}, nil
 }
+
+// Returns the image, or the image index, wrapped by the OCI layout's index along with its descriptor.
+// An index that wraps more than one manifest is returned as is since there's no single image to unwrap.
+func unwrap(index gcr.ImageIndex) (remote.Taggable, gcr.Descriptor, error) {
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, gcr.Descriptor{}, err
+	}
+
+	if len(manifest.Manifests) != 1 {
+		digest, err := index.Digest()
+		if err != nil {
+			return nil, gcr.Descriptor{}, err
+		}
+
+		mediaType, err := index.MediaType()
+		return index, gcr.Descriptor{Digest: digest, MediaType: mediaType}, err
+	}
+
+	descriptor := manifest.Manifests[0]
+	if descriptor.MediaType.IsIndex() {
+		child, err := index.ImageIndex(descriptor.Digest)
+		return child, descriptor, err
+	}
+
+	child, err := index.Image(descriptor.Digest)
+	return child, descriptor, err
+}
+
+// Platforms walks the index and returns the digest of every image manifest that
+// targets a platform. Buildkit nests the multi-platform index inside the OCI layout's
+// index so any child index is walked recursively. Manifests that don't target a platform,
+// like the attestation manifests that buildkit attaches to an index, are ignored.
+func Platforms(index gcr.ImageIndex) ([]spot.BuildImagePlatform, error) {
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var platforms []spot.BuildImagePlatform
+	for _, descriptor := range manifest.Manifests {
+		if descriptor.MediaType.IsIndex() {
+			child, err := index.ImageIndex(descriptor.Digest)
+			if err != nil {
+				return nil, err
+			}
+
+			childPlatforms, err := Platforms(child)
+			if err != nil {
+				return nil, err
+			}
+
+			platforms = append(platforms, childPlatforms...)
+			continue
+		}
+
+		if descriptor.Platform == nil || descriptor.Platform.OS == "unknown" {
+			continue
+		}
+
+		platforms = append(platforms, spot.BuildImagePlatform{
+			Platform: descriptor.Platform.String(),
+			Digest:   descriptor.Digest.String(),
+		})
+	}
+
+	return platforms, nil
+}
+
+// Annotations buildkit sets on the attestation manifests of an index. The in-toto
+// predicate type is set on each layer of the attestation manifest.
+const (
+	kReferenceTypeAnnotation   = "vnd.docker.reference.type"
+	kReferenceDigestAnnotation = "vnd.docker.reference.digest"
+	kPredicateTypeAnnotation   = "in-toto.io/predicate-type"
+	kAttestationManifest       = "attestation-manifest"
+)
+
+// Attestations walks the index, like Platforms, and returns the attestation manifests
+// buildkit attached to the image with the predicate types of the statements they hold.
+func Attestations(index gcr.ImageIndex) ([]spot.BuildImageAttestation, error) {
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var attestations []spot.BuildImageAttestation
+	for _, descriptor := range manifest.Manifests {
+		if descriptor.MediaType.IsIndex() {
+			child, err := index.ImageIndex(descriptor.Digest)
+			if err != nil {
+				return nil, err
+			}
+
+			childAttestations, err := Attestations(child)
+			if err != nil {
+				return nil, err
+			}
+
+			attestations = append(attestations, childAttestations...)
+			continue
+		}
+
+		if descriptor.Annotations[kReferenceTypeAnnotation] != kAttestationManifest {
+			continue
+		}
+
+		image, err := index.Image(descriptor.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		imageManifest, err := image.Manifest()
+		if err != nil {
+			return nil, err
+		}
+
+		attestation := spot.BuildImageAttestation{
+			Digest:  descriptor.Digest.String(),
+			Subject: descriptor.Annotations[kReferenceDigestAnnotation],
+		}
+
+		for _, layer := range imageManifest.Layers {
+			if predicateType, ok := layer.Annotations[kPredicateTypeAnnotation]; ok {
+				attestation.PredicateTypes = append(attestation.PredicateTypes, predicateType)
+			}
+		}
+
+		attestations = append(attestations, attestation)
+	}
+
+	return attestations, nil
+}
@@ -0,0 +1,209 @@
+package registries
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	gcr "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+var _ = Describe("Registry", func() {
+	Context("Platforms", func() {
+		It("returns the digest of each platform in a nested index", func() {
+			amd64, err := random.Image(64, 1)
+			Expect(err).NotTo(HaveOccurred())
+			arm64, err := random.Image(64, 1)
+			Expect(err).NotTo(HaveOccurred())
+			attestation, err := random.Image(64, 1)
+			Expect(err).NotTo(HaveOccurred())
+
+			platforms := mutate.AppendManifests(empty.Index,
+				mutate.IndexAddendum{Add: amd64, Descriptor: gcr.Descriptor{Platform: &gcr.Platform{OS: "linux", Architecture: "amd64"}}},
+				mutate.IndexAddendum{Add: arm64, Descriptor: gcr.Descriptor{Platform: &gcr.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}}},
+				mutate.IndexAddendum{Add: attestation, Descriptor: gcr.Descriptor{Platform: &gcr.Platform{OS: "unknown", Architecture: "unknown"}}},
+			)
+			index := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: platforms})
+
+			amd64Digest, err := amd64.Digest()
+			Expect(err).NotTo(HaveOccurred())
+			arm64Digest, err := arm64.Digest()
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := Platforms(index)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(HaveLen(2))
+			Expect(result[0].Platform).To(Equal("linux/amd64"))
+			Expect(result[0].Digest).To(Equal(amd64Digest.String()))
+			Expect(result[1].Platform).To(Equal("linux/arm64/v8"))
+			Expect(result[1].Digest).To(Equal(arm64Digest.String()))
+		})
+	})
+
+	Context("Attestations", func() {
+		It("returns the attestation manifests with their predicate types", func() {
+			amd64, err := random.Image(64, 1)
+			Expect(err).NotTo(HaveOccurred())
+			amd64Digest, err := amd64.Digest()
+			Expect(err).NotTo(HaveOccurred())
+
+			sbom, err := random.Layer(64, types.MediaType("application/vnd.in-toto+json"))
+			Expect(err).NotTo(HaveOccurred())
+			provenance, err := random.Layer(64, types.MediaType("application/vnd.in-toto+json"))
+			Expect(err).NotTo(HaveOccurred())
+
+			attestation, err := mutate.Append(empty.Image,
+				mutate.Addendum{Layer: sbom, Annotations: map[string]string{"in-toto.io/predicate-type": "https://spdx.dev/Document"}},
+				mutate.Addendum{Layer: provenance, Annotations: map[string]string{"in-toto.io/predicate-type": "https://slsa.dev/provenance/v0.2"}},
+			)
+			Expect(err).NotTo(HaveOccurred())
+			attestationDigest, err := attestation.Digest()
+			Expect(err).NotTo(HaveOccurred())
+
+			platforms := mutate.AppendManifests(empty.Index,
+				mutate.IndexAddendum{Add: amd64, Descriptor: gcr.Descriptor{Platform: &gcr.Platform{OS: "linux", Architecture: "amd64"}}},
+				mutate.IndexAddendum{Add: attestation, Descriptor: gcr.Descriptor{
+					Platform: &gcr.Platform{OS: "unknown", Architecture: "unknown"},
+					Annotations: map[string]string{
+						"vnd.docker.reference.type":   "attestation-manifest",
+						"vnd.docker.reference.digest": amd64Digest.String(),
+					},
+				}},
+			)
+			index := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: platforms})
+
+			result, err := Attestations(index)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal([]spot.BuildImageAttestation{{
+				Digest:         attestationDigest.String(),
+				Subject:        amd64Digest.String(),
+				PredicateTypes: []string{"https://spdx.dev/Document", "https://slsa.dev/provenance/v0.2"},
+			}}))
+
+			platformsResult, err := Platforms(index)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(platformsResult).To(HaveLen(1))
+		})
+	})
+
+	Context("Upload", func() {
+		var host string
+		var keychain *Keychain
+
+		BeforeEach(func() {
+			server := httptest.NewServer(registry.New())
+			DeferCleanup(server.Close)
+
+			u, err := url.Parse(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			host = u.Host
+			keychain = NewKeychainWithProviders(Static{host: Credential{}})
+		})
+
+		It("pushes the wrapped image with every tag and reports its digest", func() {
+			amd64, err := random.Image(64, 1)
+			Expect(err).NotTo(HaveOccurred())
+			arm64, err := random.Image(64, 1)
+			Expect(err).NotTo(HaveOccurred())
+
+			platforms := mutate.AppendManifests(empty.Index,
+				mutate.IndexAddendum{Add: amd64, Descriptor: gcr.Descriptor{Platform: &gcr.Platform{OS: "linux", Architecture: "amd64"}}},
+				mutate.IndexAddendum{Add: arm64, Descriptor: gcr.Descriptor{Platform: &gcr.Platform{OS: "linux", Architecture: "arm64"}}},
+			)
+			layout := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: platforms})
+
+			digest, err := platforms.Digest()
+			Expect(err).NotTo(HaveOccurred())
+
+			images, err := Upload(context.Background(), layout, []Destination{{URL: host + "/spot/app", Tags: []string{"v1.0.0", "main"}}}, keychain)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(images).To(HaveLen(1))
+			image := images[0]
+
+			Expect(image.URL).To(Equal(host + "/spot/app"))
+			Expect(image.Digest).To(Equal(digest.String()))
+			Expect(image.Reference).To(Equal(host + "/spot/app@" + digest.String()))
+			Expect(image.Tags).To(Equal([]string{"v1.0.0", "main"}))
+			Expect(image.Platforms).To(HaveLen(2))
+
+			for _, tag := range image.Tags {
+				ref, err := name.ParseReference(host + "/spot/app:" + tag)
+				Expect(err).NotTo(HaveOccurred())
+
+				descriptor, err := remote.Head(ref, remote.WithAuthFromKeychain(keychain))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(descriptor.Digest).To(Equal(digest))
+			}
+		})
+
+		It("uses the tag of the url when no tags are set", func() {
+			img, err := random.Image(64, 1)
+			Expect(err).NotTo(HaveOccurred())
+			layout := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img, Descriptor: gcr.Descriptor{Platform: &gcr.Platform{OS: "linux", Architecture: "amd64"}}})
+
+			digest, err := img.Digest()
+			Expect(err).NotTo(HaveOccurred())
+
+			images, err := Upload(context.Background(), layout, []Destination{{URL: host + "/spot/app"}}, keychain)
+			Expect(err).NotTo(HaveOccurred())
+			image := images[0]
+
+			Expect(image.Digest).To(Equal(digest.String()))
+			Expect(image.Tags).To(Equal([]string{"latest"}))
+			Expect(image.Platforms).To(Equal([]spot.BuildImagePlatform{{Platform: "linux/amd64", Digest: digest.String()}}))
+		})
+
+		It("pushes the image to every destination and reports the ones that failed", func() {
+			mirror := httptest.NewServer(registry.New())
+			DeferCleanup(mirror.Close)
+			mirrorURL, err := url.Parse(mirror.URL)
+			Expect(err).NotTo(HaveOccurred())
+
+			// The keychain doesn't have credentials for this registry.
+			unknown := httptest.NewServer(registry.New())
+			DeferCleanup(unknown.Close)
+			unknownURL, err := url.Parse(unknown.URL)
+			Expect(err).NotTo(HaveOccurred())
+
+			img, err := random.Image(64, 1)
+			Expect(err).NotTo(HaveOccurred())
+			layout := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img})
+
+			digest, err := img.Digest()
+			Expect(err).NotTo(HaveOccurred())
+
+			keychain = NewKeychainWithProviders(Static{host: Credential{}, mirrorURL.Host: Credential{}})
+			images, err := Upload(context.Background(), layout, []Destination{
+				{URL: host + "/spot/app", Tags: []string{"main"}},
+				{URL: mirrorURL.Host + "/mirror/app", Tags: []string{"v1.0.0"}},
+				{URL: unknownURL.Host + "/spot/app"},
+			}, keychain)
+			Expect(err).To(MatchError(ErrUploadFailed))
+			Expect(err.Error()).To(ContainSubstring(unknownURL.Host))
+
+			Expect(images).To(HaveLen(3))
+			Expect(images[0].Reference).To(Equal(host + "/spot/app@" + digest.String()))
+			Expect(images[1].Reference).To(Equal(mirrorURL.Host + "/mirror/app@" + digest.String()))
+			Expect(images[1].Tags).To(Equal([]string{"v1.0.0"}))
+			Expect(images[2]).To(BeNil())
+
+			var uploadErr *UploadError
+			Expect(errors.As(err, &uploadErr)).To(BeTrue())
+			Expect(uploadErr.Errors).To(HaveLen(3))
+			Expect(uploadErr.Errors[0]).NotTo(HaveOccurred())
+			Expect(uploadErr.Errors[1]).NotTo(HaveOccurred())
+			Expect(uploadErr.Errors[2]).To(HaveOccurred())
+		})
+	})
+})
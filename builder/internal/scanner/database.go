@@ -0,0 +1,192 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	ErrDatabaseInvalid     = errors.New("couldn't open the vulnerability database")
+	ErrDistributionUnknown = errors.New("distribution isn't supported by the scanner")
+)
+
+// Trivy's database stores the advisories of each distribution's release in a bucket named after it (ie. `debian 12`),
+// with a bucket for each source package holding its advisories by vulnerability. The details of the vulnerabilities,
+// like their severity, are stored in their own bucket.
+const kVulnerabilityBucket = "vulnerability"
+
+// Status of an advisory for a package that isn't affected by the vulnerability.
+const kStatusNotAffected = 1
+
+// How long opening the database waits for a process writing to it.
+const kOpenTimeout = 10 * time.Second
+
+// Vulnerability of a source package, as listed in the database. A package is vulnerable when its version is
+// lower than the version the vulnerability was fixed in. Vulnerabilities that were never fixed affect every
+// version of the package.
+type Vulnerability struct {
+	ID       string
+	Package  string
+	Fixed    string
+	Severity spot.Severity
+}
+
+// Database is trivy's offline vulnerability database the images are scanned against.
+type Database struct {
+	db *bolt.DB
+}
+
+type advisory struct {
+	FixedVersion string          `json:",omitempty"`
+	Status       json.RawMessage `json:",omitempty"`
+	Severity     int             `json:",omitempty"`
+}
+
+type vulnerabilityDetails struct {
+	Severity       string         `json:",omitempty"`
+	VendorSeverity map[string]int `json:",omitempty"`
+}
+
+// OpenDatabase opens trivy's database (`trivy.db`) read-only.
+func OpenDatabase(path string) (*Database, error) {
+	db, err := bolt.Open(path, 0400, &bolt.Options{ReadOnly: true, Timeout: kOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("%w(%s): %s", ErrDatabaseInvalid, path, err)
+	}
+
+	return &Database{db: db}, nil
+}
+
+func (d *Database) Close() error {
+	return d.db.Close()
+}
+
+// Match returns the vulnerabilities affecting the source package of the package in the release of the distribution.
+func (d *Database) Match(os OS, pkg Package) ([]Vulnerability, error) {
+	platform, err := platformBucket(os)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Vulnerability
+	err = d.db.View(func(tx *bolt.Tx) error {
+		advisories := tx.Bucket([]byte(platform))
+		if advisories == nil {
+			return nil
+		}
+
+		source := advisories.Bucket([]byte(pkg.SourceName))
+		if source == nil {
+			return nil
+		}
+
+		return source.ForEach(func(id, value []byte) error {
+			var adv advisory
+			if err := json.Unmarshal(value, &adv); err != nil {
+				return fmt.Errorf("%w: advisory %s of %s: %s", ErrDatabaseInvalid, id, pkg.SourceName, err)
+			}
+
+			if !isVulnerable(os.Family, pkg.SourceVersion, adv) {
+				return nil
+			}
+
+			matches = append(matches, Vulnerability{
+				ID:       string(id),
+				Package:  pkg.SourceName,
+				Fixed:    adv.FixedVersion,
+				Severity: severity(tx, os.Family, string(id), adv),
+			})
+			return nil
+		})
+	})
+
+	return matches, err
+}
+
+// Alpine only lists the vulnerabilities that were fixed, its advisories without a fixed version
+// are potentially vulnerable packages and are ignored like trivy does.
+func isVulnerable(family, version string, adv advisory) bool {
+	if status := string(bytes.Trim(adv.Status, `"`)); status == fmt.Sprint(kStatusNotAffected) || status == "not_affected" {
+		return false
+	}
+
+	if adv.FixedVersion == "" {
+		return family != FamilyAlpine
+	}
+
+	// Versions that can't be parsed can't be compared, trivy skips them as well.
+	result, err := CompareVersions(family, version, adv.FixedVersion)
+	return err == nil && result < 0
+}
+
+// The severity assessed by the distribution is preferred, followed by the severity of the advisory and
+// the severity trivy selected for the vulnerability.
+func severity(tx *bolt.Tx, family, id string, adv advisory) spot.Severity {
+	var details vulnerabilityDetails
+	if bucket := tx.Bucket([]byte(kVulnerabilityBucket)); bucket != nil {
+		if value := bucket.Get([]byte(id)); value != nil {
+			_ = json.Unmarshal(value, &details)
+		}
+	}
+
+	if vendor, ok := details.VendorSeverity[family]; ok && vendor > 0 {
+		return severityFromRank(vendor)
+	}
+
+	if adv.Severity > 0 {
+		return severityFromRank(adv.Severity)
+	}
+
+	return normalizeSeverity(spot.Severity(details.Severity))
+}
+
+// Trivy ranks the severities from 0 (unknown) to 4 (critical), the same order as the API's severities.
+func severityFromRank(rank int) spot.Severity {
+	if rank < 0 || rank >= len(spot.Severities) {
+		return spot.SeverityUnknown
+	}
+
+	return spot.Severities[rank]
+}
+
+// Trivy's severities are upper case (ie. CRITICAL), they are normalized to the severities
+// of the API. Anything else is unknown.
+func normalizeSeverity(severity spot.Severity) spot.Severity {
+	for _, known := range spot.Severities {
+		if strings.EqualFold(string(known), string(severity)) {
+			return known
+		}
+	}
+
+	return spot.SeverityUnknown
+}
+
+// Name of the bucket of the release's advisories. Alpine's advisories are by minor release (`alpine 3.18`),
+// debian's by major release (`debian 12`) and ubuntu's by release (`ubuntu 22.04`).
+func platformBucket(os OS) (string, error) {
+	version := os.Version
+	switch os.Family {
+	case FamilyAlpine:
+		if parts := strings.Split(version, "."); len(parts) > 2 {
+			version = strings.Join(parts[:2], ".")
+		}
+	case FamilyDebian:
+		version, _, _ = strings.Cut(version, ".")
+	case FamilyUbuntu:
+	default:
+		return "", fmt.Errorf("%w: %s", ErrDistributionUnknown, os.Family)
+	}
+
+	if version == "" {
+		return "", fmt.Errorf("%w: %s without a version", ErrDistributionUnknown, os.Family)
+	}
+
+	return fmt.Sprintf("%s %s", os.Family, version), nil
+}
@@ -0,0 +1,174 @@
+package scanner
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	gcr "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// Distributions the scanner knows how to find the packages of, named after the `ID` of their os-release.
+const (
+	FamilyAlpine = "alpine"
+	FamilyDebian = "debian"
+	FamilyUbuntu = "ubuntu"
+)
+
+// Package databases of the distributions. Distroless images don't have dpkg's status
+// file, every package has its own file in the status.d directory instead. Debian's
+// os-release is a symlink to the one in /usr/lib.
+const (
+	kApkInstalled  = "lib/apk/db/installed"
+	kDpkgStatus    = "var/lib/dpkg/status"
+	kDpkgStatusDir = "var/lib/dpkg/status.d"
+	kOSRelease     = "etc/os-release"
+	kUsrOSRelease  = "usr/lib/os-release"
+)
+
+// OS is the distribution of the image, as described by its os-release.
+type OS struct {
+	Family  string
+	Version string
+}
+
+// Package installed in an image. Distributions track their vulnerabilities by the source package the
+// binary packages are built from (ie. libssl3 is built from openssl), the source is the package itself
+// when the package database doesn't name one.
+type Package struct {
+	Name          string
+	Version       string
+	SourceName    string
+	SourceVersion string
+}
+
+// Inventory of the packages installed in an image.
+type Inventory struct {
+	OS       OS
+	Packages []Package
+}
+
+// ReadInventory returns the distribution of the image and its installed packages, read from the
+// package databases of its filesystem once all its layers are applied.
+func ReadInventory(image gcr.Image) (*Inventory, error) {
+	filesystem := mutate.Extract(image)
+	defer filesystem.Close()
+
+	inventory := &Inventory{}
+	releases := map[string]OS{}
+	reader := tar.NewReader(filesystem)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		switch {
+		case name == kOSRelease, name == kUsrOSRelease:
+			releases[name] = parseOSRelease(reader)
+		case name == kApkInstalled:
+			inventory.Packages = append(inventory.Packages, parseStanzas(reader, "P", "V", "o")...)
+		case name == kDpkgStatus, path.Dir(name) == kDpkgStatusDir:
+			inventory.Packages = append(inventory.Packages, parseStanzas(reader, "Package", "Version", "Source")...)
+		}
+	}
+
+	inventory.OS = releases[kOSRelease]
+	if inventory.OS.Family == "" {
+		inventory.OS = releases[kUsrOSRelease]
+	}
+
+	return inventory, nil
+}
+
+func parseOSRelease(r io.Reader) OS {
+	var os OS
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"'`)
+
+		switch key {
+		case "ID":
+			os.Family = value
+		case "VERSION_ID":
+			os.Version = value
+		}
+	}
+
+	return os
+}
+
+// Both apk and dpkg store their packages as stanzas of `key: value` lines separated by an empty
+// line. Apk uses single letter keys without a space after the colon (`P:musl`). Dpkg's source
+// has the version of the source package when it's different from the package's (`openssl (3.0.11-1)`).
+func parseStanzas(r io.Reader, nameKey, versionKey, sourceKey string) []Package {
+	var packages []Package
+	var current Package
+	installed := true
+
+	flush := func() {
+		if current.Name != "" && current.Version != "" && installed {
+			if current.SourceName == "" {
+				current.SourceName = current.Name
+			}
+
+			if current.SourceVersion == "" {
+				current.SourceVersion = current.Version
+			}
+
+			packages = append(packages, current)
+		}
+		current = Package{}
+		installed = true
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case nameKey:
+			current.Name = value
+		case versionKey:
+			current.Version = value
+		case sourceKey:
+			name, version, _ := strings.Cut(value, " ")
+			current.SourceName = name
+			current.SourceVersion = strings.Trim(version, "()")
+		case "Status":
+			// ie. `install ok installed`, removed packages keep their stanza.
+			installed = strings.HasSuffix(value, " installed")
+		}
+	}
+	flush()
+
+	return packages
+}
@@ -0,0 +1,134 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	gcr "github.com/google/go-containerregistry/pkg/v1"
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var ErrThresholdExceeded = errors.New("image has vulnerabilities at or above the threshold")
+
+// Finding is a vulnerability affecting a package installed in the image.
+type Finding struct {
+	Vulnerability
+	InstalledPackage string
+	InstalledVersion string
+}
+
+// Scan every platform of the image built by buildkit against the database. Manifests that don't
+// target a platform, like attestations, are ignored. A vulnerability found in more than one platform
+// is only reported once. Images without a distribution the scanner supports, like images built
+// from scratch, have no packages to scan.
+func Scan(ctx context.Context, index gcr.ImageIndex, db *Database) ([]Finding, error) {
+	logger := log.FromContext(ctx)
+
+	images, err := platformImages(index)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var findings []Finding
+	for _, image := range images {
+		inventory, err := ReadInventory(image)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(inventory.Packages) == 0 {
+			continue
+		}
+
+		// Trivy also only warns about the distributions it doesn't have advisories for.
+		if _, err := platformBucket(inventory.OS); err != nil {
+			logger.Info("Skipped the packages of an unsupported distribution", "error", err.Error())
+			continue
+		}
+
+		for _, pkg := range inventory.Packages {
+			vulnerabilities, err := db.Match(inventory.OS, pkg)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, vulnerability := range vulnerabilities {
+				key := fmt.Sprintf("%s/%s", vulnerability.ID, pkg.Name)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+
+				findings = append(findings, Finding{Vulnerability: vulnerability, InstalledPackage: pkg.Name, InstalledVersion: pkg.Version})
+			}
+		}
+	}
+
+	logger.Info("Scanned the image", "platforms", len(images), "vulnerabilities", len(findings))
+	return findings, nil
+}
+
+// Summarize the findings by severity. When a threshold is set, the findings at or above it are blocking
+// and ErrThresholdExceeded is returned along with the summary.
+func Summarize(findings []Finding, threshold spot.Severity) (*spot.VulnerabilitySummary, error) {
+	summary := &spot.VulnerabilitySummary{}
+	blocking := map[string]bool{}
+	for _, finding := range findings {
+		summary.Add(finding.Severity)
+
+		if threshold != "" && finding.Severity.AtLeast(threshold) && !blocking[finding.ID] {
+			blocking[finding.ID] = true
+			summary.Blocking = append(summary.Blocking, finding.ID)
+		}
+	}
+
+	if len(summary.Blocking) == 0 {
+		return summary, nil
+	}
+
+	sort.Strings(summary.Blocking)
+	return summary, fmt.Errorf("%w(%s): %s", ErrThresholdExceeded, threshold, strings.Join(summary.Blocking, ", "))
+}
+
+func platformImages(index gcr.ImageIndex) ([]gcr.Image, error) {
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var images []gcr.Image
+	for _, descriptor := range manifest.Manifests {
+		if descriptor.MediaType.IsIndex() {
+			child, err := index.ImageIndex(descriptor.Digest)
+			if err != nil {
+				return nil, err
+			}
+
+			childImages, err := platformImages(child)
+			if err != nil {
+				return nil, err
+			}
+
+			images = append(images, childImages...)
+			continue
+		}
+
+		if descriptor.Platform != nil && descriptor.Platform.OS == "unknown" {
+			continue
+		}
+
+		image, err := index.Image(descriptor.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, image)
+	}
+
+	return images, nil
+}
@@ -0,0 +1,308 @@
+package scanner
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"path"
+	"strings"
+
+	gcr "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Build an image with a single layer containing the files and the symlinks.
+func imageWithFiles(files map[string]string, links ...string) gcr.Image {
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	for name, content := range files {
+		Expect(writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})).To(Succeed())
+		_, err := writer.Write([]byte(content))
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	for i := 0; i < len(links); i += 2 {
+		Expect(writer.WriteHeader(&tar.Header{Name: links[i], Linkname: links[i+1], Mode: 0777, Typeflag: tar.TypeSymlink})).To(Succeed())
+	}
+	Expect(writer.Close()).To(Succeed())
+
+	layer, err := tarball.LayerFromReader(bytes.NewReader(buf.Bytes()))
+	Expect(err).NotTo(HaveOccurred())
+
+	image, err := mutate.AppendLayers(empty.Image, layer)
+	Expect(err).NotTo(HaveOccurred())
+
+	return image
+}
+
+// Advisories of the database, by platform, source package and vulnerability, in trivy's format.
+var advisories = map[string]map[string]map[string]string{
+	"alpine 3.18": {
+		"openssl": {
+			"CVE-2023-0001": `{"FixedVersion": "3.1.2-r0"}`,
+			"CVE-2023-0002": `{"FixedVersion": "3.1.0-r0"}`,
+			"CVE-2023-0005": `{}`,
+		},
+	},
+	"debian 12": {
+		"openssl": {"CVE-2023-0003": `{"FixedVersion": "3.0.11-1~deb12u1"}`},
+		"glibc":   {"CVE-2023-0004": `{"Status": 2, "Severity": 2}`},
+		"zlib":    {"CVE-2023-0006": `{"Status": 1}`},
+	},
+}
+
+var vulnerabilities = map[string]string{
+	"CVE-2023-0001": `{"Severity": "CRITICAL"}`,
+	"CVE-2023-0003": `{"Severity": "MEDIUM", "VendorSeverity": {"debian": 3, "nvd": 2}}`,
+	"CVE-2023-0004": `{"Severity": "LOW"}`,
+}
+
+func createDatabase() string {
+	file := path.Join(GinkgoT().TempDir(), "trivy.db")
+	db, err := bolt.Open(file, 0600, nil)
+	Expect(err).NotTo(HaveOccurred())
+	defer db.Close()
+
+	Expect(db.Update(func(tx *bolt.Tx) error {
+		for platform, packages := range advisories {
+			platformBucket, err := tx.CreateBucket([]byte(platform))
+			Expect(err).NotTo(HaveOccurred())
+
+			for name, advisories := range packages {
+				packageBucket, err := platformBucket.CreateBucket([]byte(name))
+				Expect(err).NotTo(HaveOccurred())
+
+				for id, advisory := range advisories {
+					Expect(packageBucket.Put([]byte(id), []byte(advisory))).To(Succeed())
+				}
+			}
+		}
+
+		bucket, err := tx.CreateBucket([]byte(kVulnerabilityBucket))
+		Expect(err).NotTo(HaveOccurred())
+		for id, vulnerability := range vulnerabilities {
+			Expect(bucket.Put([]byte(id), []byte(vulnerability))).To(Succeed())
+		}
+
+		return nil
+	})).To(Succeed())
+
+	return file
+}
+
+const (
+	alpineRelease = "NAME=\"Alpine Linux\"\nID=alpine\nVERSION_ID=3.18.4\n"
+	debianRelease = "PRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\nVERSION_ID=\"12\"\nID=debian\n"
+)
+
+var _ = Describe("Scanner", func() {
+	compare := func(family, a, b string) int {
+		result, err := CompareVersions(family, a, b)
+		Expect(err).NotTo(HaveOccurred())
+
+		switch {
+		case result < 0:
+			return -1
+		case result > 0:
+			return 1
+		}
+		return 0
+	}
+
+	Context("CompareVersions", func() {
+		DescribeTable("orders debian's versions like dpkg",
+			func(a, b string, expected int) {
+				Expect(compare(FamilyDebian, a, b)).To(Equal(expected))
+			},
+			Entry("equal", "1.2.3", "1.2.3", 0),
+			Entry("numeric parts", "1.10", "1.9", 1),
+			Entry("epochs", "1:1.0", "2.0", 1),
+			Entry("tilde sorts before anything", "3.0.11-1~deb12u1", "3.0.11-1", -1),
+			Entry("revisions", "3.0.9-1", "3.0.11-1~deb12u1", -1),
+		)
+
+		DescribeTable("orders alpine's versions like apk",
+			func(a, b string, expected int) {
+				Expect(compare(FamilyAlpine, a, b)).To(Equal(expected))
+			},
+			Entry("equal", "3.1.2-r0", "3.1.2-r0", 0),
+			Entry("revisions", "3.1.2-r1", "3.1.2-r0", 1),
+			Entry("release candidates sort before the release", "3.1.2_rc1-r0", "3.1.2-r0", -1),
+			Entry("patches sort after the release", "3.1.2_p1-r0", "3.1.2-r0", 1),
+			Entry("letters", "1.2.3a-r0", "1.2.3-r0", 1),
+		)
+
+		It("fails on versions that can't be parsed", func() {
+			_, err := CompareVersions(FamilyAlpine, "not a version", "1.0-r0")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("ReadInventory", func() {
+		It("reads the packages of alpine with their origin", func() {
+			image := imageWithFiles(map[string]string{
+				"etc/os-release":       alpineRelease,
+				"lib/apk/db/installed": "C:Q1abc=\nP:libssl3\nV:3.1.1-r1\no:openssl\n\nP:musl\nV:1.2.4-r1\n",
+			})
+
+			inventory, err := ReadInventory(image)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inventory.OS).To(Equal(OS{Family: FamilyAlpine, Version: "3.18.4"}))
+			Expect(inventory.Packages).To(ConsistOf(
+				Package{Name: "libssl3", Version: "3.1.1-r1", SourceName: "openssl", SourceVersion: "3.1.1-r1"},
+				Package{Name: "musl", Version: "1.2.4-r1", SourceName: "musl", SourceVersion: "1.2.4-r1"},
+			))
+		})
+
+		It("reads the packages of debian with their source package", func() {
+			image := imageWithFiles(map[string]string{
+				"usr/lib/os-release": debianRelease,
+				"var/lib/dpkg/status": strings.Join([]string{
+					"Package: libssl3\nStatus: install ok installed\nSource: openssl (3.0.9-1)\nVersion: 3.0.9-1+b1",
+					"Package: libc6\nStatus: install ok installed\nSource: glibc\nVersion: 2.36-9",
+					"Package: removed\nStatus: deinstall ok config-files\nVersion: 1.0",
+				}, "\n\n"),
+				"var/lib/dpkg/status.d/zlib1g": "Package: zlib1g\nSource: zlib\nVersion: 1:1.2.13.dfsg-1\n",
+			}, "etc/os-release", "../usr/lib/os-release")
+
+			inventory, err := ReadInventory(image)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inventory.OS).To(Equal(OS{Family: FamilyDebian, Version: "12"}))
+			Expect(inventory.Packages).To(ConsistOf(
+				Package{Name: "libssl3", Version: "3.0.9-1+b1", SourceName: "openssl", SourceVersion: "3.0.9-1"},
+				Package{Name: "libc6", Version: "2.36-9", SourceName: "glibc", SourceVersion: "2.36-9"},
+				Package{Name: "zlib1g", Version: "1:1.2.13.dfsg-1", SourceName: "zlib", SourceVersion: "1:1.2.13.dfsg-1"},
+			))
+		})
+	})
+
+	Context("Database", func() {
+		var db *Database
+
+		BeforeEach(func() {
+			var err error
+			db, err = OpenDatabase(createDatabase())
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(db.Close)
+		})
+
+		match := func(os OS, pkg Package) []Vulnerability {
+			matches, err := db.Match(os, pkg)
+			Expect(err).NotTo(HaveOccurred())
+			return matches
+		}
+
+		It("matches alpine's versions lower than the fixed version", func() {
+			alpine := OS{Family: FamilyAlpine, Version: "3.18.4"}
+
+			Expect(match(alpine, Package{Name: "libssl3", SourceName: "openssl", SourceVersion: "3.1.1-r1"})).To(ConsistOf(
+				Vulnerability{ID: "CVE-2023-0001", Package: "openssl", Fixed: "3.1.2-r0", Severity: spot.SeverityCritical},
+			))
+			Expect(match(alpine, Package{Name: "libssl3", SourceName: "openssl", SourceVersion: "3.1.2_rc1-r0"})).To(HaveLen(1))
+			Expect(match(alpine, Package{Name: "libssl3", SourceName: "openssl", SourceVersion: "3.1.2-r0"})).To(BeEmpty())
+		})
+
+		It("matches debian's packages by their source package", func() {
+			debian := OS{Family: FamilyDebian, Version: "12"}
+
+			Expect(match(debian, Package{Name: "libssl3", SourceName: "openssl", SourceVersion: "3.0.9-1"})).To(ConsistOf(
+				Vulnerability{ID: "CVE-2023-0003", Package: "openssl", Fixed: "3.0.11-1~deb12u1", Severity: spot.SeverityHigh},
+			))
+			Expect(match(debian, Package{Name: "libssl3", SourceName: "openssl", SourceVersion: "3.0.11-1~deb12u1"})).To(BeEmpty())
+			Expect(match(debian, Package{Name: "openssl", SourceName: "libssl3", SourceVersion: "3.0.9-1"})).To(BeEmpty())
+		})
+
+		It("matches the unfixed vulnerabilities of debian only", func() {
+			Expect(match(OS{Family: FamilyDebian, Version: "12.2"}, Package{Name: "libc6", SourceName: "glibc", SourceVersion: "2.36-9"})).To(ConsistOf(
+				Vulnerability{ID: "CVE-2023-0004", Package: "glibc", Severity: spot.SeverityMedium},
+			))
+			Expect(match(OS{Family: FamilyDebian, Version: "12"}, Package{Name: "zlib1g", SourceName: "zlib", SourceVersion: "1:1.2.13.dfsg-1"})).To(BeEmpty())
+		})
+
+		It("fails on unsupported distributions", func() {
+			_, err := db.Match(OS{Family: "fedora", Version: "38"}, Package{Name: "openssl", SourceName: "openssl", SourceVersion: "3.0.9"})
+			Expect(err).To(MatchError(ErrDistributionUnknown))
+		})
+
+		It("fails on invalid databases", func() {
+			_, err := OpenDatabase(path.Join(GinkgoT().TempDir(), "missing.db"))
+			Expect(err).To(MatchError(ErrDatabaseInvalid))
+		})
+	})
+
+	Context("Scan", func() {
+		var db *Database
+		var index gcr.ImageIndex
+
+		BeforeEach(func() {
+			var err error
+			db, err = OpenDatabase(createDatabase())
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(db.Close)
+
+			amd64 := imageWithFiles(map[string]string{
+				"etc/os-release":       alpineRelease,
+				"lib/apk/db/installed": "P:libssl3\nV:3.1.1-r1\no:openssl\n",
+			})
+			arm64 := imageWithFiles(map[string]string{
+				"etc/os-release":       alpineRelease,
+				"lib/apk/db/installed": "P:libssl3\nV:3.1.1-r1\no:openssl\n\nP:libcrypto3\nV:3.1.1-r1\no:openssl\n",
+			})
+			attestation := imageWithFiles(map[string]string{
+				"etc/os-release":      debianRelease,
+				"var/lib/dpkg/status": "Package: libc6\nSource: glibc\nVersion: 2.36-9\n",
+			})
+
+			index = mutate.AppendManifests(empty.Index,
+				mutate.IndexAddendum{Add: amd64, Descriptor: gcr.Descriptor{Platform: &gcr.Platform{OS: "linux", Architecture: "amd64"}}},
+				mutate.IndexAddendum{Add: arm64, Descriptor: gcr.Descriptor{Platform: &gcr.Platform{OS: "linux", Architecture: "arm64"}}},
+				mutate.IndexAddendum{Add: attestation, Descriptor: gcr.Descriptor{Platform: &gcr.Platform{OS: "unknown", Architecture: "unknown"}}},
+			)
+		})
+
+		It("reports every vulnerability of a package once", func() {
+			findings, err := Scan(context.TODO(), mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: index}), db)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(findings).To(HaveLen(2))
+
+			summary, err := Summarize(findings, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*summary).To(Equal(spot.VulnerabilitySummary{Critical: 2}))
+		})
+
+		It("skips the images without a supported distribution", func() {
+			scratch := imageWithFiles(map[string]string{"app": "binary"})
+			fedora := imageWithFiles(map[string]string{
+				"etc/os-release":      "ID=fedora\nVERSION_ID=38\n",
+				"var/lib/dpkg/status": "Package: libc6\nVersion: 2.36-9\n",
+			})
+
+			findings, err := Scan(context.TODO(), mutate.AppendManifests(empty.Index,
+				mutate.IndexAddendum{Add: scratch, Descriptor: gcr.Descriptor{Platform: &gcr.Platform{OS: "linux", Architecture: "amd64"}}},
+				mutate.IndexAddendum{Add: fedora, Descriptor: gcr.Descriptor{Platform: &gcr.Platform{OS: "linux", Architecture: "arm64"}}},
+			), db)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(findings).To(BeEmpty())
+		})
+
+		It("blocks the vulnerabilities at or above the threshold", func() {
+			findings, err := Scan(context.TODO(), index, db)
+			Expect(err).NotTo(HaveOccurred())
+
+			findings = append(findings, Finding{Vulnerability: Vulnerability{ID: "CVE-2023-0004", Severity: spot.SeverityMedium}})
+			summary, err := Summarize(findings, spot.SeverityMedium)
+			Expect(err).To(MatchError(ErrThresholdExceeded))
+			Expect(summary.Blocking).To(Equal([]string{"CVE-2023-0001", "CVE-2023-0004"}))
+
+			summary, err = Summarize(findings, spot.SeverityCritical)
+			Expect(err).To(MatchError(ErrThresholdExceeded))
+			Expect(summary.Blocking).To(Equal([]string{"CVE-2023-0001"}))
+		})
+	})
+})
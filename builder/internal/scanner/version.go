@@ -0,0 +1,37 @@
+package scanner
+
+import (
+	apk "github.com/knqyf263/go-apk-version"
+	deb "github.com/knqyf263/go-deb-version"
+)
+
+// CompareVersions compares two versions of a package with the rules of the distribution's package manager, with
+// the same libraries trivy uses: apk's for alpine, dpkg's for debian and ubuntu. Returns a negative number when
+// a < b, zero when they are equal and a positive number when a > b.
+func CompareVersions(family, a, b string) (int, error) {
+	if family == FamilyAlpine {
+		versionA, err := apk.NewVersion(a)
+		if err != nil {
+			return 0, err
+		}
+
+		versionB, err := apk.NewVersion(b)
+		if err != nil {
+			return 0, err
+		}
+
+		return versionA.Compare(versionB), nil
+	}
+
+	versionA, err := deb.NewVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	versionB, err := deb.NewVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return versionA.Compare(versionB), nil
+}
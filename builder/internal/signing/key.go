@@ -0,0 +1,144 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+var ErrKeyInvalid = errors.New("signing key is invalid")
+var ErrKeyPasswordInvalid = errors.New("signing key couldn't be decrypted with the password")
+
+// PEM types of the private keys generated by cosign, the key is encrypted with the password.
+const (
+	kEncryptedSigstoreKey = "ENCRYPTED SIGSTORE PRIVATE KEY"
+	kEncryptedCosignKey   = "ENCRYPTED COSIGN PRIVATE KEY"
+)
+
+// KeySigner signs with a private key, like `cosign sign --key`.
+type KeySigner struct {
+	key crypto.Signer
+}
+
+// Create a KeySigner out of a PEM encoded private key. Keys generated by cosign are encrypted
+// and decrypted with the password, unencrypted PKCS#8 and EC keys are also supported.
+func NewKeySigner(key, password []byte) (*KeySigner, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, fmt.Errorf("%w: not PEM encoded", ErrKeyInvalid)
+	}
+
+	var der []byte
+	switch block.Type {
+	case kEncryptedSigstoreKey, kEncryptedCosignKey:
+		var err error
+		if der, err = decrypt(block.Bytes, password); err != nil {
+			return nil, err
+		}
+
+	case "EC PRIVATE KEY":
+		ecKey, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrKeyInvalid, err)
+		}
+		return &KeySigner{key: ecKey}, nil
+
+	case "PRIVATE KEY":
+		der = block.Bytes
+
+	default:
+		return nil, fmt.Errorf("%w: unsupported PEM type %s", ErrKeyInvalid, block.Type)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrKeyInvalid, err)
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported key type %T", ErrKeyInvalid, parsed)
+	}
+
+	return &KeySigner{key: signer}, nil
+}
+
+func (k *KeySigner) Public() crypto.PublicKey {
+	return k.key.Public()
+}
+
+func (k *KeySigner) Sign(ctx context.Context, payload []byte) (*Signature, error) {
+	signature, err := sign(k.key, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Signature{Signature: signature}, nil
+}
+
+// Sign the SHA256 digest of the payload, ed25519 keys sign the payload itself.
+func sign(key crypto.Signer, payload []byte) ([]byte, error) {
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		return key.Sign(rand.Reader, payload, crypto.Hash(0))
+	}
+
+	digest := sha256.Sum256(payload)
+	return key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// Cosign encrypts the PKCS#8 private key with a key derived from the password
+// with scrypt, the key is sealed with NaCl's secretbox.
+func decrypt(data, password []byte) ([]byte, error) {
+	var encrypted struct {
+		KDF struct {
+			Name   string `json:"name"`
+			Params struct {
+				N int `json:"N"`
+				R int `json:"r"`
+				P int `json:"p"`
+			} `json:"params"`
+			Salt []byte `json:"salt"`
+		} `json:"kdf"`
+		Cipher struct {
+			Name  string `json:"name"`
+			Nonce []byte `json:"nonce"`
+		} `json:"cipher"`
+		Ciphertext []byte `json:"ciphertext"`
+	}
+
+	if err := json.Unmarshal(data, &encrypted); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrKeyInvalid, err)
+	}
+
+	if encrypted.KDF.Name != "scrypt" || encrypted.Cipher.Name != "nacl/secretbox" || len(encrypted.Cipher.Nonce) != 24 {
+		return nil, fmt.Errorf("%w: unsupported encryption %s with %s", ErrKeyInvalid, encrypted.Cipher.Name, encrypted.KDF.Name)
+	}
+
+	params := encrypted.KDF.Params
+	derived, err := scrypt.Key(password, encrypted.KDF.Salt, params.N, params.R, params.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrKeyInvalid, err)
+	}
+
+	var key [32]byte
+	var nonce [24]byte
+	copy(key[:], derived)
+	copy(nonce[:], encrypted.Cipher.Nonce)
+
+	der, ok := secretbox.Open(nil, encrypted.Ciphertext, &nonce, &key)
+	if !ok {
+		return nil, ErrKeyPasswordInvalid
+	}
+
+	return der, nil
+}
@@ -0,0 +1,273 @@
+package signing
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+var ErrIdentityTokenInvalid = errors.New("identity token is invalid")
+var ErrFulcioUnexpectedResponse = errors.New("unexpected response from Fulcio")
+var ErrRekorUnexpectedResponse = errors.New("unexpected response from Rekor")
+
+const (
+	kFulcioSigningCertPath = "/api/v2/signingCert"
+	kRekorEntriesPath      = "/api/v1/log/entries"
+)
+
+// KeylessSigner signs with an ephemeral key, like `cosign sign` without a key. Fulcio issues
+// a certificate for the key to the identity of the token, each signature is recorded in Rekor. The
+// same certificate is used for every signature of the signer.
+type KeylessSigner struct {
+	FulcioURL string
+	RekorURL  string
+
+	// Path of the OIDC token exchanged with Fulcio. The file is read when the
+	// certificate is requested since the token is rotated by the kubelet.
+	TokenPath string
+
+	Client *http.Client
+
+	mu          sync.Mutex
+	key         *ecdsa.PrivateKey
+	certificate []byte
+	chain       []byte
+}
+
+func (k *KeylessSigner) Sign(ctx context.Context, payload []byte) (*Signature, error) {
+	if err := k.requestCertificate(ctx); err != nil {
+		return nil, err
+	}
+
+	signature, err := sign(k.key, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle, err := k.record(ctx, payload, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Signature{
+		Signature:   signature,
+		Certificate: k.certificate,
+		Chain:       k.chain,
+		Bundle:      bundle,
+	}, nil
+}
+
+// Generate the ephemeral key and exchange the identity token for its certificate. Fulcio
+// requires a proof that the key is held by the requester, the subject of the token signed by the key.
+func (k *KeylessSigner) requestCertificate(ctx context.Context) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.certificate != nil {
+		return nil
+	}
+
+	token, err := os.ReadFile(k.TokenPath)
+	if err != nil {
+		return err
+	}
+	token = bytes.TrimSpace(token)
+
+	subject, err := tokenSubject(string(token))
+	if err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	proof, err := sign(key, []byte(subject))
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return err
+	}
+
+	request := map[string]any{
+		"credentials": map[string]string{"oidcIdentityToken": string(token)},
+		"publicKeyRequest": map[string]any{
+			"publicKey": map[string]string{
+				"algorithm": "ECDSA",
+				"content":   string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})),
+			},
+			"proofOfPossession": base64.StdEncoding.EncodeToString(proof),
+		},
+	}
+
+	var response struct {
+		Embedded *fulcioChain `json:"signedCertificateEmbeddedSct"`
+		Detached *fulcioChain `json:"signedCertificateDetachedSct"`
+	}
+
+	if err := k.post(ctx, k.FulcioURL+kFulcioSigningCertPath, request, &response, ErrFulcioUnexpectedResponse); err != nil {
+		return err
+	}
+
+	chain := response.Embedded
+	if chain == nil {
+		chain = response.Detached
+	}
+
+	if chain == nil || len(chain.Chain.Certificates) == 0 {
+		return fmt.Errorf("%w: no certificate was issued", ErrFulcioUnexpectedResponse)
+	}
+
+	k.key = key
+	k.certificate = []byte(chain.Chain.Certificates[0])
+	k.chain = []byte(strings.Join(chain.Chain.Certificates[1:], ""))
+	return nil
+}
+
+type fulcioChain struct {
+	Chain struct {
+		Certificates []string `json:"certificates"`
+	} `json:"chain"`
+}
+
+// Record the signature in Rekor as a hashedrekord entry and return the bundle cosign
+// stores with the signature so it can be verified offline.
+func (k *KeylessSigner) record(ctx context.Context, payload, signature []byte) ([]byte, error) {
+	digest := sha256.Sum256(payload)
+	request := map[string]any{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]any{
+			"data": map[string]any{
+				"hash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(digest[:])},
+			},
+			"signature": map[string]any{
+				"content":   base64.StdEncoding.EncodeToString(signature),
+				"publicKey": map[string]string{"content": base64.StdEncoding.EncodeToString(k.certificate)},
+			},
+		},
+	}
+
+	var response map[string]struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+		Verification   struct {
+			SignedEntryTimestamp string `json:"signedEntryTimestamp"`
+		} `json:"verification"`
+	}
+
+	if err := k.post(ctx, k.RekorURL+kRekorEntriesPath, request, &response, ErrRekorUnexpectedResponse); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range response {
+		var bundle struct {
+			SignedEntryTimestamp string `json:"SignedEntryTimestamp"`
+			Payload              struct {
+				Body           string `json:"body"`
+				IntegratedTime int64  `json:"integratedTime"`
+				LogIndex       int64  `json:"logIndex"`
+				LogID          string `json:"logID"`
+			} `json:"Payload"`
+		}
+
+		bundle.SignedEntryTimestamp = entry.Verification.SignedEntryTimestamp
+		bundle.Payload.Body = entry.Body
+		bundle.Payload.IntegratedTime = entry.IntegratedTime
+		bundle.Payload.LogIndex = entry.LogIndex
+		bundle.Payload.LogID = entry.LogID
+		return json.Marshal(bundle)
+	}
+
+	return nil, fmt.Errorf("%w: no entry was created", ErrRekorUnexpectedResponse)
+}
+
+func (k *KeylessSigner) post(ctx context.Context, url string, request, response any, unexpected error) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	client := k.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("%w: %s: %s", unexpected, resp.Status, data)
+	}
+
+	return json.Unmarshal(data, response)
+}
+
+// The certificate is issued to the email of the token when it has one, to
+// its subject otherwise (ie. `system:serviceaccount:<namespace>:<name>`).
+func tokenSubject(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%w: not a JWT", ErrIdentityTokenInvalid)
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrIdentityTokenInvalid, err)
+	}
+
+	var claims struct {
+		Subject string `json:"sub"`
+		Email   string `json:"email"`
+	}
+
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrIdentityTokenInvalid, err)
+	}
+
+	if claims.Email != "" {
+		return claims.Email, nil
+	}
+
+	if claims.Subject == "" {
+		return "", fmt.Errorf("%w: no subject", ErrIdentityTokenInvalid)
+	}
+
+	return claims.Subject, nil
+}
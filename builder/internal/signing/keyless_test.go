@@ -0,0 +1,200 @@
+package signing
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const kServiceAccount = "system:serviceaccount:default:builder"
+
+// Stand-in for Fulcio, it issues a certificate signed by its own CA for the public key
+// of the request after verifying the proof of possession.
+func newFulcio() (*httptest.Server, *x509.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fulcio"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, template, template, caKey.Public(), caKey)
+	Expect(err).NotTo(HaveOccurred())
+	ca, err := x509.ParseCertificate(caDER)
+	Expect(err).NotTo(HaveOccurred())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer GinkgoRecover()
+		Expect(r.URL.Path).To(Equal("/api/v2/signingCert"))
+
+		var request struct {
+			Credentials struct {
+				OIDCIdentityToken string `json:"oidcIdentityToken"`
+			} `json:"credentials"`
+			PublicKeyRequest struct {
+				PublicKey struct {
+					Content string `json:"content"`
+				} `json:"publicKey"`
+				ProofOfPossession []byte `json:"proofOfPossession"`
+			} `json:"publicKeyRequest"`
+		}
+		Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+		Expect(request.Credentials.OIDCIdentityToken).NotTo(BeEmpty())
+
+		block, _ := pem.Decode([]byte(request.PublicKeyRequest.PublicKey.Content))
+		Expect(block).NotTo(BeNil())
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		Expect(err).NotTo(HaveOccurred())
+
+		digest := sha256.Sum256([]byte(kServiceAccount))
+		Expect(ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), digest[:], request.PublicKeyRequest.ProofOfPossession)).To(BeTrue())
+
+		leaf := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(10 * time.Minute),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		}
+		leafDER, err := x509.CreateCertificate(rand.Reader, leaf, ca, publicKey, caKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(json.NewEncoder(w).Encode(map[string]any{
+			"signedCertificateEmbeddedSct": map[string]any{
+				"chain": map[string]any{"certificates": []string{
+					string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER})),
+					string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})),
+				}},
+			},
+		})).To(Succeed())
+	}))
+
+	return server, ca
+}
+
+var _ = Describe("KeylessSigner", func() {
+	var signer *KeylessSigner
+	var ca *x509.Certificate
+	var entries int
+
+	BeforeEach(func() {
+		var fulcio *httptest.Server
+		fulcio, ca = newFulcio()
+		DeferCleanup(fulcio.Close)
+
+		entries = 0
+		rekor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.URL.Path).To(Equal("/api/v1/log/entries"))
+
+			var request struct {
+				Kind string `json:"kind"`
+			}
+			Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+			Expect(request.Kind).To(Equal("hashedrekord"))
+
+			entries++
+			w.WriteHeader(http.StatusCreated)
+			Expect(json.NewEncoder(w).Encode(map[string]any{
+				"24296fb24b8ad77a": map[string]any{
+					"body":           "Ym9keQ==",
+					"integratedTime": 1700000000,
+					"logID":          "c0d23d6ad406973f",
+					"logIndex":       entries,
+					"verification":   map[string]any{"signedEntryTimestamp": "c2V0"},
+				},
+			})).To(Succeed())
+		}))
+		DeferCleanup(rekor.Close)
+
+		claims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub": "` + kServiceAccount + `", "aud": ["sigstore"]}`))
+		token := path.Join(GinkgoT().TempDir(), "token")
+		Expect(os.WriteFile(token, []byte("eyJhbGciOiJSUzI1NiJ9."+claims+".c2lnbmF0dXJl"), 0600)).To(Succeed())
+
+		signer = &KeylessSigner{FulcioURL: fulcio.URL, RekorURL: rekor.URL, TokenPath: token}
+	})
+
+	It("signs with a certificate issued by Fulcio and records the signature in Rekor", func() {
+		payload := []byte("payload")
+		signature, err := signer.Sign(context.TODO(), payload)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(Equal(1))
+
+		block, _ := pem.Decode(signature.Certificate)
+		Expect(block).NotTo(BeNil())
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(certificate.CheckSignatureFrom(ca)).To(Succeed())
+
+		digest := sha256.Sum256(payload)
+		Expect(ecdsa.VerifyASN1(certificate.PublicKey.(*ecdsa.PublicKey), digest[:], signature.Signature)).To(BeTrue())
+
+		block, _ = pem.Decode(signature.Chain)
+		Expect(block).NotTo(BeNil())
+		Expect(block.Bytes).To(Equal(ca.Raw))
+
+		var bundle struct {
+			SignedEntryTimestamp string
+			Payload              struct {
+				LogIndex int64 `json:"logIndex"`
+			}
+		}
+		Expect(json.Unmarshal(signature.Bundle, &bundle)).To(Succeed())
+		Expect(bundle.SignedEntryTimestamp).To(Equal("c2V0"))
+		Expect(bundle.Payload.LogIndex).To(BeEquivalentTo(1))
+
+		// The certificate is reused, every signature is recorded.
+		second, err := signer.Sign(context.TODO(), payload)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second.Certificate).To(Equal(signature.Certificate))
+		Expect(entries).To(Equal(2))
+	})
+
+	It("stores the certificate and the bundle with the signature", func() {
+		ref := pushRandomImage()
+
+		_, err := Sign(context.TODO(), ref, signer, authn.DefaultKeychain)
+		Expect(err).NotTo(HaveOccurred())
+
+		image, err := remote.Image(ref.Context().Tag("sha256-" + ref.DigestStr()[len("sha256:"):] + ".sig"))
+		Expect(err).NotTo(HaveOccurred())
+		manifest, err := image.Manifest()
+		Expect(err).NotTo(HaveOccurred())
+
+		annotations := manifest.Layers[0].Annotations
+		Expect(annotations).To(HaveKey("dev.cosignproject.cosign/signature"))
+		Expect(annotations["dev.sigstore.cosign/certificate"]).To(HavePrefix("-----BEGIN CERTIFICATE-----"))
+		Expect(annotations["dev.sigstore.cosign/chain"]).To(HavePrefix("-----BEGIN CERTIFICATE-----"))
+		Expect(annotations["dev.sigstore.cosign/bundle"]).To(ContainSubstring("SignedEntryTimestamp"))
+	})
+
+	It("requires a JWT with a subject", func() {
+		Expect(os.WriteFile(signer.TokenPath, []byte("not-a-token"), 0600)).To(Succeed())
+
+		_, err := signer.Sign(context.TODO(), []byte("payload"))
+		Expect(err).To(MatchError(ErrIdentityTokenInvalid))
+	})
+})
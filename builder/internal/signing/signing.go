@@ -0,0 +1,148 @@
+package signing
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	gcr "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Media type and annotations cosign uses for the signatures it stores in a registry.
+const (
+	kPayloadMediaType      = "application/vnd.dev.cosign.simplesigning.v1+json"
+	kSignatureAnnotation   = "dev.cosignproject.cosign/signature"
+	kCertificateAnnotation = "dev.sigstore.cosign/certificate"
+	kChainAnnotation       = "dev.sigstore.cosign/chain"
+	kBundleAnnotation      = "dev.sigstore.cosign/bundle"
+	kSignatureType         = "cosign container image signature"
+)
+
+// Signer signs the payload of a signature. Keyless signers also return
+// the certificate the signature can be verified with.
+type Signer interface {
+	Sign(ctx context.Context, payload []byte) (*Signature, error)
+}
+
+type Signature struct {
+	// Raw signature of the payload.
+	Signature []byte
+
+	// PEM encoded certificate of the key that signed the payload and the chain
+	// up to the root, only set for keyless signatures.
+	Certificate []byte
+	Chain       []byte
+
+	// Rekor bundle, as cosign stores it, proving that the signature is in the
+	// transparency log. Only set when the signature was recorded.
+	Bundle []byte
+}
+
+func (s *Signature) annotations() map[string]string {
+	annotations := map[string]string{
+		kSignatureAnnotation: base64.StdEncoding.EncodeToString(s.Signature),
+	}
+
+	if len(s.Certificate) != 0 {
+		annotations[kCertificateAnnotation] = string(s.Certificate)
+		annotations[kChainAnnotation] = string(s.Chain)
+	}
+
+	if len(s.Bundle) != 0 {
+		annotations[kBundleAnnotation] = string(s.Bundle)
+	}
+
+	return annotations
+}
+
+// Sign the image at `ref` and push the signature to the image's repository, where cosign looks for it:
+// the `sha256-<hex>.sig` tag. Signatures already pushed for the image are kept, the new signature is added
+// to them. The immutable reference to the signature manifest is returned.
+func Sign(ctx context.Context, ref name.Digest, signer Signer, keychain authn.Keychain) (string, error) {
+	logger := log.FromContext(ctx)
+
+	payload, err := Payload(ref)
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := signer.Sign(ctx, payload)
+	if err != nil {
+		return "", err
+	}
+
+	options := []remote.Option{remote.WithContext(ctx), remote.WithAuthFromKeychain(keychain)}
+	tag := ref.Context().Tag(fmt.Sprintf("%s.sig", strings.Replace(ref.DigestStr(), ":", "-", 1)))
+
+	signatures, err := existingSignatures(tag, options)
+	if err != nil {
+		return "", err
+	}
+
+	signatures, err = mutate.Append(signatures, mutate.Addendum{
+		Layer:       static.NewLayer(payload, kPayloadMediaType),
+		Annotations: signature.annotations(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	logger.Info("Pushing the signature", "image", ref.String(), "tag", tag.String())
+	if err := remote.Write(tag, signatures, options...); err != nil {
+		return "", err
+	}
+
+	digest, err := signatures.Digest()
+	if err != nil {
+		return "", err
+	}
+
+	return ref.Context().Digest(digest.String()).String(), nil
+}
+
+func existingSignatures(tag name.Tag, options []remote.Option) (gcr.Image, error) {
+	image, err := remote.Image(tag, options...)
+
+	var terr *transport.Error
+	if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+		image = mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+		return mutate.ConfigMediaType(image, types.OCIConfigJSON), nil
+	}
+
+	return image, err
+}
+
+// Payload returns the simple signing payload cosign signs for the image.
+func Payload(ref name.Digest) ([]byte, error) {
+	var payload struct {
+		Critical struct {
+			Identity struct {
+				DockerReference string `json:"docker-reference"`
+			} `json:"identity"`
+			Image struct {
+				DockerManifestDigest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+			Type string `json:"type"`
+		} `json:"critical"`
+		Optional map[string]any `json:"optional"`
+	}
+
+	payload.Critical.Identity.DockerReference = ref.Context().String()
+	payload.Critical.Image.DockerManifestDigest = ref.DigestStr()
+	payload.Critical.Type = kSignatureType
+
+	return json.Marshal(payload)
+}
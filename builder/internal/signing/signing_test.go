@@ -0,0 +1,151 @@
+package signing
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypt the key the way `cosign generate-key-pair` does.
+func encryptKey(key *ecdsa.PrivateKey, password []byte) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+
+	salt := make([]byte, 32)
+	_, err = rand.Read(salt)
+	Expect(err).NotTo(HaveOccurred())
+
+	var nonce [24]byte
+	_, err = rand.Read(nonce[:])
+	Expect(err).NotTo(HaveOccurred())
+
+	derived, err := scrypt.Key(password, salt, 32768, 8, 1, 32)
+	Expect(err).NotTo(HaveOccurred())
+	var secret [32]byte
+	copy(secret[:], derived)
+
+	data, err := json.Marshal(map[string]any{
+		"kdf":        map[string]any{"name": "scrypt", "params": map[string]int{"N": 32768, "r": 8, "p": 1}, "salt": salt},
+		"cipher":     map[string]any{"name": "nacl/secretbox", "nonce": nonce[:]},
+		"ciphertext": secretbox.Seal(nil, der, &nonce, &secret),
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED SIGSTORE PRIVATE KEY", Bytes: data})
+}
+
+// Push a random image to a new registry and return its reference.
+func pushRandomImage() name.Digest {
+	server := httptest.NewServer(registry.New())
+	DeferCleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	Expect(err).NotTo(HaveOccurred())
+
+	image, err := random.Image(64, 1)
+	Expect(err).NotTo(HaveOccurred())
+	digest, err := image.Digest()
+	Expect(err).NotTo(HaveOccurred())
+
+	ref, err := name.NewDigest(u.Host + "/spot/app@" + digest.String())
+	Expect(err).NotTo(HaveOccurred())
+	Expect(remote.Write(ref, image)).To(Succeed())
+
+	return ref
+}
+
+var _ = Describe("Signing", func() {
+	var key *ecdsa.PrivateKey
+	var ref name.Digest
+
+	BeforeEach(func() {
+		var err error
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		ref = pushRandomImage()
+	})
+
+	Context("KeySigner", func() {
+		It("decrypts the keys generated by cosign", func() {
+			signer, err := NewKeySigner(encryptKey(key, []byte("secret")), []byte("secret"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(signer.Public()).To(Equal(key.Public()))
+
+			_, err = NewKeySigner(encryptKey(key, []byte("secret")), []byte("wrong"))
+			Expect(err).To(MatchError(ErrKeyPasswordInvalid))
+		})
+
+		It("reads unencrypted keys", func() {
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+			Expect(err).NotTo(HaveOccurred())
+
+			signer, err := NewKeySigner(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(signer.Public()).To(Equal(key.Public()))
+
+			_, err = NewKeySigner([]byte("not a key"), nil)
+			Expect(err).To(MatchError(ErrKeyInvalid))
+		})
+	})
+
+	It("pushes the signature next to the image", func() {
+		signer, err := NewKeySigner(encryptKey(key, []byte("")), []byte(""))
+		Expect(err).NotTo(HaveOccurred())
+
+		signature, err := Sign(context.TODO(), ref, signer, authn.DefaultKeychain)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signature).To(HavePrefix(ref.Context().String() + "@sha256:"))
+
+		tag := ref.Context().Tag("sha256-" + ref.DigestStr()[len("sha256:"):] + ".sig")
+		image, err := remote.Image(tag)
+		Expect(err).NotTo(HaveOccurred())
+
+		manifest, err := image.Manifest()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.Layers).To(HaveLen(1))
+		Expect(string(manifest.Layers[0].MediaType)).To(Equal("application/vnd.dev.cosign.simplesigning.v1+json"))
+
+		layers, err := image.Layers()
+		Expect(err).NotTo(HaveOccurred())
+		reader, err := layers[0].Uncompressed()
+		Expect(err).NotTo(HaveOccurred())
+		payload, err := io.ReadAll(reader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(payload)).To(ContainSubstring(`"docker-manifest-digest":"` + ref.DigestStr() + `"`))
+		Expect(string(payload)).To(ContainSubstring(`"docker-reference":"` + ref.Context().String() + `"`))
+
+		raw, err := base64.StdEncoding.DecodeString(manifest.Layers[0].Annotations["dev.cosignproject.cosign/signature"])
+		Expect(err).NotTo(HaveOccurred())
+		digest := sha256.Sum256(payload)
+		Expect(ecdsa.VerifyASN1(&key.PublicKey, digest[:], raw)).To(BeTrue())
+
+		// Signing again keeps the previous signature.
+		_, err = Sign(context.TODO(), ref, signer, authn.DefaultKeychain)
+		Expect(err).NotTo(HaveOccurred())
+
+		image, err = remote.Image(tag)
+		Expect(err).NotTo(HaveOccurred())
+		manifest, err = image.Manifest()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.Layers).To(HaveLen(2))
+	})
+})
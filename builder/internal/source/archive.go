@@ -0,0 +1,107 @@
+package source
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"syscall"
+)
+
+var ErrFileOutsideSource = errors.New("file needs to be located within the source")
+
+// Extract the tar archive in the directory of the source. The archive can be gzip compressed, in which
+// case it's decompressed on the fly. Entries can't escape the directory, either with their name or by
+// going through or replacing a symlink extracted before them. Only directories, regular files and symlinks
+// are extracted.
+func (d *directory) extract(r io.Reader) error {
+	reader := bufio.NewReader(r)
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+
+		r = gz
+	} else {
+		r = reader
+	}
+
+	symlinks := map[string]bool{}
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		name, err := d.file(header.Name)
+		if err != nil {
+			// The root of the archive is usually stored as `./`, it's the directory itself.
+			if path.Clean(header.Name) == "." {
+				continue
+			}
+			return err
+		}
+
+		for parent := path.Dir(name); parent != d.path; parent = path.Dir(parent) {
+			if symlinks[parent] {
+				return fmt.Errorf("%w: %s goes through a symlink", ErrFileOutsideSource, header.Name)
+			}
+		}
+
+		// An entry could also replace a symlink extracted before it, writing to wherever the symlink points to.
+		if info, err := os.Lstat(name); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %s overwrites a symlink", ErrFileOutsideSource, header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(name, 0755); err != nil {
+				return err
+			}
+
+		case tar.TypeReg:
+			if err := writeFile(name, archive, os.FileMode(header.Mode).Perm()); err != nil {
+				return err
+			}
+
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(path.Dir(name), 0755); err != nil {
+				return err
+			}
+
+			if err := os.Symlink(header.Linkname, name); err != nil {
+				return err
+			}
+			symlinks[name] = true
+		}
+	}
+}
+
+func writeFile(name string, content io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(path.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|syscall.O_NOFOLLOW, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, content); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -1,42 +1,77 @@
 package source
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
-	"io"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/releasehub-com/spot/builder/internal/credentials"
 )
 
-var ErrSecretNotFound = errors.New("Secret not found")
+var ErrKnownHostsMissing = errors.New("SSH credentials require known_hosts to verify the host")
 
-type Secrets []Secret
-type Secret struct {
-	Host        string `json:"host"`
-	AccessKey   string `json:"access_key"`
-	SecretToken string `json:"secret_token"`
-}
+// Returns the auth method to clone the repository at the given URL. Repositories without
+// credentials are cloned anonymously, which is what public repositories need.
+func authMethod(ctx context.Context, creds credentials.Credentials, url string) (transport.AuthMethod, error) {
+	credential, err := creds.ForHost(url)
+	if errors.Is(err, credentials.ErrCredentialNotFound) {
+		return nil, nil
+	}
 
-func SecretsFromReader(r io.Reader) (Secrets, error) {
-	var secrets Secrets
-	decoder := json.NewDecoder(r)
-	if err := decoder.Decode(&secrets); err != nil {
+	if err != nil {
 		return nil, err
 	}
 
-	return secrets, nil
-}
+	switch credential.Type {
+	case credentials.TypeSSH:
+		keys, err := gitssh.NewPublicKeys(sshUser(url), credential.PrivateKey, "")
+		if err != nil {
+			return nil, err
+		}
+
+		// Never skip the host verification, a deploy key would otherwise be
+		// handed to whoever answers for the host.
+		if _, err := os.Stat(credential.KnownHostsPath); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrKnownHostsMissing, err)
+		}
 
-func (s Secrets) SecretForHost(host string) (*Secret, error) {
-	var secret *Secret
-	for _, sct := range s {
-		if sct.Host == host {
-			secret = &sct
-			break
+		keys.HostKeyCallback, err = gitssh.NewKnownHostsCallback(credential.KnownHostsPath)
+		if err != nil {
+			return nil, err
 		}
+
+		return keys, nil
+
+	case credentials.TypeGitHubApp:
+		token, err := credentials.GitHubAppToken(ctx, http.DefaultClient, credentials.GitHubAPIURL(url), credential)
+		if err != nil {
+			return nil, err
+		}
+
+		return &githttp.BasicAuth{
+			Username: credentials.GitHubAppUsername,
+			Password: token,
+		}, nil
+
+	default:
+		return &githttp.BasicAuth{
+			Username: credential.Username,
+			Password: credential.Password,
+		}, nil
 	}
+}
 
-	if secret == nil {
-		return nil, ErrSecretNotFound
+// The user is part of SSH URLs (ie. git@github.com:org/repo.git), git is used
+// when the URL doesn't specify one as it's what most git hosts expect.
+func sshUser(url string) string {
+	if endpoint, err := transport.NewEndpoint(url); err == nil && endpoint.User != "" {
+		return endpoint.User
 	}
 
-	return secret, nil
+	return gitssh.DefaultUsername
 }
@@ -0,0 +1,90 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var ErrConfigMapKeyMissing = errors.New("ConfigMap doesn't have the key")
+
+type ConfigMapOpts struct {
+	BuildContext string
+
+	// Path to the Dockerfile relative to the root of the ConfigMap's files.
+	// If empty, the Dockerfile is expected to be at the root of the BuildContext.
+	Dockerfile string
+
+	Namespace string
+	Name      string
+
+	// Items maps the keys to the paths of their file. When empty, every
+	// key is written to a file of the same name.
+	Items []core.KeyToPath
+
+	Client kubernetes.Interface
+}
+
+// ConfigMap writes the keys of the ConfigMap as files, both the data and the binary data are used.
+//
+// The Ref of the source is the ConfigMap's name and resource version, which changes
+// every time the ConfigMap is updated.
+func ConfigMap(ctx context.Context, opts ConfigMapOpts) (Source, error) {
+	logger := log.FromContext(ctx)
+	dir, err := newDirectory(opts.BuildContext, opts.Dockerfile)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Retrieving ConfigMap", "namespace", opts.Namespace, "name", opts.Name)
+	configMap, err := opts.Client.CoreV1().ConfigMaps(opts.Namespace).Get(ctx, opts.Name, meta.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string][]byte{}
+	for key, value := range configMap.Data {
+		values[key] = []byte(value)
+	}
+	for key, value := range configMap.BinaryData {
+		values[key] = value
+	}
+
+	items := opts.Items
+	if len(items) == 0 {
+		for key := range values {
+			items = append(items, core.KeyToPath{Key: key, Path: key})
+		}
+	}
+
+	for _, item := range items {
+		value, ok := values[item.Key]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrConfigMapKeyMissing, item.Key)
+		}
+
+		file, err := dir.file(item.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		mode := os.FileMode(0644)
+		if item.Mode != nil {
+			mode = os.FileMode(*item.Mode).Perm()
+		}
+
+		if err := writeFile(file, bytes.NewReader(value), mode); err != nil {
+			return nil, err
+		}
+	}
+
+	dir.ref = fmt.Sprintf("%s@%s", configMap.Name, configMap.ResourceVersion)
+	return &dir, nil
+}
@@ -0,0 +1,62 @@
+package source
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("ConfigMap", func() {
+	clientset := func() *fake.Clientset {
+		return fake.NewSimpleClientset(&core.ConfigMap{
+			ObjectMeta: meta.ObjectMeta{Namespace: "spot", Name: "source", ResourceVersion: "42"},
+			Data:       map[string]string{"Dockerfile": "FROM alpine\n", "main.go": "package main\n"},
+			BinaryData: map[string][]byte{"logo.png": {0x89, 0x50, 0x4e, 0x47}},
+		})
+	}
+
+	It("writes every key to a file of the same name", func() {
+		src, err := ConfigMap(context.Background(), ConfigMapOpts{
+			Namespace: "spot",
+			Name:      "source",
+			Client:    clientset(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(src.Dockerfile()).To(BeARegularFile())
+		Expect(src.BuildContext() + "/logo.png").To(BeARegularFile())
+		Expect(src.Ref()).To(Equal("source@42"))
+	})
+
+	It("writes the items to their path", func() {
+		src, err := ConfigMap(context.Background(), ConfigMapOpts{
+			BuildContext: "app",
+			Namespace:    "spot",
+			Name:         "source",
+			Items: []core.KeyToPath{
+				{Key: "Dockerfile", Path: "app/Dockerfile"},
+				{Key: "main.go", Path: "app/cmd/main.go"},
+			},
+			Client: clientset(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(src.Dockerfile()).To(BeARegularFile())
+		Expect(src.BuildContext() + "/cmd/main.go").To(BeARegularFile())
+		Expect(src.Path() + "/logo.png").NotTo(BeAnExistingFile())
+	})
+
+	It("fails when an item's key doesn't exist", func() {
+		_, err := ConfigMap(context.Background(), ConfigMapOpts{
+			Namespace: "spot",
+			Name:      "source",
+			Items:     []core.KeyToPath{{Key: "Gemfile", Path: "Gemfile"}},
+			Client:    clientset(),
+		})
+		Expect(err).To(MatchError(ErrConfigMapKeyMissing))
+	})
+})
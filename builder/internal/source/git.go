@@ -2,19 +2,33 @@ package source
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/releasehub-com/spot/builder/internal/credentials"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+var ErrReferenceMissing = errors.New("reference requires a name or a hash")
+var ErrReferenceNotFound = errors.New("reference doesn't exist on the remote")
+var ErrCommitNotFound = errors.New("commit doesn't exist on the remote")
+
+// File listing the submodules at the root of the repository.
+const kGitModules = ".gitmodules"
+
 type Repository struct {
-	buildContext string
-	path         string
+	directory
 	*git.Repository
 }
 
@@ -22,14 +36,33 @@ type RepositoryOpts struct {
 	BuildContext string
 	Host         string
 
+	// Path to the Dockerfile relative to the root of the repository.
+	// If empty, the Dockerfile is expected to be at the root of the BuildContext.
+	Dockerfile string
+
+	// Reference to check out. The name can be a branch, a tag or any full reference
+	// name and can be empty when the hash is set. When the hash is zero, the
+	// commit the name points to is checked out.
 	Reference *plumbing.Reference
 
-	Secrets Secrets
+	Credentials credentials.Credentials
+
+	// Depth of the history to fetch, zero fetches the whole history of the reference.
+	Depth int
+
+	// SparseCheckout limits the checkout to the build context and the Dockerfile's directory.
+	SparseCheckout bool
+
+	// Submodules are checked out recursively when enabled.
+	Submodules bool
+
+	// LFS objects are downloaded for the files checked out when enabled.
+	LFS bool
 }
 
 // Git returns a fully configured Repository that can be used to build
 // an image. If the repository is private, the proper credentials needs to
-// be included as part of RepositoryOpts.
+// be included as part of RepositoryOpts, otherwise the repository is cloned anonymously.
 //
 // The Repository will be checked out using the Reference passed in the
 // RepositoryOpts
@@ -37,35 +70,32 @@ func Git(ctx context.Context, opts RepositoryOpts) (*Repository, error) {
 	var err error
 
 	logger := log.FromContext(ctx)
-	secret, err := opts.Secrets.SecretForHost(opts.Host)
+	auth, err := authMethod(ctx, opts.Credentials, opts.Host)
 	if err != nil {
 		return nil, err
 	}
 
-	logger.Info("Cloning Git Repository with options", "options", opts)
+	logger.Info("Cloning Git Repository", "host", opts.Host, "reference", opts.Reference, "anonymous", auth == nil)
 
-	auth := &http.BasicAuth{
-		Username: secret.AccessKey,
-		Password: secret.SecretToken,
-	}
-
-	repo := &Repository{
-		buildContext: opts.BuildContext,
-		path:         fmt.Sprintf("%s/src", os.TempDir()),
+	repo := &Repository{}
+	if repo.directory, err = newDirectory(opts.BuildContext, opts.Dockerfile); err != nil {
+		return nil, err
 	}
 
-	if err := os.MkdirAll(repo.path, os.ModePerm); err != nil {
+	repo.Repository, err = git.PlainInit(repo.path, false)
+	if err != nil {
 		return nil, err
 	}
 
-	repo.Repository, err = git.PlainClone(repo.path, false, &git.CloneOptions{
-		URL:           opts.Host,
-		SingleBranch:  true,
-		ReferenceName: opts.Reference.Name(),
-		Auth:          auth,
-		NoCheckout:    true,
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{opts.Host},
 	})
+	if err != nil {
+		return nil, err
+	}
 
+	hash, err := repo.fetch(ctx, opts, auth)
 	if err != nil {
 		return nil, err
 	}
@@ -75,27 +105,300 @@ func Git(ctx context.Context, opts RepositoryOpts) (*Repository, error) {
 		return nil, err
 	}
 
-	err = w.Checkout(&git.CheckoutOptions{
-		Hash: opts.Reference.Hash(),
+	if err := repo.checkout(w, hash, opts.SparseCheckout); err != nil {
+		return nil, err
+	}
+
+	if opts.Submodules {
+		if err := repo.updateSubmodules(ctx, w, opts.Credentials); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.LFS {
+		if err := fetchLFSObjects(ctx, repo.path, opts.Host, auth); err != nil {
+			return nil, err
+		}
+	}
+
+	return repo, nil
+}
+
+// Fetch the commit from the remote and return its hash. When the reference has a hash, the commit is
+// fetched directly which only transfers the objects needed for that commit. Not all servers allow fetching
+// a commit that isn't the tip of a reference, in which case the named reference is fetched instead, with its
+// whole history as the commit can be anywhere in it. A commit without a name falls back to fetching every
+// branch and tag. A reference without a hash builds the commit the reference points to.
+func (r *Repository) fetch(ctx context.Context, opts RepositoryOpts, auth transport.AuthMethod) (plumbing.Hash, error) {
+	logger := log.FromContext(ctx)
+	hash := opts.Reference.Hash()
+	name := opts.Reference.Name()
+
+	if hash.IsZero() && name == "" {
+		return hash, ErrReferenceMissing
+	}
+
+	if !hash.IsZero() {
+		err := r.fetchRefSpecs(ctx, auth, opts.Depth, config.RefSpec(fmt.Sprintf("%s:refs/spot/%s", hash, hash)))
+		if err == nil {
+			return hash, nil
+		}
+
+		logger.Info("Couldn't fetch the commit directly", "hash", hash.String(), "error", err.Error())
+	}
+
+	if name == "" {
+		err := r.fetchRefSpecs(ctx, auth, 0,
+			config.RefSpec(fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", git.DefaultRemoteName)),
+			config.RefSpec("+refs/tags/*:refs/tags/*"),
+		)
+		if err != nil {
+			return hash, err
+		}
+
+		if _, err := r.CommitObject(hash); err != nil {
+			return hash, fmt.Errorf("%w: %s", ErrCommitNotFound, hash)
+		}
+
+		return hash, nil
+	}
+
+	remoteName, err := r.resolveReferenceName(ctx, name, auth)
+	if err != nil {
+		return hash, err
+	}
+
+	depth := opts.Depth
+	if !hash.IsZero() {
+		depth = 0
+	}
+
+	logger.Info("Fetching reference", "name", remoteName.String())
+	if err := r.fetchRefSpecs(ctx, auth, depth, config.RefSpec(fmt.Sprintf("+%s:%s", remoteName, remoteName))); err != nil {
+		return hash, err
+	}
+
+	if hash.IsZero() {
+		// Annotated tags point to a tag object, resolving the revision peels it to the commit.
+		resolved, err := r.ResolveRevision(plumbing.Revision(remoteName))
+		if err != nil {
+			return hash, err
+		}
+
+		return *resolved, nil
+	}
+
+	if _, err := r.CommitObject(hash); err != nil {
+		return hash, fmt.Errorf("%w: %s in %s", ErrCommitNotFound, hash, remoteName)
+	}
+
+	return hash, nil
+}
+
+func (r *Repository) fetchRefSpecs(ctx context.Context, auth transport.AuthMethod, depth int, refspecs ...config.RefSpec) error {
+	err := r.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs:   refspecs,
+		Depth:      depth,
+		Auth:       auth,
+		Tags:       git.NoTags,
 	})
 
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return err
+	}
+
+	return nil
+}
+
+// Returns the full name of the reference on the remote. A full name (ie. refs/pull/123/head) is used
+// as is while a short name is looked up as a branch first, then as a tag, like git does.
+func (r *Repository) resolveReferenceName(ctx context.Context, name plumbing.ReferenceName, auth transport.AuthMethod) (plumbing.ReferenceName, error) {
+	if strings.HasPrefix(name.String(), "refs/") {
+		return name, nil
+	}
+
+	remote, err := r.Remote(git.DefaultRemoteName)
 	if err != nil {
-		return nil, err
+		return name, err
 	}
 
-	return repo, nil
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return name, err
+	}
+
+	for _, candidate := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName(name.String()), plumbing.NewTagReferenceName(name.String())} {
+		for _, ref := range refs {
+			if ref.Name() == candidate {
+				return candidate, nil
+			}
+		}
+	}
+
+	return name, fmt.Errorf("%w: %s", ErrReferenceNotFound, name)
+}
+
+// Checkout the commit in a detached HEAD. A sparse checkout writes the files of the directories
+// the build needs straight from the commit's tree. The index only has the submodules of those
+// directories, along with the .gitmodules file, it's what the submodules are updated from.
+func (r *Repository) checkout(w *git.Worktree, hash plumbing.Hash, sparse bool) error {
+	directories := []string{}
+	if sparse {
+		directories = r.sparseDirectories()
+	}
+
+	if len(directories) == 0 {
+		return w.Checkout(&git.CheckoutOptions{
+			Hash: hash,
+		})
+	}
+
+	err := w.Checkout(&git.CheckoutOptions{
+		Hash: hash,
+		Keep: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	commit, err := r.CommitObject(hash)
+	if err != nil {
+		return err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+
+	err = tree.Files().ForEach(func(file *object.File) error {
+		if file.Name != kGitModules && !inDirectories(file.Name, directories) {
+			return nil
+		}
+
+		return r.writeFile(file)
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.indexSubmodules(tree, directories)
+}
+
+// The submodules are commits in the tree, tree.Files() skips them.
+func (r *Repository) indexSubmodules(tree *object.Tree, directories []string) error {
+	idx := &index.Index{Version: 2}
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if entry.Mode != filemode.Submodule || !inDirectories(name, directories) {
+			continue
+		}
+
+		idx.Entries = append(idx.Entries, &index.Entry{
+			Name: name,
+			Hash: entry.Hash,
+			Mode: entry.Mode,
+		})
+	}
+
+	return r.Storer.SetIndex(idx)
 }
 
-// Path returns the temporary path where
-// the repository was cloned.
-func (r *Repository) Path() string {
-	return r.path
+func (r *Repository) writeFile(file *object.File) error {
+	name := path.Join(r.path, file.Name)
+	if err := os.MkdirAll(path.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	content, err := file.Contents()
+	if err != nil {
+		return err
+	}
+
+	if file.Mode == filemode.Symlink {
+		return os.Symlink(content, name)
+	}
+
+	mode, err := file.Mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(name, []byte(content), mode.Perm())
 }
 
-// BuildContext return the absolute path
-// to the context set by the user.
-func (r *Repository) BuildContext() string {
-	return path.Join(r.path, r.buildContext)
+func inDirectories(name string, directories []string) bool {
+	for _, dir := range directories {
+		if strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Directories, relative to the root of the repository, that the build needs.
+func (r *Repository) sparseDirectories() []string {
+	directories := []string{}
+	for _, dir := range []string{r.BuildContext(), path.Dir(r.Dockerfile())} {
+		relative := strings.TrimPrefix(strings.TrimPrefix(dir, r.path), "/")
+		if relative == "" {
+			// The root of the repository is needed, there's nothing to gain from a sparse checkout.
+			return nil
+		}
+		directories = append(directories, relative)
+	}
+
+	return directories
+}
+
+// Submodules can be hosted elsewhere than the repository, each of them
+// uses the credentials configured for its own host. The submodules that
+// aren't in the index were left out by a sparse checkout.
+func (r *Repository) updateSubmodules(ctx context.Context, w *git.Worktree, creds credentials.Credentials) error {
+	submodules, err := w.Submodules()
+	if err != nil {
+		return err
+	}
+
+	for _, submodule := range submodules {
+		status, err := submodule.Status()
+		if err != nil {
+			return err
+		}
+
+		if status.Expected.IsZero() {
+			continue
+		}
+
+		auth, err := authMethod(ctx, creds, submodule.Config().URL)
+		if err != nil {
+			return err
+		}
+
+		err = submodule.UpdateContext(ctx, &git.SubmoduleUpdateOptions{
+			Init:              true,
+			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+			Auth:              auth,
+		})
+		if err != nil {
+			return fmt.Errorf("submodule %s: %w", submodule.Config().Name, err)
+		}
+	}
+
+	return nil
 }
 
 // Ref returns the git reference(https://git-scm.com/book/en/v2/Git-Internals-Git-References)
@@ -0,0 +1,168 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Git", func() {
+	var remote string
+	var commits []plumbing.Hash
+
+	// Creates a repository with two commits on main, the first one being
+	// the commit that gets built.
+	BeforeEach(func() {
+		remote = GinkgoT().TempDir()
+		repo, err := git.PlainInit(remote, false)
+		Expect(err).NotTo(HaveOccurred())
+
+		w, err := repo.Worktree()
+		Expect(err).NotTo(HaveOccurred())
+
+		commits = nil
+		for i, file := range []string{"app/Dockerfile", "docs/README.md"} {
+			Expect(os.MkdirAll(path.Join(remote, path.Dir(file)), 0755)).To(Succeed())
+			Expect(os.WriteFile(path.Join(remote, file), []byte("FROM alpine\n"), 0644)).To(Succeed())
+			_, err = w.Add(file)
+			Expect(err).NotTo(HaveOccurred())
+
+			hash, err := w.Commit(file, &git.CommitOptions{Author: &object.Signature{
+				Name: "spot", Email: "spot@release.com", When: time.Now().Add(time.Duration(i) * time.Second),
+			}})
+			Expect(err).NotTo(HaveOccurred())
+			commits = append(commits, hash)
+		}
+
+		head, err := repo.Head()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("main"), head.Hash()))).To(Succeed())
+		Expect(repo.Storer.SetReference(plumbing.NewHashReference("refs/pull/123/head", commits[0]))).To(Succeed())
+
+		_, err = repo.CreateTag("v1.0.0", commits[0], &git.CreateTagOptions{
+			Message: "v1.0.0",
+			Tagger:  &object.Signature{Name: "spot", Email: "spot@release.com", When: time.Now()},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("checks out the commit, falling back to the branch when the commit can't be fetched directly", func() {
+		repo, err := Git(context.Background(), RepositoryOpts{
+			Host:         remote,
+			BuildContext: "app",
+			Reference:    plumbing.NewHashReference(plumbing.NewBranchReferenceName("main"), commits[0]),
+			Depth:        1,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(repo.Ref()).To(Equal(commits[0].String()))
+		Expect(repo.Dockerfile()).To(BeARegularFile())
+		Expect(path.Join(repo.Path(), "docs/README.md")).NotTo(BeAnExistingFile())
+	})
+
+	It("only checks out the build context with a sparse checkout", func() {
+		repo, err := Git(context.Background(), RepositoryOpts{
+			Host:           remote,
+			BuildContext:   "app",
+			Reference:      plumbing.NewHashReference(plumbing.NewBranchReferenceName("main"), commits[1]),
+			SparseCheckout: true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(repo.Dockerfile()).To(BeARegularFile())
+		Expect(path.Join(repo.Path(), "docs/README.md")).NotTo(BeAnExistingFile())
+	})
+
+	It("updates the submodules of the build context with a sparse checkout", func() {
+		lib := GinkgoT().TempDir()
+		libRepo, err := git.PlainInit(lib, false)
+		Expect(err).NotTo(HaveOccurred())
+		libTree, err := libRepo.Worktree()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(path.Join(lib, "lib.go"), []byte("package lib\n"), 0644)).To(Succeed())
+		_, err = libTree.Add("lib.go")
+		Expect(err).NotTo(HaveOccurred())
+		libCommit, err := libTree.Commit("lib", &git.CommitOptions{Author: &object.Signature{Name: "spot", Email: "spot@release.com", When: time.Now()}})
+		Expect(err).NotTo(HaveOccurred())
+
+		// The submodule of the build context and one outside of it, which points to a
+		// commit that doesn't exist and would fail the build if it was updated.
+		repo, err := git.PlainOpen(remote)
+		Expect(err).NotTo(HaveOccurred())
+		w, err := repo.Worktree()
+		Expect(err).NotTo(HaveOccurred())
+		modules := fmt.Sprintf("[submodule \"lib\"]\n\tpath = app/lib\n\turl = %s\n[submodule \"docs\"]\n\tpath = docs/lib\n\turl = %s\n", lib, lib)
+		Expect(os.WriteFile(path.Join(remote, ".gitmodules"), []byte(modules), 0644)).To(Succeed())
+		_, err = w.Add(".gitmodules")
+		Expect(err).NotTo(HaveOccurred())
+
+		idx, err := repo.Storer.Index()
+		Expect(err).NotTo(HaveOccurred())
+		idx.Entries = append(idx.Entries,
+			&index.Entry{Name: "app/lib", Hash: libCommit, Mode: filemode.Submodule},
+			&index.Entry{Name: "docs/lib", Hash: plumbing.NewHash("0123456789012345678901234567890123456789"), Mode: filemode.Submodule},
+		)
+		Expect(repo.Storer.SetIndex(idx)).To(Succeed())
+		commit, err := w.Commit("submodules", &git.CommitOptions{Author: &object.Signature{
+			Name: "spot", Email: "spot@release.com", When: time.Now().Add(time.Minute),
+		}})
+		Expect(err).NotTo(HaveOccurred())
+
+		checkout, err := Git(context.Background(), RepositoryOpts{
+			Host:           remote,
+			BuildContext:   "app",
+			Reference:      plumbing.NewHashReference("", commit),
+			SparseCheckout: true,
+			Submodules:     true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(path.Join(checkout.Path(), "app/lib/lib.go")).To(BeARegularFile())
+		Expect(path.Join(checkout.Path(), "docs/lib")).NotTo(BeAnExistingFile())
+	})
+
+	DescribeTable("resolves the commit from the reference",
+		func(name plumbing.ReferenceName, commit func() plumbing.Hash) {
+			repo, err := Git(context.Background(), RepositoryOpts{
+				Host:         remote,
+				BuildContext: "app",
+				Reference:    plumbing.NewHashReference(name, plumbing.ZeroHash),
+				Depth:        1,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(repo.Ref()).To(Equal(commit().String()))
+		},
+		Entry("a branch by its short name", plumbing.ReferenceName("main"), func() plumbing.Hash { return commits[1] }),
+		Entry("an annotated tag", plumbing.ReferenceName("v1.0.0"), func() plumbing.Hash { return commits[0] }),
+		Entry("a pull request", plumbing.ReferenceName("refs/pull/123/head"), func() plumbing.Hash { return commits[0] }),
+	)
+
+	It("checks out a commit without a reference name", func() {
+		repo, err := Git(context.Background(), RepositoryOpts{
+			Host:         remote,
+			BuildContext: "app",
+			Reference:    plumbing.NewHashReference("", commits[0]),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repo.Ref()).To(Equal(commits[0].String()))
+	})
+
+	It("fails when the reference doesn't exist", func() {
+		_, err := Git(context.Background(), RepositoryOpts{
+			Host:         remote,
+			BuildContext: "app",
+			Reference:    plumbing.NewHashReference("feature", plumbing.ZeroHash),
+		})
+		Expect(err).To(MatchError(ErrReferenceNotFound))
+	})
+})
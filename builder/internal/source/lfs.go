@@ -0,0 +1,346 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var ErrLFSUnsupportedTransport = errors.New("LFS objects can only be fetched for repositories cloned over HTTP(S)")
+var ErrLFSObjectFailed = errors.New("couldn't download LFS object")
+
+const (
+	// First line of every LFS pointer file.
+	kLFSPointerVersion = "version https://git-lfs.github.com/spec/v1"
+
+	// Pointer files are small, anything bigger can't be a pointer.
+	kLFSPointerMaxSize = 1024
+
+	kLFSMediaType = "application/vnd.git-lfs+json"
+
+	// Servers aren't required to accept more objects in a single batch request.
+	kLFSBatchSize = 100
+)
+
+type lfsPointer struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+
+	// Files pointing at this object.
+	paths []string
+}
+
+type lfsBatchResponse struct {
+	Objects []struct {
+		Oid     string `json:"oid"`
+		Actions struct {
+			Download *struct {
+				Href   string            `json:"href"`
+				Header map[string]string `json:"header"`
+			} `json:"download"`
+		} `json:"actions"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"objects"`
+}
+
+// Replace the LFS pointer files checked out in the directory by the content they point to. The
+// objects are downloaded through the LFS batch API of the repository's server.
+func fetchLFSObjects(ctx context.Context, dir, url string, auth transport.AuthMethod) error {
+	return fetchLFSObjectsWithClient(ctx, http.DefaultClient, dir, url, auth)
+}
+
+func fetchLFSObjectsWithClient(ctx context.Context, client *http.Client, dir, url string, auth transport.AuthMethod) error {
+	logger := log.FromContext(ctx)
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return ErrLFSUnsupportedTransport
+	}
+
+	pointers, err := findLFSPointers(dir)
+	if err != nil || len(pointers) == 0 {
+		return err
+	}
+
+	logger.Info("Fetching LFS objects", "count", len(pointers))
+
+	var objects []*lfsPointer
+	for _, pointer := range pointers {
+		objects = append(objects, pointer)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Oid < objects[j].Oid })
+
+	endpoint := strings.TrimSuffix(url, "/")
+	if !strings.HasSuffix(endpoint, ".git") {
+		endpoint += ".git"
+	}
+
+	for start := 0; start < len(objects); start += kLFSBatchSize {
+		end := start + kLFSBatchSize
+		if end > len(objects) {
+			end = len(objects)
+		}
+
+		if err := fetchLFSBatch(ctx, client, endpoint, auth, pointers, objects[start:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Request the download actions of the objects from the batch API and download each of them.
+func fetchLFSBatch(ctx context.Context, client *http.Client, endpoint string, auth transport.AuthMethod, pointers map[string]*lfsPointer, objects []*lfsPointer) error {
+	body, err := json.Marshal(map[string]any{
+		"operation": "download",
+		"transfers": []string{"basic"},
+		"objects":   objects,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/info/lfs/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", kLFSMediaType)
+	req.Header.Set("Content-Type", kLFSMediaType)
+	if basic, ok := auth.(*githttp.BasicAuth); ok {
+		req.SetBasicAuth(basic.Username, basic.Password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: batch request returned %s", ErrLFSObjectFailed, resp.Status)
+	}
+
+	var batch lfsBatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		return err
+	}
+
+	for _, object := range batch.Objects {
+		pointer, ok := pointers[object.Oid]
+		if !ok {
+			continue
+		}
+
+		if object.Error != nil {
+			return fmt.Errorf("%w: %s: %s", ErrLFSObjectFailed, object.Oid, object.Error.Message)
+		}
+
+		if object.Actions.Download == nil {
+			return fmt.Errorf("%w: %s: no download action", ErrLFSObjectFailed, object.Oid)
+		}
+
+		if err := downloadLFSObject(ctx, client, pointer, object.Actions.Download.Href, object.Actions.Download.Header); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Download the object and write it in place of every pointer file referencing it. The
+// content is verified against the pointer before any file is replaced. Objects can be
+// large, the content is streamed to a temporary file that replaces the first pointer
+// and is copied over the others.
+func downloadLFSObject(ctx context.Context, client *http.Client, pointer *lfsPointer, href string, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, href, nil)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned %s", ErrLFSObjectFailed, pointer.Oid, resp.Status)
+	}
+
+	first := pointer.paths[0]
+	tmp, err := os.CreateTemp(filepath.Dir(first), ".lfs-"+pointer.Oid)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	digest := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, digest), io.LimitReader(resp.Body, pointer.Size+1))
+	if err != nil {
+		return err
+	}
+
+	if size != pointer.Size || hex.EncodeToString(digest.Sum(nil)) != pointer.Oid {
+		return fmt.Errorf("%w: %s doesn't match its pointer", ErrLFSObjectFailed, pointer.Oid)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := replaceFile(tmp.Name(), first); err != nil {
+		return err
+	}
+
+	for _, path := range pointer.paths[1:] {
+		if err := copyFile(first, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rename the file over the destination, keeping the destination's permissions.
+func replaceFile(source, destination string) error {
+	info, err := os.Stat(destination)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(source, info.Mode()); err != nil {
+		return err
+	}
+
+	return os.Rename(source, destination)
+}
+
+func copyFile(source, destination string) error {
+	info, err := os.Stat(destination)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(destination, os.O_WRONLY|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+
+	return dst.Close()
+}
+
+// Walk the checked out files and return the LFS pointers, indexed by their oid.
+func findLFSPointers(dir string) (map[string]*lfsPointer, error) {
+	pointers := map[string]*lfsPointer{}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.Size() > kLFSPointerMaxSize {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		pointer, ok := parseLFSPointer(data)
+		if !ok {
+			return nil
+		}
+
+		if existing, ok := pointers[pointer.Oid]; ok {
+			pointer = existing
+		}
+		pointer.paths = append(pointer.paths, path)
+		pointers[pointer.Oid] = pointer
+
+		return nil
+	})
+
+	return pointers, err
+}
+
+// Parse a pointer file, as described in https://github.com/git-lfs/git-lfs/blob/main/docs/spec.md
+func parseLFSPointer(data []byte) (*lfsPointer, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	if !scanner.Scan() || scanner.Text() != kLFSPointerVersion {
+		return nil, false
+	}
+
+	pointer := &lfsPointer{}
+	sized := false
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), " ")
+		if !found {
+			return nil, false
+		}
+
+		switch key {
+		case "oid":
+			if !strings.HasPrefix(value, "sha256:") {
+				return nil, false
+			}
+			pointer.Oid = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, false
+			}
+			pointer.Size = size
+			sized = true
+		}
+	}
+
+	// Both the oid and the size are required.
+	return pointer, pointer.Oid != "" && sized && pointer.Size >= 0
+}
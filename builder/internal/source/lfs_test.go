@@ -0,0 +1,157 @@
+package source
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LFS", func() {
+	content := []byte("a very large binary file")
+	digest := sha256.Sum256(content)
+	oid := hex.EncodeToString(digest[:])
+	pointer := fmt.Sprintf("%s\noid sha256:%s\nsize %d\n", kLFSPointerVersion, oid, len(content))
+
+	It("parses pointer files", func() {
+		parsed, ok := parseLFSPointer([]byte(pointer))
+		Expect(ok).To(BeTrue())
+		Expect(parsed.Oid).To(Equal(oid))
+		Expect(parsed.Size).To(Equal(int64(len(content))))
+
+		_, ok = parseLFSPointer([]byte("FROM alpine\n"))
+		Expect(ok).To(BeFalse())
+
+		_, ok = parseLFSPointer([]byte(fmt.Sprintf("%s\noid sha256:%s\n", kLFSPointerVersion, oid)))
+		Expect(ok).To(BeFalse())
+	})
+
+	It("replaces pointer files with the objects from the batch API", func() {
+		dir := GinkgoT().TempDir()
+		Expect(os.MkdirAll(path.Join(dir, "assets"), 0755)).To(Succeed())
+		Expect(os.WriteFile(path.Join(dir, "assets", "model.bin"), []byte(pointer), 0644)).To(Succeed())
+		Expect(os.WriteFile(path.Join(dir, "Dockerfile"), []byte("FROM alpine\n"), 0644)).To(Succeed())
+
+		var server *httptest.Server
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			switch r.URL.Path {
+			case "/spot/app.git/info/lfs/objects/batch":
+				username, password, _ := r.BasicAuth()
+				Expect(username).To(Equal("spot"))
+				Expect(password).To(Equal("s3cr3t"))
+
+				json.NewEncoder(w).Encode(map[string]any{
+					"objects": []map[string]any{{
+						"oid": oid,
+						"actions": map[string]any{
+							"download": map[string]any{
+								"href":   server.URL + "/objects/" + oid,
+								"header": map[string]string{"X-Token": "download"},
+							},
+						},
+					}},
+				})
+			case "/objects/" + oid:
+				Expect(r.Header.Get("X-Token")).To(Equal("download"))
+				w.Write(content)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		auth := &githttp.BasicAuth{Username: "spot", Password: "s3cr3t"}
+		Expect(fetchLFSObjectsWithClient(context.Background(), server.Client(), dir, server.URL+"/spot/app", auth)).To(Succeed())
+
+		Expect(os.ReadFile(path.Join(dir, "assets", "model.bin"))).To(Equal(content))
+		Expect(os.ReadFile(path.Join(dir, "Dockerfile"))).To(Equal([]byte("FROM alpine\n")))
+	})
+
+	It("requests the objects in batches", func() {
+		dir := GinkgoT().TempDir()
+		contents := map[string][]byte{}
+		for i := 0; i < 2*kLFSBatchSize+1; i++ {
+			content := []byte(fmt.Sprintf("object %d", i))
+			digest := sha256.Sum256(content)
+			oid := hex.EncodeToString(digest[:])
+			contents[oid] = content
+
+			pointer := fmt.Sprintf("%s\noid sha256:%s\nsize %d\n", kLFSPointerVersion, oid, len(content))
+			Expect(os.WriteFile(path.Join(dir, fmt.Sprint(i)), []byte(pointer), 0644)).To(Succeed())
+		}
+		Expect(os.WriteFile(path.Join(dir, "copy"), []byte(pointer), 0644)).To(Succeed())
+		Expect(os.WriteFile(path.Join(dir, "original"), []byte(pointer), 0644)).To(Succeed())
+		contents[oid] = content
+
+		var batches []int
+		var server *httptest.Server
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			if r.Method == http.MethodGet {
+				w.Write(contents[path.Base(r.URL.Path)])
+				return
+			}
+
+			var request struct {
+				Objects []lfsPointer `json:"objects"`
+			}
+			Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+			batches = append(batches, len(request.Objects))
+
+			var objects []map[string]any
+			for _, object := range request.Objects {
+				objects = append(objects, map[string]any{
+					"oid":     object.Oid,
+					"actions": map[string]any{"download": map[string]any{"href": server.URL + "/objects/" + object.Oid}},
+				})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"objects": objects})
+		}))
+		defer server.Close()
+
+		Expect(fetchLFSObjectsWithClient(context.Background(), server.Client(), dir, server.URL+"/spot/app", nil)).To(Succeed())
+
+		Expect(batches).To(Equal([]int{kLFSBatchSize, kLFSBatchSize, 2}))
+		Expect(os.ReadFile(path.Join(dir, "0"))).To(Equal([]byte("object 0")))
+		Expect(os.ReadFile(path.Join(dir, "copy"))).To(Equal(content))
+		Expect(os.ReadFile(path.Join(dir, "original"))).To(Equal(content))
+
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2*kLFSBatchSize + 3))
+	})
+
+	It("rejects objects that don't match their pointer", func() {
+		dir := GinkgoT().TempDir()
+		Expect(os.WriteFile(path.Join(dir, "model.bin"), []byte(pointer), 0644)).To(Succeed())
+
+		var server *httptest.Server
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost {
+				fmt.Fprintf(w, `{"objects": [{"oid": %q, "actions": {"download": {"href": %q}}}]}`, oid, server.URL+"/object")
+				return
+			}
+			w.Write([]byte("tampered"))
+		}))
+		defer server.Close()
+
+		err := fetchLFSObjectsWithClient(context.Background(), server.Client(), dir, server.URL+"/spot/app.git", nil)
+		Expect(err).To(MatchError(ErrLFSObjectFailed))
+		Expect(os.ReadFile(path.Join(dir, "model.bin"))).To(Equal([]byte(pointer)))
+	})
+
+	It("only supports repositories cloned over HTTP(S)", func() {
+		err := fetchLFSObjects(context.Background(), GinkgoT().TempDir(), "git@github.com:spot/app.git", nil)
+		Expect(err).To(MatchError(ErrLFSUnsupportedTransport))
+	})
+})
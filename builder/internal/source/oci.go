@@ -0,0 +1,124 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var ErrOCILayerUnnamed = errors.New("OCI artifact layer is neither a tarball nor a named file")
+
+// Annotation that holds the name of the file of a layer. ORAS and most
+// tools pushing files as artifacts set it on every layer.
+const kOCITitleAnnotation = "org.opencontainers.image.title"
+
+type OCIOpts struct {
+	BuildContext string
+
+	// Path to the Dockerfile relative to the root of the artifact.
+	// If empty, the Dockerfile is expected to be at the root of the BuildContext.
+	Dockerfile string
+
+	// Reference of the artifact (ie. ghcr.io/org/app-source:v1.2.0)
+	Reference string
+
+	// Keychain used to authenticate with the registry. Registries the
+	// keychain has no credentials for are accessed anonymously.
+	Keychain authn.Keychain
+
+	// Options passed down to the remote, mostly used to configure the transport.
+	RemoteOptions []remote.Option
+}
+
+// OCIArtifact pulls the artifact from its registry and writes its layers in order. Tarball layers
+// are extracted while any other layer is written to the file named by its title annotation.
+//
+// The Ref of the source is the artifact's reference by digest, which stays
+// valid even if the tag of the artifact is moved afterward.
+func OCIArtifact(ctx context.Context, opts OCIOpts) (Source, error) {
+	logger := log.FromContext(ctx)
+	dir, err := newDirectory(opts.BuildContext, opts.Dockerfile)
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := name.ParseReference(opts.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteOpts := append([]remote.Option{remote.WithContext(ctx)}, opts.RemoteOptions...)
+	if opts.Keychain != nil {
+		remoteOpts = append(remoteOpts, remote.WithAuthFromKeychain(anonymousFallback{opts.Keychain}))
+	}
+
+	logger.Info("Pulling OCI artifact", "reference", ref.String())
+	image, err := remote.Image(ref, remoteOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := image.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, descriptor := range manifest.Layers {
+		layer, err := image.LayerByDigest(descriptor.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := layer.Compressed()
+		if err != nil {
+			return nil, err
+		}
+
+		title := descriptor.Annotations[kOCITitleAnnotation]
+		switch {
+		case strings.Contains(string(descriptor.MediaType), "tar"):
+			err = dir.extract(content)
+		case title != "":
+			var file string
+			if file, err = dir.file(title); err == nil {
+				err = writeFile(file, content, 0644)
+			}
+		default:
+			err = fmt.Errorf("%w: %s (%s)", ErrOCILayerUnnamed, descriptor.Digest, descriptor.MediaType)
+		}
+
+		content.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	digest, err := image.Digest()
+	if err != nil {
+		return nil, err
+	}
+
+	dir.ref = ref.Context().Digest(digest.String()).String()
+	return &dir, nil
+}
+
+// Public artifacts don't need credentials, a registry without
+// credentials in the keychain is accessed anonymously.
+type anonymousFallback struct {
+	authn.Keychain
+}
+
+func (kc anonymousFallback) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	auth, err := kc.Keychain.Resolve(target)
+	if err != nil {
+		return authn.Anonymous, nil
+	}
+
+	return auth, nil
+}
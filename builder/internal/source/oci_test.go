@@ -0,0 +1,76 @@
+package source
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OCI artifact", func() {
+	var host string
+
+	BeforeEach(func() {
+		server := httptest.NewServer(registry.New())
+		DeferCleanup(server.Close)
+
+		u, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		host = u.Host
+	})
+
+	It("extracts tarball layers and writes the other layers to their titled file", func() {
+		sources := static.NewLayer(newTarball(
+			&tar.Header{Name: "app/", Typeflag: tar.TypeDir, Mode: 0755},
+			&tar.Header{Name: "app/main.go", Typeflag: tar.TypeReg, Mode: 0644},
+		), types.OCILayer)
+		dockerfile := static.NewLayer([]byte("FROM alpine\n"), "application/vnd.spot.dockerfile")
+
+		artifact, err := mutate.Append(empty.Image,
+			mutate.Addendum{Layer: sources},
+			mutate.Addendum{Layer: dockerfile, Annotations: map[string]string{kOCITitleAnnotation: "docker/Dockerfile"}},
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		ref, err := name.ParseReference(fmt.Sprintf("%s/spot/source:v1", host))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(ref, artifact)).To(Succeed())
+
+		digest, err := artifact.Digest()
+		Expect(err).NotTo(HaveOccurred())
+
+		src, err := OCIArtifact(context.Background(), OCIOpts{
+			BuildContext: "app",
+			Dockerfile:   "docker/Dockerfile",
+			Reference:    ref.String(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(src.Dockerfile()).To(BeARegularFile())
+		Expect(src.BuildContext() + "/main.go").To(BeARegularFile())
+		Expect(src.Ref()).To(Equal(fmt.Sprintf("%s/spot/source@%s", host, digest)))
+	})
+
+	It("requires a title for layers that aren't tarballs", func() {
+		artifact, err := mutate.Append(empty.Image, mutate.Addendum{Layer: static.NewLayer([]byte("FROM alpine\n"), "text/plain")})
+		Expect(err).NotTo(HaveOccurred())
+
+		ref, err := name.ParseReference(fmt.Sprintf("%s/spot/source:v1", host))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(ref, artifact)).To(Succeed())
+
+		_, err = OCIArtifact(context.Background(), OCIOpts{Reference: ref.String()})
+		Expect(err).To(MatchError(ErrOCILayerUnnamed))
+	})
+})
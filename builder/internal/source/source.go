@@ -0,0 +1,94 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+var ErrDockerfileOutsideRepository = errors.New("Dockerfile needs to be located within the repository")
+
+// Name of the Dockerfile that is used when the user didn't specify one.
+const DefaultDockerfile = "Dockerfile"
+
+// Source is the content an image is built from. Every source fetches its content
+// in a directory of the filesystem that buildkit uses as the context of the build.
+type Source interface {
+	// Path returns the directory where the source was fetched.
+	Path() string
+
+	// BuildContext returns the absolute path to the context of the build.
+	BuildContext() string
+
+	// Dockerfile returns the absolute path to the Dockerfile used to build the image.
+	Dockerfile() string
+
+	// Ref identifies the version of the source that was fetched, like the
+	// commit of a repository or the digest of an artifact.
+	Ref() (string, error)
+}
+
+// Directory where the content of a source lives. It implements
+// the Source interface for sources that know their ref upfront.
+type directory struct {
+	buildContext string
+	dockerfile   string
+	path         string
+	ref          string
+}
+
+// Create the directory for the source. The Dockerfile is validated before anything
+// is fetched as a Dockerfile outside of the directory can't be used by the build.
+func newDirectory(buildContext, dockerfile string) (directory, error) {
+	dir := directory{
+		buildContext: buildContext,
+		dockerfile:   dockerfile,
+		path:         fmt.Sprintf("%s/src", os.TempDir()),
+	}
+
+	if !strings.HasPrefix(dir.Dockerfile(), dir.path+"/") {
+		return dir, ErrDockerfileOutsideRepository
+	}
+
+	return dir, os.MkdirAll(dir.path, os.ModePerm)
+}
+
+// Path returns the temporary path where
+// the source was fetched.
+func (d *directory) Path() string {
+	return d.path
+}
+
+// BuildContext return the absolute path
+// to the context set by the user.
+func (d *directory) BuildContext() string {
+	return path.Join(d.path, d.buildContext)
+}
+
+// Dockerfile returns the absolute path to the Dockerfile
+// used to build the image. If the user didn't set a Dockerfile, it
+// defaults to the DefaultDockerfile at the root of the build context.
+func (d *directory) Dockerfile() string {
+	if d.dockerfile == "" {
+		return path.Join(d.BuildContext(), DefaultDockerfile)
+	}
+
+	return path.Join(d.path, d.dockerfile)
+}
+
+func (d *directory) Ref() (string, error) {
+	return d.ref, nil
+}
+
+// Returns the absolute path of a file of the source. Files are never
+// allowed to be written outside of the directory.
+func (d *directory) file(name string) (string, error) {
+	file := path.Join(d.path, name)
+	if !strings.HasPrefix(file, d.path+"/") {
+		return "", fmt.Errorf("%w: %s", ErrFileOutsideSource, name)
+	}
+
+	return file, nil
+}
@@ -0,0 +1,33 @@
+package source
+
+import (
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Directory", func() {
+	DescribeTable("resolves the Dockerfile within the repository",
+		func(buildContext, dockerfile, expected string) {
+			dir, err := newDirectory(buildContext, dockerfile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dir.Dockerfile()).To(Equal(path.Join(os.TempDir(), "src", expected)))
+		},
+		Entry("at the root of the repository by default", "", "", "Dockerfile"),
+		Entry("at the root of a build context that isn't the repository's root", "services/api", "", "services/api/Dockerfile"),
+		Entry("at a custom path, relative to the repository's root", "services/api", "docker/api.Dockerfile", "docker/api.Dockerfile"),
+		Entry("at a custom path that goes up within the repository", "services/api", "services/../Dockerfile", "Dockerfile"),
+	)
+
+	DescribeTable("doesn't use a Dockerfile outside of the repository",
+		func(buildContext, dockerfile string) {
+			_, err := newDirectory(buildContext, dockerfile)
+			Expect(err).To(MatchError(ErrDockerfileOutsideRepository))
+		},
+		Entry("with a custom path", "", "../Dockerfile"),
+		Entry("with a custom path going up from a nested directory", "services/api", "services/../../Dockerfile"),
+		Entry("with a build context outside of the repository", "../", ""),
+	)
+})
@@ -0,0 +1,103 @@
+package source
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/releasehub-com/spot/builder/internal/credentials"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var ErrTarballDownloadFailed = errors.New("couldn't download the tarball")
+var ErrTarballChecksumMismatch = errors.New("tarball doesn't match its checksum")
+
+type TarballOpts struct {
+	BuildContext string
+
+	// Path to the Dockerfile relative to the root of the tarball.
+	// If empty, the Dockerfile is expected to be at the root of the BuildContext.
+	Dockerfile string
+
+	URL string
+
+	// Hex encoded SHA256 of the tarball.
+	Checksum string
+
+	// Credentials for the host of the URL, the tarball is downloaded
+	// anonymously if there's no basic-auth credential for the host.
+	Credentials credentials.Credentials
+
+	// Client used to download the tarball, defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Tarball downloads the tarball and extracts it once its checksum is verified. The tarball is
+// downloaded to a temporary file first so nothing is extracted from a tarball that doesn't match.
+//
+// The Ref of the source is the checksum of the tarball.
+func Tarball(ctx context.Context, opts TarballOpts) (Source, error) {
+	logger := log.FromContext(ctx)
+	dir, err := newDirectory(opts.BuildContext, opts.Dockerfile)
+	if err != nil {
+		return nil, err
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, opts.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := opts.Credentials.ForHost(opts.URL)
+	if err == nil && credential.Type == credentials.TypeBasicAuth {
+		req.SetBasicAuth(credential.Username, credential.Password)
+	}
+
+	logger.Info("Downloading tarball", "url", opts.URL, "anonymous", req.Header.Get("Authorization") == "")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrTarballDownloadFailed, resp.Status)
+	}
+
+	file, err := os.CreateTemp("", "source-*.tar")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	digest := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, digest), resp.Body); err != nil {
+		return nil, err
+	}
+
+	if checksum := hex.EncodeToString(digest.Sum(nil)); checksum != opts.Checksum {
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrTarballChecksumMismatch, opts.Checksum, checksum)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if err := dir.extract(file); err != nil {
+		return nil, err
+	}
+
+	dir.ref = fmt.Sprintf("sha256:%s", opts.Checksum)
+	return &dir, nil
+}
@@ -0,0 +1,124 @@
+package source
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/releasehub-com/spot/builder/internal/credentials"
+)
+
+// Returns a gzipped tarball with the entries in order.
+func newTarball(entries ...*tar.Header) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+
+	for _, entry := range entries {
+		content := []byte(entry.Linkname)
+		if entry.Typeflag == tar.TypeReg {
+			content = []byte("FROM alpine\n")
+			entry.Size = int64(len(content))
+		}
+
+		Expect(archive.WriteHeader(entry)).To(Succeed())
+		if entry.Typeflag == tar.TypeReg {
+			_, err := archive.Write(content)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	}
+
+	Expect(archive.Close()).To(Succeed())
+	Expect(gz.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+func checksum(data []byte) string {
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
+
+var _ = Describe("Tarball", func() {
+	tarball := newTarball(
+		&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "app/", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "app/Dockerfile", Typeflag: tar.TypeReg, Mode: 0644},
+	)
+
+	var server *httptest.Server
+	var content []byte
+
+	BeforeEach(func() {
+		content = tarball
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if username, _, _ := r.BasicAuth(); username != "spot" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write(content)
+		}))
+		DeferCleanup(server.Close)
+	})
+
+	It("extracts the tarball once its checksum is verified", func() {
+		src, err := Tarball(context.Background(), TarballOpts{
+			BuildContext: "app",
+			URL:          server.URL + "/source.tar.gz",
+			Checksum:     checksum(tarball),
+			Credentials:  credentials.Credentials{{Host: server.URL, Type: credentials.TypeBasicAuth, Username: "spot", Password: "s3cr3t"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(src.Dockerfile()).To(BeARegularFile())
+		Expect(src.Ref()).To(Equal("sha256:" + checksum(tarball)))
+	})
+
+	It("doesn't extract a tarball that doesn't match its checksum", func() {
+		_, err := Tarball(context.Background(), TarballOpts{
+			BuildContext: "app",
+			URL:          server.URL + "/source.tar.gz",
+			Checksum:     checksum([]byte("another tarball")),
+			Credentials:  credentials.Credentials{{Host: server.URL, Type: credentials.TypeBasicAuth, Username: "spot"}},
+		})
+		Expect(err).To(MatchError(ErrTarballChecksumMismatch))
+		Expect(path.Join(os.TempDir(), "src/app/Dockerfile")).NotTo(BeAnExistingFile())
+	})
+
+	It("fails when the tarball can't be downloaded", func() {
+		_, err := Tarball(context.Background(), TarballOpts{
+			URL:      server.URL + "/source.tar.gz",
+			Checksum: checksum(tarball),
+		})
+		Expect(err).To(MatchError(ErrTarballDownloadFailed))
+	})
+
+	DescribeTable("doesn't write files outside of the source",
+		func(entries ...*tar.Header) {
+			content = newTarball(entries...)
+			_, err := Tarball(context.Background(), TarballOpts{
+				URL:         server.URL + "/source.tar.gz",
+				Checksum:    checksum(content),
+				Credentials: credentials.Credentials{{Host: server.URL, Type: credentials.TypeBasicAuth, Username: "spot"}},
+			})
+			Expect(err).To(MatchError(ErrFileOutsideSource))
+		},
+		Entry("with a relative path", &tar.Header{Name: "../Dockerfile", Typeflag: tar.TypeReg, Mode: 0644}),
+		Entry("through a symlink",
+			&tar.Header{Name: "etc", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+			&tar.Header{Name: "etc/passwd", Typeflag: tar.TypeReg, Mode: 0644},
+		),
+		Entry("by replacing a symlink",
+			&tar.Header{Name: "Dockerfile", Typeflag: tar.TypeSymlink, Linkname: "../Dockerfile"},
+			&tar.Header{Name: "Dockerfile", Typeflag: tar.TypeReg, Mode: 0644},
+		),
+	)
+})
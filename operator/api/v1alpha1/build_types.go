@@ -17,20 +17,66 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"time"
+
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// Label set on builds created for a workspace. The value is the name of the component the
+// build's image is for.
+const BuildComponentLabel = "spot.release.com/component"
+
 type BuildSpec struct {
 	// Information about the image that's going to be built
 	// For an image to be succesfully built, it needs to have
 	// a RegistrySpec associated with it.
 	Image ImageSpec `json:"image,omitempty"`
 
-	// SecretRef
-	// Reference to an existing k8s secret.
-	// The secret need to exist within the same namespace.
-	SecretRef string `json:"secret"`
+	// Arguments are passed to the build as build arguments (`--build-arg`).
+	// These values are stored in plain text, anything sensitive
+	// should be passed as a secret instead.
+	// +optional
+	Arguments []BuildArgument `json:"arguments,omitempty"`
+
+	// Secrets are exposed to the build as secret mounts and can be
+	// accessed in the Dockerfile with `RUN --mount=type=secret,id=<name>`.
+	// +optional
+	Secrets []BuildSecret `json:"secrets,omitempty"`
+
+	// Credentials used to push the image to the registry.
+	// +optional
+	RegistryCredentials []CredentialSpec `json:"registryCredentials,omitempty"`
+
+	// Credentials used to clone the repository.
+	// +optional
+	RepositoryCredentials []CredentialSpec `json:"repositoryCredentials,omitempty"`
+
+	// Builder overrides the cluster-wide BuilderConfig for the pod running this build.
+	// +optional
+	Builder *BuilderPodSpec `json:"builder,omitempty"`
+
+	// Retry defines how a build is retried when one of its conditions fails. If
+	// no retry policy is set, the build fails on the first error.
+	// +optional
+	Retry *BuildRetryPolicy `json:"retry,omitempty"`
+
+	// Priority of the build when builds are queued because the operator reached its
+	// concurrency limit. Builds with a higher priority leave the queue first, builds with the
+	// same priority leave the queue in the order they were created.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// Cancel stops the build. The pod running the build is deleted and the
+	// build moves to the Cancelled phase. A cancelled build can't be resumed.
+	// +optional
+	Cancel bool `json:"cancel,omitempty"`
+
+	// Timeout is the maximum duration of the build, across all attempts, starting
+	// from the moment the Build is created. A build that exceeds its timeout fails and
+	// is not retried.
+	// +optional
+	Timeout *meta.Duration `json:"timeout,omitempty"`
 
 	// Affinity is used by the CRD to dispatch the pod that will
 	// generate a build with the node affinity set here.
@@ -38,6 +84,55 @@ type BuildSpec struct {
 	Affinity *core.Affinity `json:"affinity,omitempty"`
 }
 
+type BuildRetryPolicy struct {
+	// MaxAttempts is the number of times the build can be attempted,
+	// including the first attempt.
+	// +kubebuilder:default:=1
+	// +kubebuilder:validation:Minimum:=1
+	MaxAttempts int `json:"maxAttempts"`
+
+	// Backoff is the delay before the second attempt, it doubles for every
+	// subsequent attempt. Defaults to 10 seconds.
+	// +optional
+	Backoff *meta.Duration `json:"backoff,omitempty"`
+
+	// Conditions that can be retried when they fail. If empty, the default
+	// conditions are the ones that usually fail due to transient errors:
+	// PodDeployment, RetrievingSource and UploadingImage.
+	// +optional
+	RetryableConditions []BuildConditionType `json:"retryableConditions,omitempty"`
+}
+
+// Default delay before a failed build is attempted again.
+const DefaultBuildRetryBackoff = 10 * time.Second
+
+// Conditions that are retried when the BuildRetryPolicy doesn't specify any.
+var DefaultRetryableBuildConditions = []BuildConditionType{
+	BuildConditionDeployPod,
+	BuildConditionSource,
+	BuildConditionRegistry,
+}
+
+// Names of the condition types before they followed the conventions of metav1.Condition. Retry
+// policies that still use them are migrated when the Build is defaulted, the conditions of the
+// status when the Build is reconciled.
+var kLegacyBuildConditionTypes = map[string]string{
+	"Pod Deployment":                     string(BuildConditionDeployPod),
+	"Retrieving Source":                  string(BuildConditionSource),
+	"Building Image":                     string(BuildConditionBuilding),
+	"Uploading Build to remote registry": string(BuildConditionRegistry),
+	"Scanning Image":                     string(BuildConditionScan),
+}
+
+// Default renames the retryable conditions that still use the legacy condition types.
+func (p *BuildRetryPolicy) Default() {
+	for i, t := range p.RetryableConditions {
+		if renamed, ok := kLegacyBuildConditionTypes[string(t)]; ok {
+			p.RetryableConditions[i] = BuildConditionType(renamed)
+		}
+	}
+}
+
 // BuildStatus defines the observed state of Build
 type BuildStatus struct {
 	// Phase is a composite of the conditions. It's main use is to display
@@ -50,9 +145,9 @@ type BuildStatus struct {
 
 	// Set of conditions that the build manages. For a build
 	// to be successful and completed, all the conditions in this set
-	// are required to have a status of ConditionSuccess.
+	// are required to be True.
 	// A build is considered to have failed if at least one
-	// of the condition in this list is marked as ConditionError
+	// of the condition in this list is False.
 	Conditions BuildConditions `json:"conditions"`
 
 	// The Pod that will run the build logic
@@ -61,55 +156,170 @@ type BuildStatus struct {
 	// when the image is ready.
 	Pod *Reference `json:"pod,omitempty"`
 
+	// Commit SHA that was checked out for this build. It's the resolved
+	// commit when the build's GitReference only has a name.
+	// +optional
+	Commit string `json:"commit,omitempty"`
+
+	// Version of the source the image was built from when the source isn't a git
+	// repository: the checksum of a tarball, the digest of an OCI artifact or the
+	// name and resource version of a ConfigMap.
+	// +optional
+	SourceRef string `json:"sourceRef,omitempty"`
+
 	// The Image will store information about the image that
 	// was created by this build. This value is nil until
 	// the stage reaches BuildStageDone
 	Image *BuildImage `json:"image,omitempty"`
+
+	// Mirrors stores the outcome of the push to each of the mirrors of the
+	// ImageSpec, in the same order.
+	// +optional
+	Mirrors []BuildMirror `json:"mirrors,omitempty"`
+
+	// Vulnerabilities found by the scan of the image, when the image is scanned.
+	// +optional
+	Vulnerabilities *VulnerabilitySummary `json:"vulnerabilities,omitempty"`
+
+	// Progress is a summary of the steps buildkit executed so far. It is
+	// updated periodically by the builder while the image is being built.
+	// +optional
+	Progress *BuildProgress `json:"progress,omitempty"`
+
+	// Position of the build in the queue while the build is waiting
+	// for a slot to run. The first build in the queue is at position 1.
+	// +optional
+	QueuePosition int `json:"queuePosition,omitempty"`
+
+	// Attempts that failed and were retried, the oldest first. The current
+	// attempt is the one described by the Conditions and the Pod.
+	// +optional
+	Attempts []BuildAttempt `json:"attempts,omitempty"`
+
+	// Logs of the build, stored once the image is built, whether it
+	// was successful or not. The logs outlive the pod that ran the build.
+	// +optional
+	Logs *BuildLogs `json:"logs,omitempty"`
+}
+
+type BuildAttempt struct {
+	// The Pod that ran this attempt.
+	Pod *Reference `json:"pod,omitempty"`
+
+	// Conditions as they were when the attempt failed.
+	Conditions BuildConditions `json:"conditions"`
+
+	// Logs stored by the builder during this attempt.
+	// +optional
+	Logs *BuildLogs `json:"logs,omitempty"`
+
+	// Time at which the attempt was marked as failed.
+	FailedAt meta.Time `json:"failedAt"`
 }
 
 // Retrieve a *copy* of the condition if it already exists for the given type. If the condition
 // doesn't exist, it will create a new one. In order to persist the condition on the status stack,
 // the condition needs to be applied by calling `SetCondition(condition)`
-func (bs *BuildStatus) GetCondition(bct BuildConditionType) BuildCondition {
+func (bs *BuildStatus) GetCondition(bct BuildConditionType) meta.Condition {
 	for _, c := range bs.Conditions {
-		if c.Type == bct {
+		if c.Type == string(bct) {
 			return c
 		}
 	}
 
-	return BuildCondition{
-		Type:   bct,
-		Status: ConditionInitialized,
+	return meta.Condition{
+		Type:   string(bct),
+		Status: meta.ConditionUnknown,
+		Reason: ConditionReasonInitialized,
 	}
 }
 
 // Set the condition in the condition stack. If a condition for the given type already
 // exists, it will be overwritten by this new condition. If it doesn't exist, it will be appended
 // to the stack.
-// For the condition to be persisted, the BuildStatus needs to be committed to the API. The
-// LastTransitionTime is set here and represent the time that the reconciler set the condition in
-// memory, not to be confused with the time the condition was committed to the database.
-func (bs *BuildStatus) SetCondition(condition BuildCondition) {
-	inserted := false
+// For the condition to be persisted, the BuildStatus needs to be committed to the API.
+func (bs *BuildStatus) SetCondition(condition meta.Condition) {
+	setCondition((*[]meta.Condition)(&bs.Conditions), condition)
+}
+
+// Convert the conditions, including the ones of the previous attempts, that were stored before the
+// conditions were metav1.Conditions. Returns true if the status needs to be updated.
+func (bs *BuildStatus) MigrateConditions() bool {
+	migrated := migrateConditions(bs.Conditions, kLegacyBuildConditionTypes)
+	for i := range bs.Attempts {
+		if migrateConditions(bs.Attempts[i].Conditions, kLegacyBuildConditionTypes) {
+			migrated = true
+		}
+	}
+
+	return migrated
+}
+
+// Returns true if the build has a timeout and the timeout elapsed at the given time.
+func (b *Build) DeadlineExceeded(now time.Time) bool {
+	if b.Spec.Timeout == nil {
+		return false
+	}
+
+	return now.After(b.CreationTimestamp.Add(b.Spec.Timeout.Duration))
+}
+
+// Returns true if all the conditions that failed are retryable and the
+// build still has attempts left in its retry policy.
+func (b *Build) CanRetry() bool {
+	policy := b.Spec.Retry
+	if policy == nil || len(b.Status.Attempts)+1 >= policy.MaxAttempts {
+		return false
+	}
 
-	if condition.LastTransitionTime.IsZero() {
-		condition.LastTransitionTime = meta.Now()
+	retryable := policy.RetryableConditions
+	if len(retryable) == 0 {
+		retryable = DefaultRetryableBuildConditions
 	}
 
-	for i, c := range bs.Conditions {
-		if c.Type == condition.Type {
-			bs.Conditions[i] = condition
-			inserted = true
-			break
+	failed := false
+	for _, condition := range b.Status.Conditions {
+		if condition.Status != meta.ConditionFalse {
+			continue
+		}
+
+		failed = true
+		if !containsConditionType(retryable, BuildConditionType(condition.Type)) {
+			return false
 		}
 	}
 
-	if !inserted {
-		bs.Conditions = append(bs.Conditions, condition)
+	return failed
+}
+
+func containsConditionType(types []BuildConditionType, t BuildConditionType) bool {
+	for _, ct := range types {
+		if ct == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns how long to wait before starting the next attempt. The backoff
+// doubles for every attempt that already failed.
+func (b *Build) RetryBackoff() time.Duration {
+	backoff := DefaultBuildRetryBackoff
+	if b.Spec.Retry != nil && b.Spec.Retry.Backoff != nil {
+		backoff = b.Spec.Retry.Backoff.Duration
 	}
+
+	for i := 1; i < len(b.Status.Attempts); i++ {
+		backoff *= 2
+	}
+
+	return backoff
 }
 
-type BuildConditions []BuildCondition
+// +listType=map
+// +listMapKey=type
+type BuildConditions []meta.Condition
 
 // Return a BuildPhase that represent the current derivation
 // off the current conditions. If there's no conditions present
@@ -118,11 +328,11 @@ func (bc BuildConditions) CurrentPhase() BuildPhase {
 	completed := true
 
 	for _, cond := range bc {
-		if cond.Status == ConditionError {
+		if cond.Status == meta.ConditionFalse {
 			return BuildPhaseError
 		}
 
-		if cond.Status != ConditionSuccess {
+		if cond.Status != meta.ConditionTrue {
 			completed = false
 		}
 	}
@@ -134,57 +344,254 @@ func (bc BuildConditions) CurrentPhase() BuildPhase {
 	return BuildPhaseRunning
 }
 
-// These constants are the keys that should be used to define secret data
-// Secrets in k8s is a key/value list and as such, the build expects these keys to
-// exists inside the secret. The value for each of the keys is expected to be a valid
-// JSON field.
-// TODO: Document the JSON field structure
-const BuildSecretRegistries string = "registries"
-const BuildSecretRepositories string = "repositories"
-const BuildSecretArguments string = "arguments"
-const BuildSecretSecrets string = "secrets"
+type BuildArgument struct {
+	// Name of the build argument as it is declared
+	// with `ARG` in the Dockerfile.
+	Name string `json:"name"`
 
-type BuildCondition struct {
-	// Type is the name of the condition. Conceptually this represents a task in the process
-	// of a Build.
-	Type BuildConditionType `json:"type" protobuf:"bytes,1,opt,name=type,casttype=BuildConditionType"`
+	Value string `json:"value"`
+}
 
-	// Status of the condition.
-	// Can be In Progress, Error, Success.
-	Status ConditionStatus `json:"status" protobuf:"bytes,2,opt,name=status,casttype=ConditionStatus"`
+type BuildSecret struct {
+	// Name is the id used to mount the secret in the Dockerfile.
+	Name string `json:"name"`
 
-	// Last time the condition transitioned from one status to another.
+	// Reference to the key of a secret that holds the value. The
+	// secret needs to exist within the same namespace as the build.
+	ValueFrom core.SecretKeySelector `json:"valueFrom"`
+}
+
+// CredentialSpec links a host to a secret holding the credentials
+// to authenticate with that host.
+type CredentialSpec struct {
+	// Host the credentials are used for. For registries, this is
+	// the registry's host (ie. ghcr.io), for repositories it's the URL of
+	// the repository.
+	Host string `json:"host"`
+
+	// Type of the credentials stored in the secret. Registries only support basic-auth
+	// and docker-config credentials. Defaults to basic-auth.
 	// +optional
-	LastTransitionTime meta.Time `json:"lastTransitionTime,omitempty" protobuf:"bytes,4,opt,name=lastTransitionTime"`
+	Type CredentialType `json:"type,omitempty"`
+
+	// SecretRef is the name of the secret holding the credentials, its keys depend on the type:
+	//   - basic-auth: `username` and `password`, like a `kubernetes.io/basic-auth` secret.
+	//   - ssh: `ssh-privatekey`, like a `kubernetes.io/ssh-auth` secret, and `known_hosts`.
+	//   - github-app: `app-id`, `installation-id` and `private-key`, the app's PEM encoded private key.
+	//   - docker-config: `.dockerconfigjson`, like a `kubernetes.io/dockerconfigjson` secret. The credentials
+	//     are looked up by registry in the config, the host only identifies the credential.
+	// The secret needs to exist within the same namespace as the build.
+	SecretRef string `json:"secretRef"`
 }
 
+// +kubebuilder:validation:Enum=basic-auth;ssh;github-app;docker-config
+type CredentialType string
+
+const (
+	CredentialTypeBasicAuth    CredentialType = "basic-auth"
+	CredentialTypeSSH          CredentialType = "ssh"
+	CredentialTypeGitHubApp    CredentialType = "github-app"
+	CredentialTypeDockerConfig CredentialType = "docker-config"
+)
+
+// Returns true if the type is one of the given types. An empty
+// type is a basic-auth credential.
+func (ct CredentialType) in(types []CredentialType) bool {
+	if ct == "" {
+		ct = CredentialTypeBasicAuth
+	}
+
+	for _, t := range types {
+		if ct == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Keys expected in the secret of ssh and github-app credentials.
+const (
+	CredentialSSHKnownHostsKey        = "known_hosts"
+	CredentialGitHubAppIDKey          = "app-id"
+	CredentialGitHubInstallationIDKey = "installation-id"
+	CredentialGitHubAppPrivateKeyKey  = "private-key"
+)
+
 type BuildConditionType string
 
 const (
-	BuildConditionDeployPod BuildConditionType = "Pod Deployment"
-	BuildConditionSource    BuildConditionType = "Retrieving Source"
-	BuildConditionBuilding  BuildConditionType = "Building Image"
-	BuildConditionRegistry  BuildConditionType = "Uploading Build to remote registry"
+	BuildConditionDeployPod BuildConditionType = "PodDeployment"
+	BuildConditionSource    BuildConditionType = "RetrievingSource"
+	BuildConditionBuilding  BuildConditionType = "BuildingImage"
+	BuildConditionRegistry  BuildConditionType = "UploadingImage"
+	BuildConditionScan      BuildConditionType = "ScanningImage"
 )
 
-// +kubebuilder:validation:Enum=Running;Done;Errored
+// +kubebuilder:validation:Enum=Queued;Running;Done;Errored;Cancelled
 type BuildPhase string
 
 const (
 	BuildPhaseInitialized BuildPhase = ""        // TODO: Remove this when I can figure out how to set a default value.
 	BuildPhaseRunning     BuildPhase = "Running" // TODO: Make this the default when the above is removed.
+	BuildPhaseQueued      BuildPhase = "Queued"
 	BuildPhaseDone        BuildPhase = "Done"
 	BuildPhaseError       BuildPhase = "Errored"
+	BuildPhaseCancelled   BuildPhase = "Cancelled"
 )
 
+// BuildProgress summarizes the solve status reported by buildkit. The total
+// grows as buildkit discovers new steps so it shouldn't be used as a definitive value
+// until the build is done.
+type BuildProgress struct {
+	// Name of the step currently executing, for a Dockerfile this generally
+	// is the instruction (ie. `[3/5] RUN make`).
+	// +optional
+	CurrentStep string `json:"currentStep,omitempty"`
+
+	// Number of steps that are completed, including the cached ones.
+	Completed int `json:"completed"`
+
+	// Number of steps known to buildkit.
+	Total int `json:"total"`
+
+	// Number of completed steps that were retrieved from the cache
+	// instead of being executed.
+	Cached int `json:"cached"`
+
+	// Bytes pulled from the registries for the base images.
+	BytesPulled int64 `json:"bytesPulled"`
+
+	// Last time the builder updated the progress.
+	// +optional
+	LastUpdateTime meta.Time `json:"lastUpdateTime,omitempty"`
+}
+
+// Add the counters of another progress to this one. This is used
+// to aggregate the progress of many builds.
+func (bp *BuildProgress) Add(other BuildProgress) {
+	bp.Completed += other.Completed
+	bp.Total += other.Total
+	bp.Cached += other.Cached
+	bp.BytesPulled += other.BytesPulled
+}
+
+// BuildLogs references where the logs of a build are stored. The logs
+// are split by steps, each step is stored as a JSON object under its own key (ie. `step-1.json`)
+// and the steps are spread across as many ConfigMaps as needed to fit within the size limit of a ConfigMap.
+type BuildLogs struct {
+	// ConfigMaps holding the steps, in the order the steps were executed.
+	ConfigMaps []Reference `json:"configMaps,omitempty"`
+}
+
+type BuildMirror struct {
+	// Repository of the mirror, as set in the RegistrySpec.
+	URL string `json:"url"`
+
+	// Image as it was pushed to the mirror. It is nil when the
+	// image couldn't be pushed to the mirror.
+	// +optional
+	Image *BuildImage `json:"image,omitempty"`
+
+	// Error returned when pushing the image to the mirror, or when signing it.
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
 type BuildImage struct {
 	Metadata string `json:"metadata,omitempty"`
-	URL      string `json:"url,omitempty"`
+
+	// Repository the image was pushed to, as set in the RegistrySpec.
+	URL string `json:"url,omitempty"`
+
+	// Digest of the manifest that was pushed. For a multi-platform
+	// image, it's the digest of the index.
+	// +optional
+	Digest string `json:"digest,omitempty"`
+
+	// Immutable reference to the image (ie. ghcr.io/org/app@sha256:...). Images
+	// are deployed with this reference so a tag being moved doesn't change what runs.
+	// +optional
+	Reference string `json:"reference,omitempty"`
+
+	// Tags the image was pushed with.
+	// +optional
+	Tags []string `json:"tags,omitempty"`
+
+	// Manifests that were pushed as part of the image index, one for
+	// each of the platforms the image was built for.
+	// +optional
+	Platforms []BuildImagePlatform `json:"platforms,omitempty"`
+
+	// Attestation manifests pushed with the image, one for each platform
+	// when attestations were requested.
+	// +optional
+	Attestations []BuildImageAttestation `json:"attestations,omitempty"`
+
+	// Immutable reference to the cosign signature of the image, when the image is signed.
+	// +optional
+	Signature string `json:"signature,omitempty"`
+}
+
+// VulnerabilitySummary counts the vulnerabilities of the image by severity. A vulnerability
+// affecting more than one platform of the image is only counted once.
+type VulnerabilitySummary struct {
+	Critical int `json:"critical"`
+	High     int `json:"high"`
+	Medium   int `json:"medium"`
+	Low      int `json:"low"`
+	Unknown  int `json:"unknown"`
+
+	// Identifiers of the vulnerabilities at or above the threshold of the scan.
+	// +optional
+	Blocking []string `json:"blocking,omitempty"`
+}
+
+// Add a vulnerability of the severity to the summary.
+func (vs *VulnerabilitySummary) Add(severity Severity) {
+	switch severity {
+	case SeverityCritical:
+		vs.Critical++
+	case SeverityHigh:
+		vs.High++
+	case SeverityMedium:
+		vs.Medium++
+	case SeverityLow:
+		vs.Low++
+	default:
+		vs.Unknown++
+	}
+}
+
+type BuildImageAttestation struct {
+	// Digest of the attestation manifest.
+	Digest string `json:"digest"`
+
+	// Digest of the manifest the attestation is about.
+	Subject string `json:"subject"`
+
+	// Predicate types of the in-toto statements of the attestation
+	// (ie. https://spdx.dev/Document, https://slsa.dev/provenance/v0.2).
+	PredicateTypes []string `json:"predicateTypes,omitempty"`
+}
+
+type BuildImagePlatform struct {
+	// Platform of the manifest in the `os/arch[/variant]` format.
+	Platform string `json:"platform"`
+
+	// Digest of the manifest for this platform.
+	Digest string `json:"digest"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Completed",type=integer,JSONPath=`.status.progress.completed`
+//+kubebuilder:printcolumn:name="Total",type=integer,JSONPath=`.status.progress.total`
+//+kubebuilder:printcolumn:name="Step",type=string,JSONPath=`.status.progress.currentStep`,priority=1
+//+kubebuilder:printcolumn:name="Queue",type=integer,JSONPath=`.status.queuePosition`,priority=1
+//+kubebuilder:printcolumn:name="Critical",type=integer,JSONPath=`.status.vulnerabilities.critical`,priority=1
+//+kubebuilder:printcolumn:name="High",type=integer,JSONPath=`.status.vulnerabilities.high`,priority=1
 
 // Build is the Schema for the builds API
 type Build struct {
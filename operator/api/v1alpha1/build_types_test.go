@@ -1,8 +1,11 @@
 package v1alpha1
 
 import (
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var _ = Describe("Build Types", func() {
@@ -11,17 +14,17 @@ var _ = Describe("Build Types", func() {
 		It("Returns BuildPhaseDone when all condition are successful", func() {
 			Expect(BuildStatus{
 				Conditions: BuildConditions{
-					BuildCondition{
+					meta.Condition{
 						Type:   "warmup",
-						Status: ConditionSuccess,
+						Status: meta.ConditionTrue,
 					},
-					BuildCondition{
+					meta.Condition{
 						Type:   "build",
-						Status: ConditionSuccess,
+						Status: meta.ConditionTrue,
 					},
-					BuildCondition{
+					meta.Condition{
 						Type:   "build",
-						Status: ConditionSuccess,
+						Status: meta.ConditionTrue,
 					},
 				},
 			}.Conditions.CurrentPhase()).To(Equal(BuildPhaseDone))
@@ -30,34 +33,37 @@ var _ = Describe("Build Types", func() {
 		It("Returns BuildPhaseRunning when at least one condition is in progress", func() {
 			Expect(BuildStatus{
 				Conditions: BuildConditions{
-					BuildCondition{
+					meta.Condition{
 						Type:   "warmup",
-						Status: ConditionSuccess,
+						Status: meta.ConditionTrue,
 					},
-					BuildCondition{
+					meta.Condition{
 						Type:   "build",
-						Status: ConditionInProgress,
+						Status: meta.ConditionUnknown,
+						Reason: ConditionReasonStarted,
 					},
-					BuildCondition{
+					meta.Condition{
 						Type:   "build",
-						Status: ConditionWaiting,
+						Status: meta.ConditionUnknown,
+						Reason: ConditionReasonWaiting,
 					},
 				},
 			}.Conditions.CurrentPhase()).To(Equal(BuildPhaseRunning))
 
 			Expect(BuildStatus{
 				Conditions: BuildConditions{
-					BuildCondition{
+					meta.Condition{
 						Type:   "warmup",
-						Status: ConditionSuccess,
+						Status: meta.ConditionTrue,
 					},
-					BuildCondition{
+					meta.Condition{
 						Type:   "build",
-						Status: ConditionSuccess,
+						Status: meta.ConditionTrue,
 					},
-					BuildCondition{
+					meta.Condition{
 						Type:   "build",
-						Status: ConditionInProgress,
+						Status: meta.ConditionUnknown,
+						Reason: ConditionReasonStarted,
 					},
 				},
 			}.Conditions.CurrentPhase()).To(Equal(BuildPhaseRunning))
@@ -66,20 +72,159 @@ var _ = Describe("Build Types", func() {
 		It("Returns BuildPhaseError when at least one condition failed", func() {
 			Expect(BuildStatus{
 				Conditions: BuildConditions{
-					BuildCondition{
+					meta.Condition{
 						Type:   "warmup",
-						Status: ConditionSuccess,
+						Status: meta.ConditionTrue,
 					},
-					BuildCondition{
+					meta.Condition{
 						Type:   "build",
-						Status: ConditionError,
+						Status: meta.ConditionFalse,
 					},
-					BuildCondition{
+					meta.Condition{
 						Type:   "build",
-						Status: ConditionWaiting,
+						Status: meta.ConditionUnknown,
+						Reason: ConditionReasonWaiting,
 					},
 				},
 			}.Conditions.CurrentPhase()).To(Equal(BuildPhaseError))
 		})
 	})
+
+	Context("Retries", func() {
+		failed := func(t BuildConditionType) BuildConditions {
+			return BuildConditions{
+				meta.Condition{Type: string(BuildConditionDeployPod), Status: meta.ConditionTrue},
+				meta.Condition{Type: string(t), Status: meta.ConditionFalse},
+			}
+		}
+
+		It("Doesn't retry without a retry policy", func() {
+			build := Build{Status: BuildStatus{Conditions: failed(BuildConditionRegistry)}}
+			Expect(build.CanRetry()).To(BeFalse())
+		})
+
+		It("Retries the default conditions until attempts are exhausted", func() {
+			build := Build{
+				Spec:   BuildSpec{Retry: &BuildRetryPolicy{MaxAttempts: 2}},
+				Status: BuildStatus{Conditions: failed(BuildConditionRegistry)},
+			}
+			Expect(build.CanRetry()).To(BeTrue())
+
+			build.Status.Attempts = append(build.Status.Attempts, BuildAttempt{})
+			Expect(build.CanRetry()).To(BeFalse())
+		})
+
+		It("Only retries the configured conditions", func() {
+			build := Build{
+				Spec:   BuildSpec{Retry: &BuildRetryPolicy{MaxAttempts: 3}},
+				Status: BuildStatus{Conditions: failed(BuildConditionBuilding)},
+			}
+			Expect(build.CanRetry()).To(BeFalse())
+
+			build.Spec.Retry.RetryableConditions = []BuildConditionType{BuildConditionBuilding}
+			Expect(build.CanRetry()).To(BeTrue())
+		})
+
+		It("Doubles the backoff for every failed attempt", func() {
+			build := Build{
+				Spec: BuildSpec{Retry: &BuildRetryPolicy{
+					MaxAttempts: 4,
+					Backoff:     &meta.Duration{Duration: time.Second},
+				}},
+				Status: BuildStatus{Attempts: []BuildAttempt{{}}},
+			}
+			Expect(build.RetryBackoff()).To(Equal(time.Second))
+
+			build.Status.Attempts = append(build.Status.Attempts, BuildAttempt{}, BuildAttempt{})
+			Expect(build.RetryBackoff()).To(Equal(4 * time.Second))
+		})
+
+		It("Exceeds the deadline once the timeout elapsed", func() {
+			created := time.Now().Add(-time.Hour)
+			build := Build{ObjectMeta: meta.ObjectMeta{CreationTimestamp: meta.NewTime(created)}}
+			Expect(build.DeadlineExceeded(time.Now())).To(BeFalse())
+
+			build.Spec.Timeout = &meta.Duration{Duration: 30 * time.Minute}
+			Expect(build.DeadlineExceeded(time.Now())).To(BeTrue())
+			Expect(build.DeadlineExceeded(created.Add(time.Minute))).To(BeFalse())
+		})
+	})
+
+	Context("SetCondition", func() {
+		It("Returns an initialized condition when it wasn't set", func() {
+			condition := (&BuildStatus{}).GetCondition(BuildConditionScan)
+			Expect(condition.Type).To(Equal("ScanningImage"))
+			Expect(condition.Status).To(Equal(meta.ConditionUnknown))
+			Expect(condition.Reason).To(Equal(ConditionReasonInitialized))
+		})
+
+		It("Only updates the transition time when the status changes", func() {
+			transitioned := meta.NewTime(time.Now().Add(-time.Hour))
+			status := BuildStatus{Conditions: BuildConditions{{
+				Type:               string(BuildConditionSource),
+				Status:             meta.ConditionUnknown,
+				LastTransitionTime: transitioned,
+			}}}
+
+			status.SetCondition(meta.Condition{Type: string(BuildConditionSource), Status: meta.ConditionUnknown, Reason: ConditionReasonStarted})
+			Expect(status.GetCondition(BuildConditionSource).LastTransitionTime).To(Equal(transitioned))
+			Expect(status.GetCondition(BuildConditionSource).Reason).To(Equal(ConditionReasonStarted))
+
+			condition := status.GetCondition(BuildConditionSource)
+			condition.Status = meta.ConditionFalse
+			condition.Message = "authentication required"
+			status.SetCondition(condition)
+			Expect(status.GetCondition(BuildConditionSource).LastTransitionTime.After(transitioned.Time)).To(BeTrue())
+			Expect(status.GetCondition(BuildConditionSource).Message).To(Equal("authentication required"))
+		})
+	})
+
+	Context("MigrateConditions", func() {
+		It("converts the conditions stored before they were metav1.Conditions", func() {
+			transitioned := meta.NewTime(time.Now().Add(-time.Hour))
+			status := BuildStatus{
+				Conditions: BuildConditions{
+					{Type: "Pod Deployment", Status: "Success", LastTransitionTime: transitioned},
+					{Type: "Retrieving Source", Status: "In Progress", LastTransitionTime: transitioned},
+				},
+				Attempts: []BuildAttempt{{Conditions: BuildConditions{
+					{Type: "Uploading Build to remote registry", Status: "Error", Reason: "Unauthorized", LastTransitionTime: transitioned},
+				}}},
+			}
+			Expect(status.MigrateConditions()).To(BeTrue())
+
+			Expect(status.GetCondition(BuildConditionDeployPod)).To(Equal(meta.Condition{
+				Type:               string(BuildConditionDeployPod),
+				Status:             meta.ConditionTrue,
+				Reason:             ConditionReasonSucceeded,
+				LastTransitionTime: transitioned,
+			}))
+			Expect(status.GetCondition(BuildConditionSource).Status).To(Equal(meta.ConditionUnknown))
+			Expect(status.GetCondition(BuildConditionSource).Reason).To(Equal(ConditionReasonStarted))
+			Expect(status.Attempts[0].Conditions[0].Type).To(Equal(string(BuildConditionRegistry)))
+			Expect(status.Attempts[0].Conditions[0].Status).To(Equal(meta.ConditionFalse))
+			Expect(status.Attempts[0].Conditions[0].Reason).To(Equal("Unauthorized"))
+			Expect(status.Conditions.CurrentPhase()).To(Equal(BuildPhaseRunning))
+
+			Expect(status.MigrateConditions()).To(BeFalse())
+		})
+	})
+
+	Context("Vulnerabilities", func() {
+		It("orders the severities", func() {
+			Expect(SeverityCritical.AtLeast(SeverityHigh)).To(BeTrue())
+			Expect(SeverityHigh.AtLeast(SeverityHigh)).To(BeTrue())
+			Expect(SeverityMedium.AtLeast(SeverityHigh)).To(BeFalse())
+			Expect(Severity("Negligible").AtLeast(SeverityLow)).To(BeFalse())
+		})
+
+		It("counts the vulnerabilities by severity", func() {
+			var summary VulnerabilitySummary
+			for _, severity := range []Severity{SeverityCritical, SeverityHigh, SeverityHigh, SeverityLow, ""} {
+				summary.Add(severity)
+			}
+
+			Expect(summary).To(Equal(VulnerabilitySummary{Critical: 1, High: 2, Low: 1, Unknown: 1}))
+		})
+	})
 })
@@ -0,0 +1,235 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var ErrBuildArgumentNameMissing = errors.New("build argument requires a name")
+var ErrBuildArgumentDuplicated = errors.New("build argument is defined more than once")
+var ErrBuildSecretNameMissing = errors.New("build secret requires a name")
+var ErrBuildSecretReferenceMissing = errors.New("build secret requires a secret name and a key")
+var ErrBuildSecretDuplicated = errors.New("build secret is defined more than once")
+var ErrCredentialHostMissing = errors.New("credential requires a host")
+var ErrCredentialSecretMissing = errors.New("credential requires a secret reference")
+var ErrCredentialDuplicated = errors.New("credential is defined more than once for the same host")
+var ErrCredentialTypeUnsupported = errors.New("credential type is not supported")
+var ErrBuildCancelReverted = errors.New("a cancelled build can't be resumed")
+var ErrSourceMissing = errors.New("repository requires the source of its type")
+var ErrSourceAmbiguous = errors.New("repository can only set the source of its type")
+var ErrTarballChecksumInvalid = errors.New("tarball checksum needs to be a hex encoded SHA256")
+var ErrGitReferenceMissing = errors.New("git reference requires a name or a hash")
+var ErrGitReferenceHashInvalid = errors.New("git reference hash needs to be a full commit SHA")
+var ErrMirrorURLMissing = errors.New("mirror requires a URL")
+var ErrMirrorDuplicated = errors.New("image is pushed more than once to the same URL")
+var ErrSigningMethodInvalid = errors.New("signing requires either a key or keyless signing")
+var ErrScanDatabaseMissing = errors.New("scan requires the volume claim of the vulnerability database")
+
+func (r *Build) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-spot-release-com-v1alpha1-build,mutating=true,failurePolicy=fail,sideEffects=None,groups=spot.release.com,resources=builds,verbs=create;update,versions=v1alpha1,name=mbuild.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &Build{}
+
+// Default migrates the fields of the builds created before they were deprecated or renamed.
+func (r *Build) Default() {
+	if repository := r.Spec.Image.Repository; repository != nil {
+		repository.Default()
+	}
+
+	if r.Spec.Retry != nil {
+		r.Spec.Retry.Default()
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-spot-release-com-v1alpha1-build,mutating=false,failurePolicy=fail,sideEffects=None,groups=spot.release.com,resources=builds,verbs=create;update,versions=v1alpha1,name=vbuild.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &Build{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *Build) ValidateCreate() (admission.Warnings, error) {
+	return nil, r.Spec.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *Build) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	// Build is about to be deleted, skip validation.
+	if r.DeletionTimestamp != nil {
+		return nil, nil
+	}
+
+	if previous, ok := old.(*Build); ok && previous.Spec.Cancel && !r.Spec.Cancel {
+		return nil, ErrBuildCancelReverted
+	}
+
+	return nil, r.Spec.validate()
+}
+
+// ValidateDelete is not needed, just here to satisfy the interface.
+func (r *Build) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (bs *BuildSpec) validate() error {
+	arguments := map[string]bool{}
+	for _, argument := range bs.Arguments {
+		if argument.Name == "" {
+			return ErrBuildArgumentNameMissing
+		}
+
+		if arguments[argument.Name] {
+			return fmt.Errorf("%w: %s", ErrBuildArgumentDuplicated, argument.Name)
+		}
+		arguments[argument.Name] = true
+	}
+
+	secrets := map[string]bool{}
+	for _, secret := range bs.Secrets {
+		if secret.Name == "" {
+			return ErrBuildSecretNameMissing
+		}
+
+		if secret.ValueFrom.Name == "" || secret.ValueFrom.Key == "" {
+			return fmt.Errorf("%w: %s", ErrBuildSecretReferenceMissing, secret.Name)
+		}
+
+		if secrets[secret.Name] {
+			return fmt.Errorf("%w: %s", ErrBuildSecretDuplicated, secret.Name)
+		}
+		secrets[secret.Name] = true
+	}
+
+	if repository := bs.Image.Repository; repository != nil {
+		if err := repository.validate(); err != nil {
+			return err
+		}
+	}
+
+	urls := map[string]bool{bs.Image.Registry.URL: true}
+	for _, mirror := range bs.Image.Mirrors {
+		if mirror.URL == "" {
+			return ErrMirrorURLMissing
+		}
+
+		if urls[mirror.URL] {
+			return fmt.Errorf("%w: %s", ErrMirrorDuplicated, mirror.URL)
+		}
+		urls[mirror.URL] = true
+	}
+
+	if signing := bs.Image.Signing; signing != nil && (signing.KeyRef == "") == (signing.Keyless == nil) {
+		return ErrSigningMethodInvalid
+	}
+
+	if scan := bs.Image.Scan; scan != nil && scan.Database.ClaimName == "" {
+		return ErrScanDatabaseMissing
+	}
+
+	if err := validateCredentials(bs.RegistryCredentials, CredentialTypeBasicAuth, CredentialTypeDockerConfig); err != nil {
+		return err
+	}
+
+	return validateCredentials(bs.RepositoryCredentials, CredentialTypeBasicAuth, CredentialTypeSSH, CredentialTypeGitHubApp)
+}
+
+func validateCredentials(credentials []CredentialSpec, types ...CredentialType) error {
+	hosts := map[string]bool{}
+	for _, credential := range credentials {
+		if credential.Host == "" {
+			return ErrCredentialHostMissing
+		}
+
+		if credential.SecretRef == "" {
+			return fmt.Errorf("%w: %s", ErrCredentialSecretMissing, credential.Host)
+		}
+
+		if !credential.Type.in(types) {
+			return fmt.Errorf("%w: %s for %s", ErrCredentialTypeUnsupported, credential.Type, credential.Host)
+		}
+
+		if hosts[credential.Host] {
+			return fmt.Errorf("%w: %s", ErrCredentialDuplicated, credential.Host)
+		}
+		hosts[credential.Host] = true
+	}
+
+	return nil
+}
+
+func (r *RepositorySpec) validate() error {
+	sources := map[SourceType]bool{
+		SourceTypeGit:       r.Git != nil,
+		SourceTypeTarball:   r.Tarball != nil,
+		SourceTypeOCI:       r.OCI != nil,
+		SourceTypeConfigMap: r.ConfigMap != nil,
+	}
+
+	sourceType := r.GetType()
+	if r.hasLegacyFields() {
+		return fmt.Errorf("%w: the deprecated git fields are set along with %s", ErrSourceAmbiguous, sourceType)
+	}
+
+	if !sources[sourceType] {
+		return fmt.Errorf("%w: %s", ErrSourceMissing, sourceType)
+	}
+
+	for other, set := range sources {
+		if set && other != sourceType {
+			return fmt.Errorf("%w: %s is set for a %s repository", ErrSourceAmbiguous, other, sourceType)
+		}
+	}
+
+	switch sourceType {
+	case SourceTypeGit:
+		return r.Git.Reference.validate()
+	case SourceTypeTarball:
+		if checksum, err := hex.DecodeString(r.Tarball.Checksum); err != nil || len(checksum) != sha256.Size {
+			return fmt.Errorf("%w: %s", ErrTarballChecksumInvalid, r.Tarball.Checksum)
+		}
+	}
+
+	return nil
+}
+
+func (ref *GitReference) validate() error {
+	if ref.Name == "" && ref.Hash == "" {
+		return ErrGitReferenceMissing
+	}
+
+	if ref.Hash == "" {
+		return nil
+	}
+
+	if _, err := hex.DecodeString(ref.Hash); err != nil || len(ref.Hash) != 40 {
+		return fmt.Errorf("%w: %s", ErrGitReferenceHashInvalid, ref.Hash)
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	core "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Build", func() {
+	Context("Arguments", func() {
+		It("requires every argument to be unique", func() {
+			build := &Build{Spec: BuildSpec{
+				Arguments: []BuildArgument{{Name: "RAILS_ENV", Value: "test"}, {Name: "RAILS_ENV", Value: "production"}},
+			}}
+			_, err := build.ValidateCreate()
+			Expect(err).To(MatchError(ErrBuildArgumentDuplicated))
+		})
+	})
+
+	Context("Secrets", func() {
+		It("requires a reference to a secret key", func() {
+			build := &Build{Spec: BuildSpec{
+				Secrets: []BuildSecret{{Name: "npmrc", ValueFrom: core.SecretKeySelector{
+					LocalObjectReference: core.LocalObjectReference{Name: "npm"},
+				}}},
+			}}
+			_, err := build.ValidateCreate()
+			Expect(err).To(MatchError(ErrBuildSecretReferenceMissing))
+		})
+	})
+
+	Context("Credentials", func() {
+		It("requires a host and a secret for each credential", func() {
+			build := &Build{Spec: BuildSpec{
+				RegistryCredentials: []CredentialSpec{{SecretRef: "registry"}},
+			}}
+			_, err := build.ValidateCreate()
+			Expect(err).To(MatchError(ErrCredentialHostMissing))
+
+			build.Spec.RegistryCredentials = []CredentialSpec{{Host: "ghcr.io"}}
+			_, err = build.ValidateCreate()
+			Expect(err).To(MatchError(ErrCredentialSecretMissing))
+		})
+
+		It("only accepts basic-auth and docker-config credentials for registries", func() {
+			build := &Build{Spec: BuildSpec{
+				RegistryCredentials: []CredentialSpec{{Host: "ghcr.io", SecretRef: "registry", Type: CredentialTypeSSH}},
+			}}
+			_, err := build.ValidateCreate()
+			Expect(err).To(MatchError(ErrCredentialTypeUnsupported))
+
+			build.Spec.RegistryCredentials = []CredentialSpec{{Host: "ghcr.io", SecretRef: "registry", Type: CredentialTypeDockerConfig}}
+			_, err = build.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+
+			build.Spec.RepositoryCredentials = []CredentialSpec{{Host: "github.com", SecretRef: "registry", Type: CredentialTypeDockerConfig}}
+			_, err = build.ValidateCreate()
+			Expect(err).To(MatchError(ErrCredentialTypeUnsupported))
+
+			build.Spec.RegistryCredentials = nil
+			build.Spec.RepositoryCredentials = []CredentialSpec{{Host: "git@github.com:releasehub-com/spot.git", SecretRef: "deploy-key", Type: CredentialTypeSSH}}
+			_, err = build.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("accepts a valid spec", func() {
+			build := &Build{Spec: BuildSpec{
+				Arguments:             []BuildArgument{{Name: "RAILS_ENV", Value: "test"}},
+				RegistryCredentials:   []CredentialSpec{{Host: "ghcr.io", SecretRef: "registry"}},
+				RepositoryCredentials: []CredentialSpec{{Host: "https://github.com/releasehub-com/spot", SecretRef: "github"}},
+			}}
+			_, err := build.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("Mirrors", func() {
+		It("requires a URL for each mirror", func() {
+			build := &Build{Spec: BuildSpec{Image: ImageSpec{
+				Registry: RegistrySpec{URL: "ghcr.io/releasehub-com/spot"},
+				Mirrors:  []RegistrySpec{{Tags: []string{"latest"}}},
+			}}}
+			_, err := build.ValidateCreate()
+			Expect(err).To(MatchError(ErrMirrorURLMissing))
+		})
+
+		It("doesn't push the image twice to the same URL", func() {
+			build := &Build{Spec: BuildSpec{Image: ImageSpec{
+				Registry: RegistrySpec{URL: "ghcr.io/releasehub-com/spot"},
+				Mirrors:  []RegistrySpec{{URL: "ghcr.io/releasehub-com/spot"}},
+			}}}
+			_, err := build.ValidateCreate()
+			Expect(err).To(MatchError(ErrMirrorDuplicated))
+
+			build.Spec.Image.Mirrors = []RegistrySpec{{URL: "docker.io/releasehub/spot"}, {URL: "123456789012.dkr.ecr.us-east-1.amazonaws.com/spot"}}
+			_, err = build.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("Signing", func() {
+		It("requires either a key or keyless signing", func() {
+			build := &Build{Spec: BuildSpec{Image: ImageSpec{Signing: &SigningSpec{}}}}
+			_, err := build.ValidateCreate()
+			Expect(err).To(MatchError(ErrSigningMethodInvalid))
+
+			build.Spec.Image.Signing = &SigningSpec{KeyRef: "cosign", Keyless: &KeylessSigningSpec{}}
+			_, err = build.ValidateCreate()
+			Expect(err).To(MatchError(ErrSigningMethodInvalid))
+
+			build.Spec.Image.Signing = &SigningSpec{KeyRef: "cosign"}
+			_, err = build.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+
+			build.Spec.Image.Signing = &SigningSpec{Keyless: &KeylessSigningSpec{}}
+			_, err = build.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("Scan", func() {
+		It("requires the vulnerability database", func() {
+			build := &Build{Spec: BuildSpec{Image: ImageSpec{Scan: &ScanSpec{Threshold: SeverityHigh}}}}
+			_, err := build.ValidateCreate()
+			Expect(err).To(MatchError(ErrScanDatabaseMissing))
+
+			build.Spec.Image.Scan.Database = ScanDatabaseSpec{ClaimName: "trivy-cache"}
+			_, err = build.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("Repository", func() {
+		It("requires the source of its type", func() {
+			build := &Build{Spec: BuildSpec{Image: ImageSpec{Repository: &RepositorySpec{}}}}
+			_, err := build.ValidateCreate()
+			Expect(err).To(MatchError(ErrSourceMissing))
+
+			build.Spec.Image.Repository.Type = SourceTypeConfigMap
+			build.Spec.Image.Repository.ConfigMap = &ConfigMapSource{Name: "context"}
+			_, err = build.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("only accepts the source of its type", func() {
+			build := &Build{Spec: BuildSpec{Image: ImageSpec{Repository: &RepositorySpec{
+				Type:      SourceTypeOCI,
+				OCI:       &OCIArtifactSource{Reference: "ghcr.io/releasehub-com/spot-source:v1"},
+				ConfigMap: &ConfigMapSource{Name: "context"},
+			}}}}
+			_, err := build.ValidateCreate()
+			Expect(err).To(MatchError(ErrSourceAmbiguous))
+		})
+
+		It("moves the deprecated git fields to the git source", func() {
+			depth := int32(0)
+			build := &Build{Spec: BuildSpec{Image: ImageSpec{Repository: &RepositorySpec{
+				Context:    "app",
+				URL:        "https://github.com/releasehub-com/spot.git",
+				Reference:  &GitReference{Name: "main"},
+				Depth:      &depth,
+				Submodules: true,
+			}}}}
+			build.Default()
+
+			Expect(build.Spec.Image.Repository).To(Equal(&RepositorySpec{
+				Context: "app",
+				Git: &GitSource{
+					URL:        "https://github.com/releasehub-com/spot.git",
+					Reference:  GitReference{Name: "main"},
+					Depth:      &depth,
+					Submodules: true,
+				},
+			}))
+			_, err := build.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects the deprecated git fields along with a source", func() {
+			build := &Build{Spec: BuildSpec{Image: ImageSpec{Repository: &RepositorySpec{
+				URL: "https://github.com/releasehub-com/spot.git",
+				Git: &GitSource{URL: "https://github.com/releasehub-com/spot.git", Reference: GitReference{Name: "main"}},
+			}}}}
+			build.Default()
+
+			_, err := build.ValidateCreate()
+			Expect(err).To(MatchError(ErrSourceAmbiguous))
+		})
+
+		It("requires a SHA256 checksum for tarballs", func() {
+			build := &Build{Spec: BuildSpec{Image: ImageSpec{Repository: &RepositorySpec{
+				Type:    SourceTypeTarball,
+				Tarball: &TarballSource{URL: "https://example.com/source.tar.gz", Checksum: "abc"},
+			}}}}
+			_, err := build.ValidateCreate()
+			Expect(err).To(MatchError(ErrTarballChecksumInvalid))
+
+			build.Spec.Image.Repository.Tarball.Checksum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+			_, err = build.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("Reference", func() {
+		It("requires a name or a hash", func() {
+			build := &Build{Spec: BuildSpec{Image: ImageSpec{Repository: &RepositorySpec{Git: &GitSource{}}}}}
+			_, err := build.ValidateCreate()
+			Expect(err).To(MatchError(ErrGitReferenceMissing))
+
+			build.Spec.Image.Repository.Git.Reference = GitReference{Name: "refs/pull/123/head"}
+			_, err = build.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+
+			build.Spec.Image.Repository.Git.Reference = GitReference{Hash: "0d1d9a4f2bd5e1b4a1f3e4c9d8b8a6e0f9c2b7a1"}
+			_, err = build.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("requires the full commit SHA", func() {
+			build := &Build{Spec: BuildSpec{Image: ImageSpec{Repository: &RepositorySpec{Git: &GitSource{
+				Reference: GitReference{Name: "v1.2.0", Hash: "0d1d9a4"},
+			}}}}}
+			_, err := build.ValidateCreate()
+			Expect(err).To(MatchError(ErrGitReferenceHashInvalid))
+		})
+	})
+
+	Context("Retry", func() {
+		It("renames the legacy condition types", func() {
+			build := &Build{Spec: BuildSpec{Retry: &BuildRetryPolicy{
+				MaxAttempts:         2,
+				RetryableConditions: []BuildConditionType{"Pod Deployment", BuildConditionBuilding, "Uploading Build to remote registry"},
+			}}}
+			build.Default()
+
+			Expect(build.Spec.Retry.RetryableConditions).To(Equal([]BuildConditionType{
+				BuildConditionDeployPod, BuildConditionBuilding, BuildConditionRegistry,
+			}))
+		})
+	})
+
+	Context("Cancel", func() {
+		It("doesn't allow a cancelled build to be resumed", func() {
+			previous := &Build{Spec: BuildSpec{Cancel: true}}
+			build := &Build{}
+			_, err := build.ValidateUpdate(previous)
+			Expect(err).To(MatchError(ErrBuildCancelReverted))
+
+			build.Spec.Cancel = true
+			_, err = build.ValidateUpdate(previous)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,128 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BuilderPodSpec configures the pod that runs a build. It's used cluster-wide
+// by the BuilderConfig and can be overridden for a single build with `BuildSpec.Builder`.
+// Any field left empty uses the value from the level above it.
+type BuilderPodSpec struct {
+	// Resources of the container running the builder.
+	// +optional
+	BuilderResources *core.ResourceRequirements `json:"builderResources,omitempty"`
+
+	// Resources of the container running buildkitd. This is the container
+	// doing the actual build and generally needs the most memory.
+	// +optional
+	BuildkitResources *core.ResourceRequirements `json:"buildkitResources,omitempty"`
+
+	// Image used for the buildkitd container (ie. moby/buildkit:v0.12.0).
+	// +optional
+	BuildkitImage string `json:"buildkitImage,omitempty"`
+
+	// Pull policy for the builder and buildkitd images.
+	// +optional
+	ImagePullPolicy core.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// Tolerations of the pod, useful to schedule builds on a dedicated node pool.
+	// +optional
+	Tolerations []core.Toleration `json:"tolerations,omitempty"`
+
+	// NodeSelector of the pod, useful to schedule builds on a dedicated node pool.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// PriorityClassName of the pod.
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// ServiceAccountName the pod runs as. The service account needs to be able
+	// to update builds and create config maps in the build's namespace.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+}
+
+// Returns a copy of the spec where every field set in the override
+// replaces the value of this spec.
+func (s BuilderPodSpec) Merge(override *BuilderPodSpec) BuilderPodSpec {
+	if override == nil {
+		return s
+	}
+
+	if override.BuilderResources != nil {
+		s.BuilderResources = override.BuilderResources
+	}
+
+	if override.BuildkitResources != nil {
+		s.BuildkitResources = override.BuildkitResources
+	}
+
+	if override.BuildkitImage != "" {
+		s.BuildkitImage = override.BuildkitImage
+	}
+
+	if override.ImagePullPolicy != "" {
+		s.ImagePullPolicy = override.ImagePullPolicy
+	}
+
+	if override.Tolerations != nil {
+		s.Tolerations = override.Tolerations
+	}
+
+	if override.NodeSelector != nil {
+		s.NodeSelector = override.NodeSelector
+	}
+
+	if override.PriorityClassName != "" {
+		s.PriorityClassName = override.PriorityClassName
+	}
+
+	if override.ServiceAccountName != "" {
+		s.ServiceAccountName = override.ServiceAccountName
+	}
+
+	return s
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// BuilderConfig is the cluster-wide configuration of the pods running builds. The
+// operator uses the BuilderConfig named after its `--builder-config` flag.
+type BuilderConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec BuilderPodSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// BuilderConfigList contains a list of BuilderConfig
+type BuilderConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []BuilderConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&BuilderConfig{}, &BuilderConfigList{})
+}
@@ -0,0 +1,33 @@
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	core "k8s.io/api/core/v1"
+)
+
+var _ = Describe("BuilderPodSpec", func() {
+	It("keeps its values when there's no override", func() {
+		spec := BuilderPodSpec{BuildkitImage: "moby/buildkit:v0.12.0"}
+		Expect(spec.Merge(nil)).To(Equal(spec))
+	})
+
+	It("replaces the fields set in the override", func() {
+		spec := BuilderPodSpec{
+			BuildkitImage:      "moby/buildkit:v0.12.0",
+			ServiceAccountName: "spot-controller-manager",
+			NodeSelector:       map[string]string{"pool": "default"},
+		}
+
+		merged := spec.Merge(&BuilderPodSpec{
+			BuildkitImage: "moby/buildkit:v0.12.1",
+			NodeSelector:  map[string]string{"pool": "builds"},
+			Tolerations:   []core.Toleration{{Key: "pool", Value: "builds"}},
+		})
+
+		Expect(merged.BuildkitImage).To(Equal("moby/buildkit:v0.12.1"))
+		Expect(merged.ServiceAccountName).To(Equal("spot-controller-manager"))
+		Expect(merged.NodeSelector).To(HaveKeyWithValue("pool", "builds"))
+		Expect(merged.Tolerations).To(HaveLen(1))
+	})
+})
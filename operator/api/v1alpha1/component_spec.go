@@ -26,6 +26,25 @@ type ComponentSpec struct {
 	// The workspace will aggregate all the images at build time and
 	// will deduplicate the images so only 1 unique image is built.
 	Image ImageSpec `json:"image"`
+
+	// Arguments passed to the build of the component's image (`--build-arg`).
+	// These values are stored in plain text, anything sensitive
+	// should be passed as a secret instead.
+	// +optional
+	Arguments []BuildArgument `json:"arguments,omitempty"`
+
+	// Secrets exposed to the build of the component's image as secret mounts. The
+	// secrets they reference need to exist within the namespace of the workspace.
+	// +optional
+	Secrets []BuildSecret `json:"secrets,omitempty"`
+
+	// Credentials used to push the component's image to the registry.
+	// +optional
+	RegistryCredentials []CredentialSpec `json:"registryCredentials,omitempty"`
+
+	// Credentials used to clone the component's repository.
+	// +optional
+	RepositoryCredentials []CredentialSpec `json:"repositoryCredentials,omitempty"`
 }
 
 func (c *ComponentSpec) GetEnvVars() []core.EnvVar {
@@ -16,15 +16,85 @@ limitations under the License.
 
 package v1alpha1
 
-type ConditionStatus string
+import meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+// The conditions of Builds and Workspaces are standard metav1.Conditions, each of them represents a task.
+// A task succeeded when its condition is True and failed when it's False. While the condition is Unknown,
+// its reason tells where the task is at. Tasks can set more specific reasons when they know why a condition failed.
 const (
-	ConditionInitialized ConditionStatus = "Initialized"
-	ConditionInProgress  ConditionStatus = "In Progress"
-	ConditionSuccess     ConditionStatus = "Success"
-	ConditionWaiting     ConditionStatus = "Waiting"
-	ConditionError       ConditionStatus = "Error"
-
-	// Used to determine if a condition should be skipped.
-	ConditionSkipping ConditionStatus = "Skipping"
+	ConditionReasonInitialized = "Initialized"
+	ConditionReasonWaiting     = "Waiting"
+	ConditionReasonStarted     = "Started"
+	ConditionReasonSucceeded   = "Succeeded"
+	ConditionReasonFailed      = "Failed"
 )
+
+// Set the condition in the conditions. If a condition of the same type already exists, it's replaced. The
+// LastTransitionTime is only updated when the status of the condition changes, it's the time the reconciler
+// set the condition in memory, not to be confused with the time the condition was committed to the API.
+func setCondition(conditions *[]meta.Condition, condition meta.Condition) {
+	if condition.LastTransitionTime.IsZero() {
+		condition.LastTransitionTime = meta.Now()
+	}
+
+	for i, c := range *conditions {
+		if c.Type == condition.Type {
+			if c.Status == condition.Status {
+				condition.LastTransitionTime = c.LastTransitionTime
+			} else if condition.LastTransitionTime.Equal(&c.LastTransitionTime) {
+				condition.LastTransitionTime = meta.Now()
+			}
+			(*conditions)[i] = condition
+			return
+		}
+	}
+
+	*conditions = append(*conditions, condition)
+}
+
+// Statuses of the conditions stored before the conditions were metav1.Conditions, along with
+// the status and reason they translate to.
+var kLegacyConditionStatuses = map[meta.ConditionStatus]struct {
+	status meta.ConditionStatus
+	reason string
+}{
+	"Initialized": {meta.ConditionUnknown, ConditionReasonInitialized},
+	"Waiting":     {meta.ConditionUnknown, ConditionReasonWaiting},
+	"In Progress": {meta.ConditionUnknown, ConditionReasonStarted},
+	"Success":     {meta.ConditionTrue, ConditionReasonSucceeded},
+	"Error":       {meta.ConditionFalse, ConditionReasonFailed},
+}
+
+// Convert the conditions stored before the conditions were metav1.Conditions, in place. Their types are
+// renamed with the given types and their statuses translated, so the status passes the validation of the
+// CRD the next time it's updated. Returns true if any condition was converted.
+func migrateConditions(conditions []meta.Condition, types map[string]string) bool {
+	migrated := false
+	for i := range conditions {
+		condition := &conditions[i]
+		if renamed, ok := types[condition.Type]; ok {
+			condition.Type = renamed
+			migrated = true
+		}
+
+		if legacy, ok := kLegacyConditionStatuses[condition.Status]; ok {
+			condition.Status = legacy.status
+			if condition.Reason == "" {
+				condition.Reason = legacy.reason
+			}
+			migrated = true
+		}
+
+		if condition.Reason == "" {
+			condition.Reason = ConditionReasonInitialized
+			migrated = true
+		}
+
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = meta.Now()
+			migrated = true
+		}
+	}
+
+	return migrated
+}
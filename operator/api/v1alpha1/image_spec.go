@@ -1,5 +1,9 @@
 package v1alpha1
 
+import (
+	core "k8s.io/api/core/v1"
+)
+
 type ImageSpec struct {
 	// Repository information is passed down to buildkit
 	// as instruction on how to proceed with the repository.
@@ -12,31 +16,340 @@ type ImageSpec struct {
 	// be pushed successfully. A build is pushed to the registry only
 	// if the `RepositoryContext` exists with this `Registry`
 	Registry RegistrySpec `json:"registry,omitempty"`
+
+	// Mirrors are additional registries the image is pushed to, along with the `Registry`.
+	// The same image is pushed to every registry concurrently, the credentials of each registry
+	// are looked up by its host. Only the URL and the tags of a mirror are used, the image
+	// is built once for the target of the `Registry`. Workspaces deploy the image from the `Registry`.
+	// A mirror the image couldn't be pushed to doesn't fail the build, its error is recorded in the build's status.
+	// +optional
+	Mirrors []RegistrySpec `json:"mirrors,omitempty"`
+
+	// Platforms the image needs to be built for, using the `os/arch[/variant]`
+	// format (ie. linux/amd64, linux/arm64). If more than one platform is set, the
+	// image pushed to the registry is an index with a manifest for each of the platforms.
+	// When empty, the image is built for the platform of the node the builder runs on.
+	// +optional
+	Platforms []string `json:"platforms,omitempty"`
+
+	// Attestations BuildKit generates for the image. The attestations are pushed along
+	// with the image, as an attestation manifest for each of its platforms.
+	// +optional
+	Attestations *AttestationSpec `json:"attestations,omitempty"`
+
+	// Signing signs the image with cosign once it's pushed to the registry and its mirrors.
+	// +optional
+	Signing *SigningSpec `json:"signing,omitempty"`
+
+	// Scan scans the image for vulnerabilities before it's pushed. The scan only fails
+	// the build, and the image isn't pushed, when the image has vulnerabilities at or above the threshold.
+	// +optional
+	Scan *ScanSpec `json:"scan,omitempty"`
+}
+
+// Severity of a vulnerability, from the least to the most severe.
+// +kubebuilder:validation:Enum=Low;Medium;High;Critical
+type Severity string
+
+const (
+	SeverityUnknown  Severity = "Unknown"
+	SeverityLow      Severity = "Low"
+	SeverityMedium   Severity = "Medium"
+	SeverityHigh     Severity = "High"
+	SeverityCritical Severity = "Critical"
+)
+
+// Severities ordered from the least to the most severe.
+var Severities = []Severity{SeverityUnknown, SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical}
+
+// AtLeast returns true if the severity is as severe as the other severity, or more.
+func (s Severity) AtLeast(other Severity) bool {
+	return s.rank() >= other.rank()
+}
+
+func (s Severity) rank() int {
+	for i, severity := range Severities {
+		if severity == s {
+			return i
+		}
+	}
+
+	return 0
+}
+
+type ScanSpec struct {
+	// Database is the volume holding trivy's vulnerability database the image is scanned against. The
+	// scan doesn't reach out to any service, the database is kept up to date outside of the build.
+	Database ScanDatabaseSpec `json:"database"`
+
+	// Threshold is the severity at which a vulnerability fails the build. Without a
+	// threshold, the vulnerabilities are only reported.
+	// +optional
+	Threshold Severity `json:"threshold,omitempty"`
+}
+
+// ScanDatabaseSpec is the volume trivy's database (`trivy.db`) is read from, a PersistentVolumeClaim that
+// a CronJob refreshes with `trivy image --download-db-only --cache-dir <volume>`. The volume is mounted read-only.
+type ScanDatabaseSpec struct {
+	// ClaimName is the name of the PersistentVolumeClaim holding the database. The
+	// claim needs to exist within the same namespace as the build.
+	ClaimName string `json:"claimName"`
+
+	// Path of the database within the volume. Defaults to where trivy
+	// downloads the database in its cache directory.
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+// Path of trivy's database within its cache directory.
+const DefaultScanDatabasePath = "db/trivy.db"
+
+type AttestationSpec struct {
+	// SBOM generates a software bill of materials (SPDX) of the image.
+	// +optional
+	SBOM bool `json:"sbom,omitempty"`
+
+	// Provenance generates the SLSA provenance of the build.
+	// +optional
+	Provenance bool `json:"provenance,omitempty"`
+}
+
+// SigningSpec describes how the image is signed. Exactly one of KeyRef and Keyless needs to be set.
+// The signature is pushed next to the image, in the same repository, the way cosign does.
+type SigningSpec struct {
+	// KeyRef is the name of the Secret holding the cosign key pair, in the namespace of the
+	// build. The secret needs the `cosign.key` and `cosign.password` keys, like the secrets
+	// created by `cosign generate-key-pair k8s://<namespace>/<name>`.
+	// +optional
+	KeyRef string `json:"keyRef,omitempty"`
+
+	// Keyless signs with a short-lived certificate issued by Fulcio for the identity of the
+	// builder's service account. The signature is recorded in Rekor's transparency log.
+	// +optional
+	Keyless *KeylessSigningSpec `json:"keyless,omitempty"`
+}
+
+type KeylessSigningSpec struct {
+	// URL of the Fulcio instance issuing the certificates.
+	// +kubebuilder:default:="https://fulcio.sigstore.dev"
+	// +optional
+	FulcioURL string `json:"fulcioURL,omitempty"`
+
+	// URL of the Rekor instance where the signatures are recorded.
+	// +kubebuilder:default:="https://rekor.sigstore.dev"
+	// +optional
+	RekorURL string `json:"rekorURL,omitempty"`
+
+	// Audience of the service account token exchanged with Fulcio for a certificate.
+	// +kubebuilder:default:=sigstore
+	// +optional
+	Audience string `json:"audience,omitempty"`
 }
 
+// Keys of the Secret referenced by a SigningSpec's KeyRef.
+const (
+	SigningKeyKey      = "cosign.key"
+	SigningPasswordKey = "cosign.password"
+)
+
+// Sigstore's public instances, used when the KeylessSigningSpec doesn't set them.
+const (
+	DefaultFulcioURL       = "https://fulcio.sigstore.dev"
+	DefaultRekorURL        = "https://rekor.sigstore.dev"
+	DefaultSigningAudience = "sigstore"
+)
+
+// Type of source the image is built from.
+type SourceType string
+
+const (
+	SourceTypeGit       SourceType = "git"
+	SourceTypeTarball   SourceType = "tarball"
+	SourceTypeOCI       SourceType = "oci"
+	SourceTypeConfigMap SourceType = "configMap"
+)
+
+// RepositorySpec describes where the source of the image comes from. It's a union
+// where the Type selects which of the members is used, only that member can be set.
 type RepositorySpec struct {
-	// Location of your Dockerfile within the repository.
-	Dockerfile string `json:"dockerfile"`
+	// Type of the source. The member with the matching name
+	// holds the configuration of the source.
+	// +unionDiscriminator
+	// +kubebuilder:validation:Enum=git;tarball;oci;configMap
+	// +kubebuilder:default:=git
+	// +optional
+	Type SourceType `json:"type,omitempty"`
+
+	// Location of your Dockerfile within the source. The path is relative
+	// to the root of the source, not the context, which means the Dockerfile
+	// can live outside of the build context.
+	// If empty, the builder looks for a `Dockerfile` at the root of the context.
+	// +optional
+	Dockerfile string `json:"dockerfile,omitempty"`
 
-	// It's the location for the content of your build within the repository.
+	// It's the location for the content of your build within the source.
 	Context string `json:"context"`
 
+	// Git repository to clone.
+	// +optional
+	Git *GitSource `json:"git,omitempty"`
+
+	// Tarball downloaded over HTTP(S).
+	// +optional
+	Tarball *TarballSource `json:"tarball,omitempty"`
+
+	// OCI artifact pulled from a registry.
+	// +optional
+	OCI *OCIArtifactSource `json:"oci,omitempty"`
+
+	// ConfigMap in the namespace of the build.
+	// +optional
+	ConfigMap *ConfigMapSource `json:"configMap,omitempty"`
+
+	// Repositories created before the sources were a union have the fields of
+	// the git repository inline, they are moved to Git when the repository is defaulted.
+
+	// Deprecated: use Git.URL instead.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// Deprecated: use Git.Reference instead.
+	// +optional
+	Reference *GitReference `json:"reference,omitempty"`
+
+	// Deprecated: use Git.Depth instead.
+	// +optional
+	Depth *int32 `json:"depth,omitempty"`
+
+	// Deprecated: use Git.SparseCheckout instead.
+	// +optional
+	SparseCheckout bool `json:"sparseCheckout,omitempty"`
+
+	// Deprecated: use Git.Submodules instead.
+	// +optional
+	Submodules bool `json:"submodules,omitempty"`
+
+	// Deprecated: use Git.LFS instead.
+	// +optional
+	LFS bool `json:"lfs,omitempty"`
+}
+
+// GetType returns the type of the source, a repository without
+// a type is a git repository.
+func (r *RepositorySpec) GetType() SourceType {
+	if r.Type == "" {
+		return SourceTypeGit
+	}
+
+	return r.Type
+}
+
+// Default moves the deprecated git fields of the repository to its Git source
+// when the repository doesn't have one already.
+func (r *RepositorySpec) Default() {
+	if r.GetType() != SourceTypeGit || r.Git != nil || !r.hasLegacyFields() {
+		return
+	}
+
+	r.Git = &GitSource{
+		URL:            r.URL,
+		Depth:          r.Depth,
+		SparseCheckout: r.SparseCheckout,
+		Submodules:     r.Submodules,
+		LFS:            r.LFS,
+	}
+
+	if r.Reference != nil {
+		r.Git.Reference = *r.Reference
+	}
+
+	r.URL = ""
+	r.Reference = nil
+	r.Depth = nil
+	r.SparseCheckout = false
+	r.Submodules = false
+	r.LFS = false
+}
+
+func (r *RepositorySpec) hasLegacyFields() bool {
+	return r.URL != "" || r.Reference != nil || r.Depth != nil || r.SparseCheckout || r.Submodules || r.LFS
+}
+
+type GitSource struct {
 	// URL of the repository
 	URL string `json:"url"`
 
 	// Reference Hash
 	Reference GitReference `json:"reference"`
+
+	// Depth of the history fetched for the commit. A depth of 1 only fetches the commit
+	// itself, which is the fastest for large repositories. If the server doesn't allow fetching
+	// a commit directly, the whole history of the branch is fetched instead. Zero always
+	// fetches the whole history.
+	// +kubebuilder:default:=1
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	Depth *int32 `json:"depth,omitempty"`
+
+	// SparseCheckout only checks out the build context and the directory
+	// of the Dockerfile instead of the whole repository.
+	// +optional
+	SparseCheckout bool `json:"sparseCheckout,omitempty"`
+
+	// Submodules are initialized and checked out recursively when enabled.
+	// +optional
+	Submodules bool `json:"submodules,omitempty"`
+
+	// LFS downloads the Git LFS objects of the files that are checked out. Only
+	// repositories cloned over HTTP(S) support LFS.
+	// +optional
+	LFS bool `json:"lfs,omitempty"`
+}
+
+// Default depth used to fetch a repository when the GitSource doesn't set one.
+const DefaultRepositoryDepth = 1
+
+type TarballSource struct {
+	// URL of the tarball. The tarball can be gzip compressed.
+	URL string `json:"url"`
+
+	// SHA256 checksum of the tarball, hex encoded. The build fails
+	// if the downloaded tarball doesn't match the checksum.
+	Checksum string `json:"checksum"`
+}
+
+type OCIArtifactSource struct {
+	// Reference of the artifact in the registry (ie. ghcr.io/org/app-source:v1.2.0). The layers
+	// of the artifact are extracted when they are tarballs, any other layer is written as a file named
+	// after its `org.opencontainers.image.title` annotation. The artifact is pulled with the registry credentials.
+	Reference string `json:"reference"`
+}
+
+type ConfigMapSource struct {
+	// Name of the ConfigMap. The ConfigMap needs to be in the namespace of the build.
+	Name string `json:"name"`
+
+	// Items maps the keys of the ConfigMap to the path of the files they are written to. Without
+	// items, every key of the ConfigMap is written to a file named after the key at the root of the source.
+	// +optional
+	Items []core.KeyToPath `json:"items,omitempty"`
 }
 
 // Represents a reference that is used to checkout a repository
-// for a given commit.
+// for a given commit. At least one of Name or Hash needs to be set.
 type GitReference struct {
-	// Name refers to the name of the branch we're working off of.
-	// It can be master/main or any valid branch present in the remote repository(git)
-	Name string `json:"name"`
+	// Name of the reference to check out. It can be a branch or a tag by their short
+	// name (ie. main, v1.2.0) or any reference by its full name, like refs/pull/123/head
+	// for a pull request opened from a fork.
+	// When the Hash is set, the Name is only used to find the commit if the
+	// server doesn't allow fetching the commit directly.
+	// +optional
+	Name string `json:"name,omitempty"`
 
 	// The Hash represents the commit SHA of the commit that needs to be checked out.
-	Hash string `json:"hash"`
+	// If empty, the commit the Name points to when the build starts is checked out.
+	// +optional
+	Hash string `json:"hash,omitempty"`
 }
 
 type RegistrySpec struct {
@@ -66,3 +379,17 @@ type RegistrySpec struct {
 	// +optional
 	Target *string `json:"target,omitempty"`
 }
+
+// DeployTag returns the tag the image is deployed with: the `Tag` if it's set, otherwise
+// the first of the `Tags`, and `latest` when neither are set.
+func (rs RegistrySpec) DeployTag() string {
+	if rs.Tag != nil && *rs.Tag != "" {
+		return *rs.Tag
+	}
+
+	if len(rs.Tags) != 0 {
+		return rs.Tags[0]
+	}
+
+	return "latest"
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -39,6 +40,11 @@ type ProjectTemplateSpec struct {
 
 	// Defines all the environments that will be needed for this workspace
 	Environments []EnvironmentSpec `json:"environments"`
+
+	// Pull secrets of the workspaces, in the namespace of the project.
+	// Complete description of this field explained in WorkspaceSpec
+	// +optional
+	ImagePullSecrets []core.LocalObjectReference `json:"imagePullSecrets,omitempty"`
 }
 
 // ProjectStatus defines the observed state of Project
@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -72,6 +73,14 @@ type WorkspaceSpec struct {
 	// start with an alphabetic character (no numbers)
 	// +optional
 	Tag string `json:"tag,omitempty"`
+
+	// ImagePullSecrets are `kubernetes.io/dockerconfigjson` secrets, in the namespace of the
+	// workspace, used to pull the images of the components. The images of the components that
+	// aren't built are resolved to a digest with these credentials before being deployed.
+	// The secrets are copied to the namespace of the workspace, and kept in sync, for the
+	// default service account of the namespace to pull the images with.
+	// +optional
+	ImagePullSecrets []core.LocalObjectReference `json:"imagePullSecrets,omitempty"`
 }
 
 type EnvironmentSpec struct {
@@ -90,6 +99,11 @@ type WorkspaceStatus struct {
 	// represent a task that needs to go to completion.
 	Conditions WorkspaceConditions `json:"conditions,omitempty"`
 
+	// ErrorHistory keeps the conditions as they were when they errored, the
+	// most recent last. Only the last `MaxWorkspaceErrorHistory` errors are kept.
+	// +optional
+	ErrorHistory []metav1.Condition `json:"errorHistory,omitempty"`
+
 	// Phase is a high overview of the state of this workspace. It is used as a proxy
 	// to represent the current state of the Workspace with regards to its conditions.
 	// +kubebuilder:default:Running
@@ -103,10 +117,15 @@ type WorkspaceStatus struct {
 	// the Images as they complete.
 	Builds []Reference `json:"builds,omitempty"`
 
-	// Images are seeded by Builds as they are completed. It's
-	// also possible for some services in a workspace to have images that don't
-	// require a build (think database, etc.).
-	Images []BuildImage `json:"images,omitempty"`
+	// BuildProgress aggregates the progress of all the builds for this workspace
+	// while they are running.
+	// +optional
+	BuildProgress *BuildProgress `json:"buildProgress,omitempty"`
+
+	// Images of the components, indexed by the name of the component. They are seeded
+	// by Builds once all of them completed. Components that have images that don't
+	// require a build (think database, etc.) have their tag resolved to a digest at that point.
+	Images map[string]BuildImage `json:"images,omitempty"`
 
 	// References to services that are created for this workspace.
 	// These service are needed to figure out ports mapping for the
@@ -114,6 +133,64 @@ type WorkspaceStatus struct {
 	Services map[string]Reference `json:"services,omitempty"`
 }
 
+// Maximum number of errors kept in the workspace's error history.
+const MaxWorkspaceErrorHistory = 20
+
+// Reason of the errors that are retried automatically, with a backoff.
+const WorkspaceReasonTransientError = "TransientError"
+
+// Annotation that moves a workspace out of the Error phase. The conditions that failed are reset and
+// the workspace is reconciled again from the first failed condition. The annotation is removed once
+// the workspace is reset.
+const WorkspaceRetryAnnotation = "spot.release.com/retry"
+
+// Annotation on the copies of the pull secrets in the namespace of a workspace, set to
+// the secret (namespace/name) they were copied from.
+const WorkspacePullSecretSourceAnnotation = "spot.release.com/pull-secret-source"
+
+// Append the condition to the error history, dropping the oldest errors if
+// the history is full.
+func (ws *WorkspaceStatus) RecordError(condition metav1.Condition) {
+	ws.ErrorHistory = append(ws.ErrorHistory, condition)
+	if overflow := len(ws.ErrorHistory) - MaxWorkspaceErrorHistory; overflow > 0 {
+		ws.ErrorHistory = ws.ErrorHistory[overflow:]
+	}
+}
+
+// Names of the condition types before they followed the conventions of metav1.Condition.
+var kLegacyWorkspaceConditionTypes = map[string]string{
+	"Building Images": string(WorkspaceConditionBuildingImages),
+}
+
+// Convert the conditions and the error history that were stored before the conditions
+// were metav1.Conditions. Returns true if the status needs to be updated.
+func (ws *WorkspaceStatus) MigrateConditions() bool {
+	migrated := migrateConditions(ws.Conditions, kLegacyWorkspaceConditionTypes)
+	if migrateConditions(ws.ErrorHistory, kLegacyWorkspaceConditionTypes) {
+		migrated = true
+	}
+
+	return migrated
+}
+
+// Returns the number of consecutive transient errors at the end of the history for the
+// given condition type. Any other error breaks the sequence, as does the condition changing
+// status after the errors (ie. it succeeded or was reset), the errors belong to a previous attempt.
+func (ws *WorkspaceStatus) TransientErrors(wct WorkspaceConditionType) int {
+	since := ws.Conditions.GetCondition(wct).LastTransitionTime
+
+	count := 0
+	for i := len(ws.ErrorHistory) - 1; i >= 0; i-- {
+		condition := ws.ErrorHistory[i]
+		if condition.Type != string(wct) || condition.Reason != WorkspaceReasonTransientError || condition.LastTransitionTime.Before(&since) {
+			break
+		}
+		count++
+	}
+
+	return count
+}
+
 type WorkspacePhase string
 
 const (
@@ -122,43 +199,32 @@ const (
 	WorkspacePhaseTerminating WorkspacePhase = "Terminating"
 )
 
-type WorkspaceConditions []WorkspaceCondition
+// +listType=map
+// +listMapKey=type
+type WorkspaceConditions []metav1.Condition
 
 // Condition will retrieve a *copy* of the condition if it exists. If it doesn't exists,
 // it will create a new one. In order to persist the condition on the status stack,
 // the condition needs to be applied by calling
 // SetCondition(condition)
-func (w *WorkspaceConditions) GetCondition(wct WorkspaceConditionType) WorkspaceCondition {
+func (w *WorkspaceConditions) GetCondition(wct WorkspaceConditionType) metav1.Condition {
 	for _, c := range *w {
-		if c.Type == wct {
+		if c.Type == string(wct) {
 			return c
 		}
 	}
 
-	return WorkspaceCondition{
-		Type:   wct,
-		Status: ConditionInitialized,
+	return metav1.Condition{
+		Type:   string(wct),
+		Status: metav1.ConditionUnknown,
+		Reason: ConditionReasonInitialized,
 	}
 }
 
-func (w *WorkspaceConditions) SetCondition(condition *WorkspaceCondition) {
-	inserted := false
-
-	if condition.LastTransitionTime.IsZero() {
-		condition.LastTransitionTime = metav1.Now()
-	}
-
-	for i, c := range *w {
-		if c.Type == condition.Type {
-			(*w)[i] = *condition
-			inserted = true
-			break
-		}
-	}
-
-	if !inserted {
-		*w = append(*w, *condition)
-	}
+// SetCondition adds the condition to the stack or replaces the existing condition of the same type. The
+// LastTransitionTime is only updated when the status of the condition changes.
+func (w *WorkspaceConditions) SetCondition(condition *metav1.Condition) {
+	setCondition((*[]metav1.Condition)(w), *condition)
 }
 
 type WorkspaceConditionType string
@@ -169,25 +235,15 @@ type WorkspaceConditionType string
 const (
 	WorkspaceConditionNamespace      WorkspaceConditionType = "Namespace"
 	WorkspaceConditionNetworking     WorkspaceConditionType = "Networking"
-	WorkspaceConditionBuildingImages WorkspaceConditionType = "Building Images"
+	WorkspaceConditionBuildingImages WorkspaceConditionType = "BuildingImages"
 	WorkspaceConditionDeployment     WorkspaceConditionType = "Deployment"
 )
 
-type WorkspaceCondition struct {
-	// Type is the type of the condition and can be think of a task that needs
-	// to run for a workspace to become healthy.
-	Type WorkspaceConditionType `json:"type" protobuf:"bytes,1,opt,name=type,casttype=WorkspaceConditionType"`
-	// Status is the status of the condition.
-	// Can be True, False, Error.
-	Status ConditionStatus `json:"status" protobuf:"bytes,2,opt,name=status,casttype=ConditionStatus"`
-	// Last time the condition transitioned from one status to another.
-	// +optional
-	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty" protobuf:"bytes,4,opt,name=lastTransitionTime"`
-}
-
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Built",type=integer,JSONPath=`.status.buildProgress.completed`,priority=1
+//+kubebuilder:printcolumn:name="Total",type=integer,JSONPath=`.status.buildProgress.total`,priority=1
 
 // Workspace is the Schema for the workspaces API
 type Workspace struct {
@@ -0,0 +1,79 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("WorkspaceStatus", func() {
+	Context("Error history", func() {
+		It("only keeps the most recent errors", func() {
+			status := WorkspaceStatus{}
+			for i := 0; i < MaxWorkspaceErrorHistory+5; i++ {
+				status.RecordError(metav1.Condition{
+					Type:    string(WorkspaceConditionBuildingImages),
+					Status:  metav1.ConditionFalse,
+					Message: fmt.Sprintf("error %d", i),
+				})
+			}
+
+			Expect(status.ErrorHistory).To(HaveLen(MaxWorkspaceErrorHistory))
+			Expect(status.ErrorHistory[0].Message).To(Equal("error 5"))
+		})
+
+		It("counts the consecutive transient errors of a condition", func() {
+			status := WorkspaceStatus{}
+			Expect(status.TransientErrors(WorkspaceConditionNetworking)).To(Equal(0))
+
+			status.RecordError(metav1.Condition{Type: string(WorkspaceConditionNamespace), Reason: WorkspaceReasonTransientError})
+			status.RecordError(metav1.Condition{Type: string(WorkspaceConditionNetworking), Reason: ConditionReasonFailed})
+			status.RecordError(metav1.Condition{Type: string(WorkspaceConditionNetworking), Reason: WorkspaceReasonTransientError})
+			status.RecordError(metav1.Condition{Type: string(WorkspaceConditionNetworking), Reason: WorkspaceReasonTransientError})
+
+			Expect(status.TransientErrors(WorkspaceConditionNetworking)).To(Equal(2))
+			Expect(status.TransientErrors(WorkspaceConditionNamespace)).To(Equal(0))
+		})
+
+		It("doesn't count the transient errors of a previous attempt", func() {
+			failed := metav1.NewTime(time.Now().Add(-time.Hour))
+			status := WorkspaceStatus{}
+			status.RecordError(metav1.Condition{Type: string(WorkspaceConditionNetworking), Reason: WorkspaceReasonTransientError, LastTransitionTime: failed})
+			status.RecordError(metav1.Condition{Type: string(WorkspaceConditionNetworking), Reason: WorkspaceReasonTransientError, LastTransitionTime: failed})
+			Expect(status.TransientErrors(WorkspaceConditionNetworking)).To(Equal(2))
+
+			status.Conditions.SetCondition(&metav1.Condition{Type: string(WorkspaceConditionNetworking), Status: metav1.ConditionTrue})
+			Expect(status.TransientErrors(WorkspaceConditionNetworking)).To(Equal(0))
+
+			status.Conditions.SetCondition(&metav1.Condition{Type: string(WorkspaceConditionNetworking), Status: metav1.ConditionUnknown, Reason: ConditionReasonInitialized})
+			status.RecordError(metav1.Condition{Type: string(WorkspaceConditionNetworking), Reason: WorkspaceReasonTransientError, LastTransitionTime: metav1.Now()})
+			Expect(status.TransientErrors(WorkspaceConditionNetworking)).To(Equal(1))
+		})
+	})
+
+	Context("MigrateConditions", func() {
+		It("converts the conditions and the error history stored before they were metav1.Conditions", func() {
+			status := WorkspaceStatus{
+				Conditions: WorkspaceConditions{
+					{Type: string(WorkspaceConditionNamespace), Status: "Success"},
+					{Type: "Building Images", Status: "Error"},
+				},
+				ErrorHistory: []metav1.Condition{
+					{Type: "Building Images", Status: "Error", Reason: WorkspaceReasonTransientError},
+				},
+			}
+			Expect(status.MigrateConditions()).To(BeTrue())
+
+			Expect(status.Conditions.GetCondition(WorkspaceConditionNamespace).Status).To(Equal(metav1.ConditionTrue))
+			Expect(status.Conditions.GetCondition(WorkspaceConditionNamespace).LastTransitionTime.Time).NotTo(BeZero())
+			Expect(status.Conditions.GetCondition(WorkspaceConditionBuildingImages).Status).To(Equal(metav1.ConditionFalse))
+			Expect(status.Conditions.GetCondition(WorkspaceConditionBuildingImages).Reason).To(Equal(ConditionReasonFailed))
+			Expect(status.TransientErrors(WorkspaceConditionBuildingImages)).To(Equal(1))
+
+			Expect(status.MigrateConditions()).To(BeFalse())
+		})
+	})
+})
@@ -55,6 +55,12 @@ func (r *Workspace) Default() {
 		// so the generator is prefixed with a 'w' for workspace.
 		r.Spec.Tag = fmt.Sprintf("w%s", rand.String(WorkspaceGeneratedTagLength-1))
 	}
+
+	for _, component := range r.Spec.Components {
+		if component.Image.Repository != nil {
+			component.Image.Repository.Default()
+		}
+	}
 }
 
 //+kubebuilder:webhook:path=/validate-spot-release-com-v1alpha1-workspace,mutating=false,failurePolicy=fail,sideEffects=None,groups=spot.release.com,resources=workspaces,verbs=create;update,versions=v1alpha1,name=vworkspace.kb.io,admissionReviewVersions=v1
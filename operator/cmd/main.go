@@ -18,17 +18,25 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/utils/env"
 
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
@@ -53,11 +61,26 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var maxConcurrentBuilds int
+	var maxConcurrentBuildsPerNamespace int
+	var builderConfig string
+	var schedulingDeadline time.Duration
+	var imagePullSecrets string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.IntVar(&maxConcurrentBuilds, "max-concurrent-builds", 0,
+		"Maximum number of builds running at the same time, builds over the limit are queued. Zero means no limit.")
+	flag.IntVar(&maxConcurrentBuildsPerNamespace, "max-concurrent-builds-per-namespace", 0,
+		"Maximum number of builds running at the same time within a namespace. Zero means no limit.")
+	flag.StringVar(&builderConfig, "builder-config", "default",
+		"Name of the cluster-scoped BuilderConfig used to configure the pods running builds.")
+	flag.DurationVar(&schedulingDeadline, "build-scheduling-deadline", 10*time.Minute,
+		"Maximum duration a builder pod can wait to be scheduled, or to pull its images, before the build attempt fails. Zero disables the deadline.")
+	flag.StringVar(&imagePullSecrets, "image-pull-secrets", "",
+		"Comma separated list of dockerconfigjson secrets (namespace/name) copied to the namespace of every workspace.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -66,6 +89,12 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	pullSecrets, err := parsePullSecrets(imagePullSecrets)
+	if err != nil {
+		setupLog.Error(err, "invalid --image-pull-secrets")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -73,6 +102,21 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "44aa80a7.release.com",
+		// Only the pull secrets are watched, the cache doesn't hold any other secret. The client reads the secrets
+		// from the API server so that reading the secrets of a build doesn't cache every secret of the cluster, the
+		// pull secrets are read from the cache. Only the default service accounts, which the pull secrets are
+		// attached to, are cached.
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				&core.Secret{}:         {Field: fields.OneTermEqualSelector("type", string(core.SecretTypeDockerConfigJson))},
+				&core.ServiceAccount{}: {Field: fields.OneTermEqualSelector("metadata.name", "default")},
+			},
+		},
+		Client: client.Options{
+			Cache: &client.CacheOptions{
+				DisableFor: []client.Object{&core.Secret{}},
+			},
+		},
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -94,6 +138,9 @@ func main() {
 		Client:        mgr.GetClient(),
 		Scheme:        mgr.GetScheme(),
 		EventRecorder: mgr.GetEventRecorderFor("workspace"),
+		Cache:         mgr.GetCache(),
+
+		ImagePullSecrets: pullSecrets,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Workspace")
 		os.Exit(1)
@@ -109,6 +156,11 @@ func main() {
 		Client:        mgr.GetClient(),
 		Scheme:        mgr.GetScheme(),
 		EventRecorder: mgr.GetEventRecorderFor("build"),
+
+		MaxConcurrentBuilds:             maxConcurrentBuilds,
+		MaxConcurrentBuildsPerNamespace: maxConcurrentBuildsPerNamespace,
+		BuilderConfig:                   builderConfig,
+		SchedulingDeadline:              schedulingDeadline,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Build")
 		os.Exit(1)
@@ -119,6 +171,11 @@ func main() {
 			setupLog.Error(err, "unable to create webhook", "webhook", "Workspace")
 			os.Exit(1)
 		}
+
+		if err = (&spotv1alpha1.Build{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Build")
+			os.Exit(1)
+		}
 	}
 	//+kubebuilder:scaffold:builder
 
@@ -142,3 +199,22 @@ func main() {
 
 	ctrl.Log.Info("Stopping Receiver")
 }
+
+// Parse the pull secrets of the operator, a comma separated list of `namespace/name`.
+func parsePullSecrets(value string) ([]types.NamespacedName, error) {
+	var secrets []types.NamespacedName
+	for _, secret := range strings.Split(value, ",") {
+		if secret = strings.TrimSpace(secret); secret == "" {
+			continue
+		}
+
+		namespace, name, ok := strings.Cut(secret, "/")
+		if !ok || namespace == "" || name == "" {
+			return nil, fmt.Errorf("%s is not a namespace/name", secret)
+		}
+
+		secrets = append(secrets, types.NamespacedName{Namespace: namespace, Name: name})
+	}
+
+	return secrets, nil
+}
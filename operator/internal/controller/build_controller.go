@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/fields"
@@ -27,6 +28,7 @@ import (
 	"k8s.io/client-go/tools/record"
 
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -42,21 +44,47 @@ import (
 
 var ErrStageWithInvalidState = errors.New("stage did not match the status of the build")
 var ErrPodUnexpectlyFailed = errors.New("pod failed without notifying the build")
+var ErrBuildConditionFailed = errors.New("build condition failed")
+var ErrBuildDeadlineExceeded = errors.New("build exceeded its timeout")
 
 const (
 	kPodStatusField = ".status.pod"
+
+	// Interval at which a queued build checks if a slot is available.
+	kQueueInterval = 15 * time.Second
 )
 
+// Conditions the builder always goes through, the scan is only
+// run when it was requested and registered up front.
+var kBuilderConditions = []spot.BuildConditionType{
+	spot.BuildConditionSource,
+	spot.BuildConditionBuilding,
+	spot.BuildConditionRegistry,
+}
+
 // BuildReconciler reconciles a Build object
 type BuildReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 	record.EventRecorder
+
+	// Limits on the number of builds running at the same time, zero means no limit.
+	MaxConcurrentBuilds             int
+	MaxConcurrentBuildsPerNamespace int
+
+	// Maximum duration a builder pod can stay unscheduled, or keep failing to pull its images,
+	// before the attempt fails. Zero means pods can wait to be scheduled indefinitely.
+	SchedulingDeadline time.Duration
+
+	// Name of the BuilderConfig used to configure builder pods. The
+	// config is optional and defaults are used when it doesn't exist.
+	BuilderConfig string
 }
 
 //+kubebuilder:rbac:groups=spot.release.com,resources=builds,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=spot.release.com,resources=builds/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=spot.release.com,resources=builds/finalizers,verbs=update
+//+kubebuilder:rbac:groups=spot.release.com,resources=builderconfigs,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=pods;secrets,verbs=get;watch;list;create;delete
 
 func (r *BuildReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -70,14 +98,69 @@ func (r *BuildReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 		return ctrl.Result{}, nil
 	}
 
-	// Let's first see if one of the existing condition has failed since that would be unrecoverable
-	// and the reconcilation can be done with this build.
-	if build.Status.Conditions.CurrentPhase() == spot.BuildPhaseError {
+	// The conditions stored before they were metav1.Conditions are converted first, the
+	// status can't be updated otherwise. The update triggers a new reconciliation.
+	if build.Status.MigrateConditions() {
+		return ctrl.Result{}, r.Client.Status().Update(ctx, &build)
+	}
+
+	// A build that is marked as errored either ran out of attempts or failed with an error that can't be
+	// retried, the reconcilation can be done with this build.
+	if build.Status.Phase == spot.BuildPhaseError || build.Status.Phase == spot.BuildPhaseCancelled {
 		return ctrl.Result{}, nil
 	}
 
-	if condition := build.Status.GetCondition(spot.BuildConditionDeployPod); condition.Status == spot.ConditionInitialized {
-		pd := tasks.PodDeployment{Client: r.Client, EventRecorder: r.EventRecorder}
+	// A build that is already done has nothing to cancel.
+	if build.Spec.Cancel && build.Status.Conditions.CurrentPhase() != spot.BuildPhaseDone {
+		return ctrl.Result{}, r.cancel(ctx, &build)
+	}
+
+	// The timeout covers all the attempts, once it's exceeded, the build can't be retried.
+	if build.Status.Conditions.CurrentPhase() != spot.BuildPhaseDone && build.DeadlineExceeded(time.Now()) {
+		if err := r.deletePod(ctx, &build); err != nil {
+			return ctrl.Result{}, r.markBuildHasErrored(ctx, &build, err)
+		}
+
+		return ctrl.Result{}, r.markBuildHasErrored(ctx, &build, ErrBuildDeadlineExceeded)
+	}
+
+	if condition := build.Status.GetCondition(spot.BuildConditionDeployPod); condition.Reason == spot.ConditionReasonInitialized || condition.Reason == spot.ConditionReasonWaiting {
+		// A waiting condition means a previous attempt failed and the build is backing off before
+		// the next attempt is deployed.
+		if condition.Reason == spot.ConditionReasonWaiting {
+			if wait := time.Until(condition.LastTransitionTime.Add(build.RetryBackoff())); wait > 0 {
+				return ctrl.Result{RequeueAfter: wait}, nil
+			}
+		}
+
+		// The pod is only deployed once the build has a slot to run in. Until then, the build is
+		// queued and checks back periodically as there's no event when a slot frees up.
+		queue := tasks.Queue{
+			Client:                          r.Client,
+			MaxConcurrentBuilds:             r.MaxConcurrentBuilds,
+			MaxConcurrentBuildsPerNamespace: r.MaxConcurrentBuildsPerNamespace,
+		}
+		position, err := queue.Position(ctx, &build)
+		if err != nil {
+			return ctrl.Result{}, r.markBuildHasErrored(ctx, &build, err)
+		}
+
+		if position > 0 {
+			if build.Status.Phase == spot.BuildPhaseQueued && build.Status.QueuePosition == position {
+				return ctrl.Result{RequeueAfter: kQueueInterval}, nil
+			}
+
+			build.Status.Phase = spot.BuildPhaseQueued
+			build.Status.QueuePosition = position
+			return ctrl.Result{RequeueAfter: kQueueInterval}, r.Client.Status().Update(ctx, &build)
+		}
+
+		config, err := r.builderConfig(ctx)
+		if err != nil {
+			return ctrl.Result{}, r.markBuildHasErrored(ctx, &build, err)
+		}
+
+		pd := tasks.PodDeployment{Client: r.Client, EventRecorder: r.EventRecorder, Config: config}
 		result, err := pd.Reconcile(ctx, &build, &condition)
 		if err != nil {
 			return result, r.markBuildHasErrored(ctx, &build, err)
@@ -86,6 +169,12 @@ func (r *BuildReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 		return result, nil
 	}
 
+	// One of the condition failed, the attempt is over. Depending on the retry policy,
+	// the build is either attempted again or marked as errored.
+	if build.Status.Conditions.CurrentPhase() == spot.BuildPhaseError {
+		return r.retryOrFail(ctx, &build, ErrBuildConditionFailed)
+	}
+
 	if build.Status.Conditions.CurrentPhase() == spot.BuildPhaseRunning {
 		// Most of the lifecycle of a Build CRD is deferred to the pod that was created during the initialization
 		// process. The only thing to watch out for here is to make sure the pod is either scheduled to run, or is running & healthy.
@@ -93,24 +182,79 @@ func (r *BuildReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 
 		var pod core.Pod
 		err := r.Get(ctx, build.Status.Pod.NamespacedName(), &pod)
-		if err != nil {
+		if err != nil && !k8sErrors.IsNotFound(err) {
 			return ctrl.Result{}, r.markBuildHasErrored(ctx, &build, err)
 		}
 
-		for _, cs := range pod.Status.ContainerStatuses {
-			if cs.State.Terminated != nil && cs.State.Terminated.ExitCode != 0 {
-				condition := build.Status.GetCondition(spot.BuildConditionDeployPod)
-				condition.Status = spot.ConditionError
+		var failure *tasks.PodFailure
+		if k8sErrors.IsNotFound(err) {
+			failure = &tasks.PodFailure{Reason: tasks.PodFailureDeleted, Message: fmt.Sprintf("pod %s doesn't exist anymore", build.Status.Pod.Name)}
+		} else {
+			failure = tasks.ClassifyPod(&pod, r.SchedulingDeadline, time.Now())
+		}
+
+		if failure != nil {
+			condition := build.Status.GetCondition(spot.BuildConditionDeployPod)
+			condition.Status = meta.ConditionFalse
+			condition.Reason = failure.Reason
+			condition.Message = failure.Message
+			condition.ObservedGeneration = build.Generation
+			build.Status.SetCondition(condition)
+			return r.retryOrFail(ctx, &build, fmt.Errorf("%w: %s", ErrPodUnexpectlyFailed, failure))
+		}
+
+		// The builder completes the conditions of the tasks it runs, the pod's own condition is completed
+		// once the builder exited successfully. The build is done if the builder completed every task.
+		if tasks.BuilderSucceeded(&pod) {
+			condition := build.Status.GetCondition(spot.BuildConditionDeployPod)
+			condition.ObservedGeneration = build.Generation
+
+			if !builderCompleted(&build) {
+				failure := &tasks.PodFailure{Reason: tasks.PodFailureIncomplete, Message: fmt.Sprintf("pod %s exited before completing the build", pod.Name)}
+				condition.Status = meta.ConditionFalse
+				condition.Reason = failure.Reason
+				condition.Message = failure.Message
 				build.Status.SetCondition(condition)
-				return ctrl.Result{}, r.markBuildHasErrored(ctx, &build, ErrPodUnexpectlyFailed)
+				return r.retryOrFail(ctx, &build, fmt.Errorf("%w: %s", ErrPodUnexpectlyFailed, failure))
+			}
+
+			condition.Status = meta.ConditionTrue
+			condition.Reason = spot.ConditionReasonSucceeded
+			condition.Message = fmt.Sprintf("Pod %s completed the build", pod.Name)
+			build.Status.SetCondition(condition)
+			build.Status.Phase = spot.BuildPhaseDone
+			return ctrl.Result{}, r.Client.Status().Update(ctx, &build)
+		}
+
+		// Nothing will trigger a reconcile when the timeout or the scheduling deadline elapses, so
+		// the reconciler needs to check back on the build.
+		var requeue time.Duration
+		if build.Spec.Timeout != nil {
+			requeue = time.Until(build.CreationTimestamp.Add(build.Spec.Timeout.Duration))
+		}
+
+		if r.SchedulingDeadline > 0 && pod.Status.Phase == core.PodPending {
+			if wait := time.Until(pod.CreationTimestamp.Add(r.SchedulingDeadline)); wait > 0 && (requeue == 0 || wait < requeue) {
+				requeue = wait
 			}
 		}
+
+		if requeue > 0 {
+			return ctrl.Result{RequeueAfter: requeue}, nil
+		}
 	}
 
 	if build.Status.Conditions.CurrentPhase() == spot.BuildPhaseDone {
 		// The build was successful, since the pod was in charge of maintaining the state of this
 		// custom resource, there isn't anything for the build to do beside doing some housekeeping.
 		// The pod doesn't need to exist anymore.
+		if build.Status.Phase != spot.BuildPhaseDone {
+			build.Status.Phase = spot.BuildPhaseDone
+			if err := r.Client.Status().Update(ctx, &build); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+
 		var pod core.Pod
 		if err := r.Client.Get(ctx, build.Status.Pod.NamespacedName(), &pod); err != nil {
 			if k8sErrors.IsNotFound(err) {
@@ -144,6 +288,11 @@ func (r *BuildReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
+	err = mgr.GetFieldIndexer().IndexField(context.Background(), &spot.Build{}, tasks.QueueStateField, tasks.QueueState)
+	if err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&spot.Build{}).
 		Watches(
@@ -192,6 +341,133 @@ func (r *BuildReconciler) enqueueBuildReconcilerForOwnedPod(ctx context.Context,
 
 func (r *BuildReconciler) markBuildHasErrored(ctx context.Context, build *spot.Build, err error) error {
 	r.EventRecorder.Event(build, "Warning", string(spot.BuildPhaseError), err.Error())
+
+	// The error is recorded on the condition that failed. If none of the conditions failed yet, the error
+	// happened while the reconciler was working on the first condition that isn't successful.
+	condition := build.Status.GetCondition(spot.BuildConditionDeployPod)
+	for _, c := range build.Status.Conditions {
+		if c.Status == meta.ConditionFalse {
+			condition = c
+			break
+		}
+	}
+
+	if condition.Status != meta.ConditionFalse {
+		for _, c := range build.Status.Conditions {
+			if c.Status != meta.ConditionTrue {
+				condition = c
+				break
+			}
+		}
+	}
+
+	condition.Status = meta.ConditionFalse
+	condition.ObservedGeneration = build.Generation
+	if condition.Reason == "" {
+		condition.Reason = spot.ConditionReasonFailed
+	}
+	if condition.Message == "" {
+		condition.Message = err.Error()
+	}
+	build.Status.SetCondition(condition)
+
 	build.Status.Phase = spot.BuildPhaseError
 	return r.Client.Status().Update(ctx, build)
 }
+
+// Returns true if the builder completed every task of the build.
+func builderCompleted(build *spot.Build) bool {
+	for _, conditionType := range kBuilderConditions {
+		if build.Status.GetCondition(conditionType).Status != meta.ConditionTrue {
+			return false
+		}
+	}
+
+	for _, condition := range build.Status.Conditions {
+		if condition.Type != string(spot.BuildConditionDeployPod) && condition.Status != meta.ConditionTrue {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Archive the current attempt and reset the conditions so a new pod is deployed once the backoff elapsed. If
+// the build can't be retried, the build is marked as errored with the given error.
+func (r *BuildReconciler) retryOrFail(ctx context.Context, build *spot.Build, err error) (ctrl.Result, error) {
+	if !build.CanRetry() {
+		return ctrl.Result{}, r.markBuildHasErrored(ctx, build, err)
+	}
+
+	if err := r.deletePod(ctx, build); err != nil {
+		return ctrl.Result{}, r.markBuildHasErrored(ctx, build, err)
+	}
+
+	build.Status.Attempts = append(build.Status.Attempts, spot.BuildAttempt{
+		Pod:        build.Status.Pod,
+		Conditions: build.Status.Conditions,
+		Logs:       build.Status.Logs,
+		FailedAt:   meta.Now(),
+	})
+
+	build.Status.Pod = nil
+	build.Status.Logs = nil
+	build.Status.Progress = nil
+	build.Status.Conditions = nil
+	backoff := build.RetryBackoff()
+	message := fmt.Sprintf("Attempt %d failed (%s), retrying in %s", len(build.Status.Attempts), err, backoff)
+
+	build.Status.SetCondition(meta.Condition{
+		Type:               string(spot.BuildConditionDeployPod),
+		Status:             meta.ConditionUnknown,
+		Reason:             spot.ConditionReasonWaiting,
+		Message:            message,
+		ObservedGeneration: build.Generation,
+	})
+	build.Status.Phase = build.Status.Conditions.CurrentPhase()
+
+	r.EventRecorder.Event(build, "Warning", "Retrying", message)
+
+	return ctrl.Result{RequeueAfter: backoff}, r.Client.Status().Update(ctx, build)
+}
+
+// Stop the build by deleting its pod, the build is then marked as cancelled so
+// it's never reconciled again.
+func (r *BuildReconciler) cancel(ctx context.Context, build *spot.Build) error {
+	if err := r.deletePod(ctx, build); err != nil {
+		return r.markBuildHasErrored(ctx, build, err)
+	}
+
+	r.EventRecorder.Event(build, "Normal", string(spot.BuildPhaseCancelled), "Build was cancelled")
+	build.Status.Phase = spot.BuildPhaseCancelled
+	return r.Client.Status().Update(ctx, build)
+}
+
+// Retrieve the cluster-wide configuration for builder pods. A missing
+// BuilderConfig is not an error, the default configuration is used instead.
+func (r *BuildReconciler) builderConfig(ctx context.Context) (spot.BuilderPodSpec, error) {
+	if r.BuilderConfig == "" {
+		return spot.BuilderPodSpec{}, nil
+	}
+
+	var config spot.BuilderConfig
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: r.BuilderConfig}, &config); err != nil {
+		return spot.BuilderPodSpec{}, client.IgnoreNotFound(err)
+	}
+
+	return config.Spec, nil
+}
+
+// Delete the pod of the current attempt, if any. A pod that is already gone is not an error.
+func (r *BuildReconciler) deletePod(ctx context.Context, build *spot.Build) error {
+	if build.Status.Pod == nil {
+		return nil
+	}
+
+	pod := &core.Pod{ObjectMeta: meta.ObjectMeta{
+		Name:      build.Status.Pod.Name,
+		Namespace: build.Status.Pod.Namespace,
+	}}
+
+	return client.IgnoreNotFound(r.Client.Delete(ctx, pod))
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	tasks "github.com/releasehub-com/spot/operator/internal/tasks/builds"
+)
+
+var _ = Describe("BuildReconciler", func() {
+	var c client.Client
+	var reconciler *BuildReconciler
+	created := time.Now().Add(-time.Hour)
+
+	// Builds are created a minute apart, in the order they are listed.
+	newBuild := func(name string) *spot.Build {
+		build := &spot.Build{
+			ObjectMeta: meta.ObjectMeta{
+				Namespace:         "team",
+				Name:              name,
+				UID:               types.UID(name),
+				CreationTimestamp: meta.NewTime(created),
+			},
+			Spec: spot.BuildSpec{Image: spot.ImageSpec{Repository: &spot.RepositorySpec{Context: ".", Git: &spot.GitSource{
+				URL:       "https://github.com/releasehub-com/spot.git",
+				Reference: spot.GitReference{Name: "main"},
+			}}}},
+		}
+		created = created.Add(time.Minute)
+		return build
+	}
+
+	reconcile := func(name string) *spot.Build {
+		key := types.NamespacedName{Namespace: "team", Name: name}
+		_, err := reconciler.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		var build spot.Build
+		Expect(c.Get(context.TODO(), key, &build)).To(Succeed())
+		return &build
+	}
+
+	// Complete the conditions the way the builder does, then exit the builder container.
+	runBuilder := func(build *spot.Build) {
+		for _, conditionType := range kBuilderConditions {
+			build.Status.SetCondition(meta.Condition{Type: string(conditionType), Status: meta.ConditionTrue, Reason: spot.ConditionReasonSucceeded})
+		}
+		Expect(c.Status().Update(context.TODO(), build)).To(Succeed())
+
+		var pod core.Pod
+		Expect(c.Get(context.TODO(), build.Status.Pod.NamespacedName(), &pod)).To(Succeed())
+		pod.Status.Phase = core.PodSucceeded
+		pod.Status.ContainerStatuses = []core.ContainerStatus{{
+			Name:  pod.Spec.Containers[0].Name,
+			State: core.ContainerState{Terminated: &core.ContainerStateTerminated{ExitCode: 0, Reason: "Completed"}},
+		}}
+		Expect(c.Status().Update(context.TODO(), &pod)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(spot.AddToScheme(scheme)).To(Succeed())
+
+		first, second := newBuild("first"), newBuild("second")
+		c = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithIndex(&spot.Build{}, tasks.QueueStateField, tasks.QueueState).
+			WithObjects(first, second).
+			WithStatusSubresource(first, second, &core.Pod{}).
+			Build()
+
+		reconciler = &BuildReconciler{Client: c, Scheme: scheme, EventRecorder: record.NewFakeRecorder(100), MaxConcurrentBuilds: 1}
+	})
+
+	It("dispatches the next queued build once the running build is done", func() {
+		first := reconcile("first")
+		Expect(first.Status.Pod).NotTo(BeNil())
+		Expect(first.Status.Phase).To(Equal(spot.BuildPhaseRunning))
+
+		second := reconcile("second")
+		Expect(second.Status.Pod).To(BeNil())
+		Expect(second.Status.Phase).To(Equal(spot.BuildPhaseQueued))
+		Expect(second.Status.QueuePosition).To(Equal(1))
+
+		runBuilder(first)
+		first = reconcile("first")
+		Expect(first.Status.GetCondition(spot.BuildConditionDeployPod).Status).To(Equal(meta.ConditionTrue))
+		Expect(first.Status.Phase).To(Equal(spot.BuildPhaseDone))
+
+		second = reconcile("second")
+		Expect(second.Status.Pod).NotTo(BeNil())
+		Expect(second.Status.Phase).To(Equal(spot.BuildPhaseRunning))
+		Expect(second.Status.QueuePosition).To(Equal(0))
+	})
+
+	It("fails the attempt when the builder exits before completing the build", func() {
+		first := reconcile("first")
+
+		var pod core.Pod
+		Expect(c.Get(context.TODO(), first.Status.Pod.NamespacedName(), &pod)).To(Succeed())
+		pod.Status.Phase = core.PodSucceeded
+		Expect(c.Status().Update(context.TODO(), &pod)).To(Succeed())
+
+		first = reconcile("first")
+		Expect(first.Status.Phase).To(Equal(spot.BuildPhaseError))
+		condition := first.Status.GetCondition(spot.BuildConditionDeployPod)
+		Expect(condition.Status).To(Equal(meta.ConditionFalse))
+		Expect(condition.Reason).To(Equal(tasks.PodFailureIncomplete))
+		Expect(condition.Message).To(Equal(fmt.Sprintf("pod %s exited before completing the build", pod.Name)))
+	})
+})
@@ -17,26 +17,50 @@ package controller
 
 import (
 	"context"
+	goerrors "errors"
+	"fmt"
+	"time"
 
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
 	tasks "github.com/releasehub-com/spot/operator/internal/tasks/workspaces"
 )
 
+const (
+	// Number of times a task is retried after a transient error before the workspace is marked as errored.
+	kMaxTransientRetries = 5
+
+	// Backoff before retrying a task that failed with a transient error, it doubles with every retry.
+	kTransientBackoff = 5 * time.Second
+)
+
 // WorkspaceReconciler reconciles a Workspace object
 type WorkspaceReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 	record.EventRecorder
+
+	// Cache of the manager, the pull secrets are read from it as the client doesn't cache secrets.
+	Cache client.Reader
+
+	// Pull secrets copied to the namespace of every workspace, along with the workspace's own.
+	ImagePullSecrets []types.NamespacedName
 }
 
 //+kubebuilder:rbac:groups=spot.release.com,resources=workspaces,verbs=get;list;watch;create;update;patch;delete
@@ -45,6 +69,8 @@ type WorkspaceReconciler struct {
 //+kubebuilder:rbac:groups=spot.release.com,resources=events,verbs=create;patch
 //+kubebuilder:rbac:groups="",resources=namespaces;services,verbs=get;watch;list;create;delete
 //+kubebuilder:rbac:groups="networking.k8s.io",resources=ingresses,verbs=get;watch;list;create;delete
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;watch;list;create;update;delete
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;watch;list;create;update
 
 func (r *WorkspaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
@@ -58,6 +84,12 @@ func (r *WorkspaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, nil
 	}
 
+	// The conditions stored before they were metav1.Conditions are converted first, the
+	// status can't be updated otherwise. The update triggers a new reconciliation.
+	if workspace.Status.MigrateConditions() {
+		return ctrl.Result{}, r.Client.Status().Update(ctx, &workspace)
+	}
+
 	// Ignore everything about this workspace if the workspace is scheduled to be deleted.
 	if !workspace.ObjectMeta.DeletionTimestamp.IsZero() {
 		return r.terminate(ctx, &workspace)
@@ -67,47 +99,71 @@ func (r *WorkspaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	case "":
 		workspace.Status.Phase = spot.WorkspacePhaseRunning
 	case spot.WorkspacePhaseError:
+		if _, ok := workspace.Annotations[spot.WorkspaceRetryAnnotation]; ok {
+			return ctrl.Result{}, r.retry(ctx, &workspace)
+		}
+
 		return ctrl.Result{}, nil
 	}
 
-	if condition := workspace.Status.Conditions.GetCondition(spot.WorkspaceConditionNamespace); condition.Status != spot.ConditionSuccess {
-		namespacer := tasks.Namespacer{Client: r.Client, EventRecorder: r.EventRecorder}
+	// A task that failed with a transient error is retried once its backoff elapsed. Updating the
+	// status to record the error triggers a reconciliation right away, so the backoff is enforced here.
+	if history := workspace.Status.ErrorHistory; len(history) > 0 {
+		last := history[len(history)-1]
+		if retries := workspace.Status.TransientErrors(spot.WorkspaceConditionType(last.Type)); retries > 0 {
+			if wait := time.Until(last.LastTransitionTime.Add(transientBackoff(retries))); wait > 0 {
+				return ctrl.Result{RequeueAfter: wait}, nil
+			}
+		}
+	}
+
+	if condition := workspace.Status.Conditions.GetCondition(spot.WorkspaceConditionNamespace); condition.Status != meta.ConditionTrue {
+		namespacer := tasks.Namespacer{Client: r.Client, EventRecorder: r.EventRecorder, Cache: r.Cache, ImagePullSecrets: r.ImagePullSecrets}
 		result, err := namespacer.Reconcile(ctx, &workspace, &condition)
 		if err != nil {
-			return result, r.markWorkspaceHasErrored(ctx, &workspace, &condition.Type, err)
+			return r.taskHasErrored(ctx, &workspace, spot.WorkspaceConditionType(condition.Type), err)
 		}
 
 		return result, nil
 	}
 
-	if condition := workspace.Status.Conditions.GetCondition(spot.WorkspaceConditionNetworking); condition.Status != spot.ConditionSuccess {
+	// The pull secrets are synced every time the workspace is reconciled, which includes every time one of
+	// its source secrets changed. They're read from the cache, only the copies that changed are written. A failure
+	// is retried by the controller, the workspace keeps running with the previous credentials in the meantime.
+	namespacer := tasks.Namespacer{Client: r.Client, EventRecorder: r.EventRecorder, Cache: r.Cache, ImagePullSecrets: r.ImagePullSecrets}
+	if err := namespacer.SyncPullSecrets(ctx, &workspace); err != nil {
+		logger.Error(err, "Couldn't sync the pull secrets of the workspace")
+		return ctrl.Result{}, err
+	}
+
+	if condition := workspace.Status.Conditions.GetCondition(spot.WorkspaceConditionNetworking); condition.Status != meta.ConditionTrue {
 		r.EventRecorder.Event(&workspace, "Normal", "Networking", "Creating network resources for this workspace")
 		networking := tasks.Networking{Client: r.Client, EventRecorder: r.EventRecorder}
 		result, err := networking.Reconcile(ctx, &workspace, &condition)
 
 		if err != nil {
-			return result, r.markWorkspaceHasErrored(ctx, &workspace, &condition.Type, err)
+			return r.taskHasErrored(ctx, &workspace, spot.WorkspaceConditionType(condition.Type), err)
 		}
 		return result, nil
 	}
 
-	if condition := workspace.Status.Conditions.GetCondition(spot.WorkspaceConditionBuildingImages); condition.Status != spot.ConditionSuccess {
-		builder := tasks.Builder{Client: r.Client, EventRecorder: r.EventRecorder}
+	if condition := workspace.Status.Conditions.GetCondition(spot.WorkspaceConditionBuildingImages); condition.Status != meta.ConditionTrue {
+		builder := tasks.Builder{Client: r.Client, EventRecorder: r.EventRecorder, ImagePullSecrets: r.ImagePullSecrets}
 		result, err := builder.Reconcile(ctx, &workspace, &condition)
 		if err != nil {
-			return result, r.markWorkspaceHasErrored(ctx, &workspace, &condition.Type, err)
+			return r.taskHasErrored(ctx, &workspace, spot.WorkspaceConditionType(condition.Type), err)
 		}
 
 		return result, nil
 	}
 
-	if workspace.Status.Conditions.GetCondition(spot.WorkspaceConditionBuildingImages).Status == spot.ConditionSuccess {
+	if workspace.Status.Conditions.GetCondition(spot.WorkspaceConditionBuildingImages).Status == meta.ConditionTrue {
 		condition := workspace.Status.Conditions.GetCondition(spot.WorkspaceConditionDeployment)
-		if condition.Status == spot.ConditionInitialized {
-			deployer := tasks.Deployer{Client: r.Client}
+		if condition.Reason == spot.ConditionReasonInitialized {
+			deployer := tasks.Deployer{Client: r.Client, EventRecorder: r.EventRecorder}
 			result, err := deployer.Reconcile(ctx, &workspace, &condition)
 			if err != nil {
-				return result, r.markWorkspaceHasErrored(ctx, &workspace, &condition.Type, err)
+				return r.taskHasErrored(ctx, &workspace, spot.WorkspaceConditionType(condition.Type), err)
 			}
 
 			return result, nil
@@ -161,22 +217,190 @@ func (r *WorkspaceReconciler) terminate(ctx context.Context, workspace *spot.Wor
 	return ctrl.Result{Requeue: true}, nil
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controller with the Manager. The manager only caches the
+// `kubernetes.io/dockerconfigjson` secrets, the pull secrets are the only secrets that are watched.
 func (r *WorkspaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &spot.Workspace{}, tasks.PullSecretsField, tasks.PullSecretNames)
+	if err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&spot.Workspace{}).
 		Owns(&spot.Build{}).
+		Watches(
+			&core.Secret{},
+			handler.EnqueueRequestsFromMapFunc(r.workspacesForPullSecret),
+			builder.WithPredicates(pullSecretChanged),
+		).
 		Complete(r)
 }
 
+// The copies of the pull secrets are ignored and a pull secret is only mapped to its workspaces
+// when its credentials change, not for every update of its metadata or resync of the cache.
+var pullSecretChanged = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		return isPullSecret(e.Object)
+	},
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		if !isPullSecret(e.ObjectNew) {
+			return false
+		}
+
+		return !equality.Semantic.DeepEqual(e.ObjectOld.(*core.Secret).Data, e.ObjectNew.(*core.Secret).Data)
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return isPullSecret(e.Object)
+	},
+	GenericFunc: func(e event.GenericEvent) bool {
+		return false
+	},
+}
+
+func isPullSecret(obj client.Object) bool {
+	return obj.(*core.Secret).Type == core.SecretTypeDockerConfigJson && tasks.IsPullSecretSource(obj)
+}
+
+// Reconcile the workspaces using the secret as a pull secret when it changes, so that
+// their copy of the secret is updated.
+func (r *WorkspaceReconciler) workspacesForPullSecret(ctx context.Context, secret client.Object) []reconcile.Request {
+	workspaces, err := tasks.WorkspacesForPullSecret(ctx, r.Client, secret, r.ImagePullSecrets)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Couldn't list the workspaces of the pull secret", "secret", client.ObjectKeyFromObject(secret))
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, workspace := range workspaces {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&workspace)})
+	}
+
+	return requests
+}
+
+// Handle an error returned by a task. Transient errors from the API server are retried with a backoff
+// a limited number of times, any other error marks the workspace as errored.
+func (r *WorkspaceReconciler) taskHasErrored(ctx context.Context, workspace *spot.Workspace, conditionType spot.WorkspaceConditionType, err error) (ctrl.Result, error) {
+	retries := workspace.Status.TransientErrors(conditionType)
+	if !isTransient(err) || retries >= kMaxTransientRetries {
+		return ctrl.Result{}, r.markWorkspaceHasErrored(ctx, workspace, &conditionType, err)
+	}
+
+	backoff := transientBackoff(retries + 1)
+	r.EventRecorder.Event(workspace, "Warning", "Retrying", fmt.Sprintf("%s failed with a transient error (%s), retrying in %s", conditionType, err, backoff))
+
+	workspace.Status.RecordError(meta.Condition{
+		Type:               string(conditionType),
+		Status:             meta.ConditionFalse,
+		Reason:             spot.WorkspaceReasonTransientError,
+		Message:            err.Error(),
+		ObservedGeneration: workspace.Generation,
+		LastTransitionTime: meta.Now(),
+	})
+
+	return ctrl.Result{RequeueAfter: backoff}, r.Client.Status().Update(ctx, workspace)
+}
+
+// Reset the conditions that failed so the reconciler can pick up the workspace from where it failed. The
+// retry annotation is removed first so the reset only happens once for each time the annotation is set.
+func (r *WorkspaceReconciler) retry(ctx context.Context, workspace *spot.Workspace) error {
+	// The builds are cancelled before the annotation is removed so a failure to cancel them is retried.
+	if workspace.Status.Conditions.GetCondition(spot.WorkspaceConditionBuildingImages).Status == meta.ConditionFalse {
+		if err := r.cancelBuilds(ctx, workspace); err != nil {
+			return err
+		}
+	}
+
+	delete(workspace.Annotations, spot.WorkspaceRetryAnnotation)
+	if err := r.Update(ctx, workspace); err != nil {
+		return err
+	}
+
+	for _, condition := range workspace.Status.Conditions {
+		if condition.Status != meta.ConditionFalse {
+			continue
+		}
+
+		// The builds that were dispatched belong to the previous attempt and were cancelled, new
+		// ones are dispatched when the condition is reconciled again.
+		if condition.Type == string(spot.WorkspaceConditionBuildingImages) {
+			workspace.Status.Builds = nil
+			workspace.Status.Images = nil
+			workspace.Status.BuildProgress = nil
+		}
+
+		workspace.Status.Conditions.SetCondition(&meta.Condition{
+			Type:               condition.Type,
+			Status:             meta.ConditionUnknown,
+			Reason:             spot.ConditionReasonInitialized,
+			Message:            "Condition was reset by the retry annotation",
+			ObservedGeneration: workspace.Generation,
+		})
+	}
+
+	r.EventRecorder.Event(workspace, "Normal", "Retrying", "Retrying the workspace from its failed conditions")
+	workspace.Status.Phase = spot.WorkspacePhaseRunning
+	return r.Client.Status().Update(ctx, workspace)
+}
+
+// Cancel the builds of the workspace that are still running, the same way superseded builds are
+// cancelled. Builds that no longer exist were already cleaned up.
+func (r *WorkspaceReconciler) cancelBuilds(ctx context.Context, workspace *spot.Workspace) error {
+	for _, ref := range workspace.Status.Builds {
+		var build spot.Build
+		if err := r.Client.Get(ctx, ref.NamespacedName(), &build); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+
+		if build.Status.Phase == spot.BuildPhaseDone || build.Spec.Cancel {
+			continue
+		}
+
+		build.Spec.Cancel = true
+		if err := r.Client.Update(ctx, &build); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (r *WorkspaceReconciler) markWorkspaceHasErrored(ctx context.Context, workspace *spot.Workspace, conditionType *spot.WorkspaceConditionType, err error) error {
 	r.EventRecorder.Event(workspace, "Warning", string(spot.WorkspaceStageError), err.Error())
 	if conditionType != nil {
-		workspace.Status.Conditions.SetCondition(&spot.WorkspaceCondition{
-			Type:   *conditionType,
-			Status: spot.ConditionError,
-		})
+		condition := meta.Condition{
+			Type:               string(*conditionType),
+			Status:             meta.ConditionFalse,
+			Reason:             spot.ConditionReasonFailed,
+			Message:            err.Error(),
+			ObservedGeneration: workspace.Generation,
+		}
+		workspace.Status.Conditions.SetCondition(&condition)
+		workspace.Status.RecordError(condition)
 	}
 	workspace.Status.Phase = spot.WorkspacePhaseError
 	return r.Client.Status().Update(ctx, workspace)
 }
+
+// Errors returned by the API server or the registries that are likely to go away on their own.
+func isTransient(err error) bool {
+	return goerrors.Is(err, tasks.ErrRegistryUnavailable) ||
+		errors.IsConflict(err) ||
+		errors.IsServerTimeout(err) ||
+		errors.IsTimeout(err) ||
+		errors.IsTooManyRequests(err) ||
+		errors.IsServiceUnavailable(err) ||
+		errors.IsInternalError(err)
+}
+
+func transientBackoff(retries int) time.Duration {
+	backoff := kTransientBackoff
+	for i := 1; i < retries; i++ {
+		backoff *= 2
+	}
+
+	return backoff
+}
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	core "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	tasks "github.com/releasehub-com/spot/operator/internal/tasks/workspaces"
+)
+
+var _ = Describe("WorkspaceReconciler", func() {
+	var c client.Client
+	var reconciler *WorkspaceReconciler
+	var workspace *spot.Workspace
+
+	conflict := k8sErrors.NewConflict(schema.GroupResource{Group: "spot.release.com", Resource: "workspaces"}, "preview", fmt.Errorf("modified"))
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(spot.AddToScheme(scheme)).To(Succeed())
+
+		workspace = &spot.Workspace{
+			ObjectMeta: meta.ObjectMeta{Namespace: "team", Name: "preview"},
+			Status:     spot.WorkspaceStatus{Phase: spot.WorkspacePhaseRunning},
+		}
+		c = fake.NewClientBuilder().WithScheme(scheme).WithObjects(workspace).WithStatusSubresource(workspace).Build()
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(workspace), workspace)).To(Succeed())
+
+		reconciler = &WorkspaceReconciler{Client: c, Scheme: scheme, EventRecorder: record.NewFakeRecorder(100), Cache: c}
+	})
+
+	It("doubles the backoff with every retry", func() {
+		Expect(transientBackoff(1)).To(Equal(kTransientBackoff))
+		Expect(transientBackoff(2)).To(Equal(2 * kTransientBackoff))
+		Expect(transientBackoff(4)).To(Equal(8 * kTransientBackoff))
+	})
+
+	Context("taskHasErrored", func() {
+		It("retries the transient errors a limited number of times", func() {
+			for i := 1; i <= kMaxTransientRetries; i++ {
+				result, err := reconciler.taskHasErrored(context.TODO(), workspace, spot.WorkspaceConditionNetworking, conflict)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.RequeueAfter).To(Equal(transientBackoff(i)))
+				Expect(workspace.Status.Phase).To(Equal(spot.WorkspacePhaseRunning))
+			}
+
+			_, err := reconciler.taskHasErrored(context.TODO(), workspace, spot.WorkspaceConditionNetworking, conflict)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(workspace.Status.Phase).To(Equal(spot.WorkspacePhaseError))
+			Expect(workspace.Status.Conditions.GetCondition(spot.WorkspaceConditionNetworking).Status).To(Equal(meta.ConditionFalse))
+		})
+
+		It("retries the registries that are unavailable", func() {
+			err := fmt.Errorf("component mysql: %w", tasks.ErrRegistryUnavailable)
+			result, err := reconciler.taskHasErrored(context.TODO(), workspace, spot.WorkspaceConditionBuildingImages, err)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(kTransientBackoff))
+			Expect(workspace.Status.Phase).To(Equal(spot.WorkspacePhaseRunning))
+		})
+
+		It("marks the workspace as errored for any other error", func() {
+			_, err := reconciler.taskHasErrored(context.TODO(), workspace, spot.WorkspaceConditionNetworking, fmt.Errorf("invalid"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(workspace.Status.Phase).To(Equal(spot.WorkspacePhaseError))
+		})
+
+		It("starts counting again once the condition succeeded", func() {
+			for i := 0; i < kMaxTransientRetries; i++ {
+				_, err := reconciler.taskHasErrored(context.TODO(), workspace, spot.WorkspaceConditionNetworking, conflict)
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			workspace.Status.Conditions.SetCondition(&meta.Condition{
+				Type:               string(spot.WorkspaceConditionNetworking),
+				Status:             meta.ConditionTrue,
+				LastTransitionTime: meta.NewTime(time.Now().Add(time.Minute)),
+			})
+
+			result, err := reconciler.taskHasErrored(context.TODO(), workspace, spot.WorkspaceConditionNetworking, conflict)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(kTransientBackoff))
+			Expect(workspace.Status.Phase).To(Equal(spot.WorkspacePhaseRunning))
+		})
+	})
+
+	It("resets the failed conditions when retried", func() {
+		workspace.Annotations = map[string]string{spot.WorkspaceRetryAnnotation: ""}
+		workspace.Status.Phase = spot.WorkspacePhaseError
+		workspace.Status.Builds = []spot.Reference{{Namespace: "team", Name: "app-1"}}
+		workspace.Status.Conditions.SetCondition(&meta.Condition{Type: string(spot.WorkspaceConditionNamespace), Status: meta.ConditionTrue})
+		workspace.Status.Conditions.SetCondition(&meta.Condition{Type: string(spot.WorkspaceConditionBuildingImages), Status: meta.ConditionFalse})
+
+		Expect(reconciler.retry(context.TODO(), workspace)).To(Succeed())
+
+		var updated spot.Workspace
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(workspace), &updated)).To(Succeed())
+		Expect(updated.Annotations).NotTo(HaveKey(spot.WorkspaceRetryAnnotation))
+		Expect(updated.Status.Phase).To(Equal(spot.WorkspacePhaseRunning))
+		Expect(updated.Status.Builds).To(BeEmpty())
+		Expect(updated.Status.Conditions.GetCondition(spot.WorkspaceConditionNamespace).Status).To(Equal(meta.ConditionTrue))
+		Expect(updated.Status.Conditions.GetCondition(spot.WorkspaceConditionBuildingImages).Reason).To(Equal(spot.ConditionReasonInitialized))
+	})
+
+	It("cancels the builds of the previous attempt when retried", func() {
+		running := &spot.Build{ObjectMeta: meta.ObjectMeta{Namespace: "team", Name: "app-1"}, Status: spot.BuildStatus{Phase: spot.BuildPhaseRunning}}
+		done := &spot.Build{ObjectMeta: meta.ObjectMeta{Namespace: "team", Name: "db-1"}, Status: spot.BuildStatus{Phase: spot.BuildPhaseDone}}
+		Expect(c.Create(context.TODO(), running)).To(Succeed())
+		Expect(c.Create(context.TODO(), done)).To(Succeed())
+
+		workspace.Annotations = map[string]string{spot.WorkspaceRetryAnnotation: ""}
+		workspace.Status.Phase = spot.WorkspacePhaseError
+		workspace.Status.Builds = []spot.Reference{{Namespace: "team", Name: "app-1"}, {Namespace: "team", Name: "db-1"}, {Namespace: "team", Name: "deleted-1"}}
+		workspace.Status.Conditions.SetCondition(&meta.Condition{Type: string(spot.WorkspaceConditionBuildingImages), Status: meta.ConditionFalse})
+
+		Expect(reconciler.retry(context.TODO(), workspace)).To(Succeed())
+
+		var build spot.Build
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(running), &build)).To(Succeed())
+		Expect(build.Spec.Cancel).To(BeTrue())
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(done), &build)).To(Succeed())
+		Expect(build.Spec.Cancel).To(BeFalse())
+
+		var updated spot.Workspace
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(workspace), &updated)).To(Succeed())
+		Expect(updated.Status.Builds).To(BeEmpty())
+	})
+
+	It("converts the conditions stored before they were metav1.Conditions before reconciling", func() {
+		workspace.Status.Conditions = spot.WorkspaceConditions{{Type: "Building Images", Status: "In Progress"}}
+		Expect(c.Status().Update(context.TODO(), workspace)).To(Succeed())
+
+		result, err := reconciler.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(workspace)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(ctrl.Result{}))
+
+		var updated spot.Workspace
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(workspace), &updated)).To(Succeed())
+		Expect(updated.Status.Conditions).To(HaveLen(1))
+		Expect(updated.Status.Conditions[0].Type).To(Equal(string(spot.WorkspaceConditionBuildingImages)))
+		Expect(updated.Status.Conditions[0].Status).To(Equal(meta.ConditionUnknown))
+		Expect(updated.Status.Conditions[0].Reason).To(Equal(spot.ConditionReasonStarted))
+	})
+
+	It("deploys the components once their images are built", func() {
+		workspace.Spec.Components = []spot.ComponentSpec{{Name: "app", Image: spot.ImageSpec{Registry: spot.RegistrySpec{URL: "registry.example.com/app"}}}}
+		Expect(c.Update(context.TODO(), workspace)).To(Succeed())
+
+		workspace.Status.Namespace = "preview"
+		workspace.Status.Images = map[string]spot.BuildImage{"app": {Reference: "registry.example.com/app@sha256:2f0e"}}
+		for _, conditionType := range []spot.WorkspaceConditionType{spot.WorkspaceConditionNamespace, spot.WorkspaceConditionNetworking, spot.WorkspaceConditionBuildingImages} {
+			workspace.Status.Conditions.SetCondition(&meta.Condition{Type: string(conditionType), Status: meta.ConditionTrue, Reason: spot.ConditionReasonSucceeded})
+		}
+		workspace.Status.Conditions.SetCondition(&meta.Condition{Type: string(spot.WorkspaceConditionDeployment), Status: meta.ConditionUnknown, Reason: spot.ConditionReasonInitialized})
+		Expect(c.Status().Update(context.TODO(), workspace)).To(Succeed())
+
+		_, err := reconciler.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(workspace)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reconciler.EventRecorder.(*record.FakeRecorder).Events).To(Receive(Equal("Normal Deploying Deploying services and updating routes")))
+
+		var pod core.Pod
+		Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: "preview", Name: "app"}, &pod)).To(Succeed())
+		Expect(pod.Spec.Containers[0].Image).To(Equal("registry.example.com/app@sha256:2f0e"))
+
+		var updated spot.Workspace
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(workspace), &updated)).To(Succeed())
+		Expect(updated.Status.Stage).To(Equal(spot.WorkspaceStageDeployed))
+	})
+})
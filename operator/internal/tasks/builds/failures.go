@@ -0,0 +1,127 @@
+package builds
+
+import (
+	"fmt"
+	"time"
+
+	core "k8s.io/api/core/v1"
+)
+
+// Reasons recorded on the Pod Deployment condition when the builder pod fails.
+const (
+	PodFailureDeleted            = "PodDeleted"
+	PodFailureEvicted            = "Evicted"
+	PodFailureDeadlineExceeded   = "DeadlineExceeded"
+	PodFailureImagePull          = "ImagePullFailed"
+	PodFailureContainerConfig    = "ContainerConfigFailed"
+	PodFailureContainerExited    = "ContainerFailed"
+	PodFailureUnschedulable      = "Unschedulable"
+	PodFailureFailed             = "PodFailed"
+	PodFailureSchedulingDeadline = "SchedulingDeadlineExceeded"
+	PodFailureIncomplete         = "BuildIncomplete"
+)
+
+// PodFailure describes why a builder pod can't complete the build.
+type PodFailure struct {
+	Reason  string
+	Message string
+}
+
+func (f *PodFailure) Error() string {
+	return fmt.Sprintf("%s: %s", f.Reason, f.Message)
+}
+
+// Waiting reasons for a container that won't start without someone fixing the pod's spec or
+// the image. The kubelet keeps retrying these but it's very unlikely to ever succeed.
+var kFailedWaitingReasons = map[string]string{
+	"InvalidImageName":           PodFailureImagePull,
+	"CreateContainerConfigError": PodFailureContainerConfig,
+	"CreateContainerError":       PodFailureContainerConfig,
+}
+
+// Waiting reasons for a container whose image can't be pulled yet. The registry can be briefly
+// unavailable or rate limiting the node, so the pod only fails once the deadline elapsed.
+var kTransientWaitingReasons = map[string]string{
+	"ImagePullBackOff": PodFailureImagePull,
+	"ErrImagePull":     PodFailureImagePull,
+}
+
+// Classify the state of a builder pod. It returns nil if the pod is healthy or still has a chance
+// to become healthy. A pod that isn't scheduled, or can't pull its images, after the scheduling deadline
+// is considered failed, a deadline of zero disables the check.
+func ClassifyPod(pod *core.Pod, schedulingDeadline time.Duration, now time.Time) *PodFailure {
+	expired := schedulingDeadline > 0 && !now.Before(pod.CreationTimestamp.Add(schedulingDeadline))
+
+	if pod.DeletionTimestamp != nil {
+		return &PodFailure{PodFailureDeleted, fmt.Sprintf("pod %s was deleted while the build was running", pod.Name)}
+	}
+
+	if pod.Status.Phase == core.PodFailed {
+		switch pod.Status.Reason {
+		case "Evicted":
+			return &PodFailure{PodFailureEvicted, pod.Status.Message}
+		case "DeadlineExceeded":
+			return &PodFailure{PodFailureDeadlineExceeded, pod.Status.Message}
+		}
+	}
+
+	statuses := append([]core.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		if waiting := cs.State.Waiting; waiting != nil {
+			if reason, ok := kFailedWaitingReasons[waiting.Reason]; ok {
+				return &PodFailure{reason, fmt.Sprintf("container %s: %s", cs.Name, waiting.Message)}
+			}
+
+			if reason, ok := kTransientWaitingReasons[waiting.Reason]; ok && expired {
+				return &PodFailure{reason, fmt.Sprintf("container %s: %s", cs.Name, waiting.Message)}
+			}
+		}
+
+		if terminated := cs.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			return &PodFailure{PodFailureContainerExited, fmt.Sprintf("container %s exited with code %d (%s)", cs.Name, terminated.ExitCode, terminated.Reason)}
+		}
+	}
+
+	if pod.Status.Phase == core.PodFailed {
+		return &PodFailure{PodFailureFailed, pod.Status.Message}
+	}
+
+	if !expired || pod.Status.Phase != core.PodPending || isScheduled(pod) {
+		return nil
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == core.PodScheduled && condition.Reason == core.PodReasonUnschedulable {
+			return &PodFailure{PodFailureUnschedulable, condition.Message}
+		}
+	}
+
+	return &PodFailure{PodFailureSchedulingDeadline, fmt.Sprintf("pod %s wasn't scheduled within %s", pod.Name, schedulingDeadline)}
+}
+
+// Returns true once the builder container exited successfully. The builder is done with
+// the build and the pod doesn't hold a slot in the queue anymore.
+func BuilderSucceeded(pod *core.Pod) bool {
+	if pod.Status.Phase == core.PodSucceeded {
+		return true
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == kBuilderContainer {
+			return cs.State.Terminated != nil && cs.State.Terminated.ExitCode == 0
+		}
+	}
+
+	return false
+}
+
+func isScheduled(pod *core.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == core.PodScheduled {
+			return condition.Status == core.ConditionTrue
+		}
+	}
+
+	return pod.Spec.NodeName != ""
+}
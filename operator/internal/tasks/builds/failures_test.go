@@ -0,0 +1,129 @@
+package builds
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("ClassifyPod", func() {
+	created := time.Now().Add(-time.Hour)
+
+	newPod := func() *core.Pod {
+		return &core.Pod{
+			ObjectMeta: meta.ObjectMeta{Name: "build-1", CreationTimestamp: meta.NewTime(created)},
+			Status:     core.PodStatus{Phase: core.PodRunning},
+		}
+	}
+
+	It("ignores a healthy pod", func() {
+		Expect(ClassifyPod(newPod(), time.Minute, time.Now())).To(BeNil())
+	})
+
+	It("detects a pod that was deleted", func() {
+		pod := newPod()
+		pod.DeletionTimestamp = &meta.Time{Time: time.Now()}
+		Expect(ClassifyPod(pod, 0, time.Now()).Reason).To(Equal(PodFailureDeleted))
+	})
+
+	It("detects an evicted pod", func() {
+		pod := newPod()
+		pod.Status.Phase = core.PodFailed
+		pod.Status.Reason = "Evicted"
+		pod.Status.Message = "The node was low on resource: memory."
+
+		failure := ClassifyPod(pod, 0, time.Now())
+		Expect(failure.Reason).To(Equal(PodFailureEvicted))
+		Expect(failure.Message).To(Equal(pod.Status.Message))
+	})
+
+	DescribeTable("fails images that can't be pulled once the deadline elapsed",
+		func(reason string) {
+			pod := newPod()
+			pod.Status.Phase = core.PodPending
+			pod.Spec.NodeName = "node-1"
+			pod.Status.ContainerStatuses = []core.ContainerStatus{{
+				Name: "buildkitd",
+				State: core.ContainerState{Waiting: &core.ContainerStateWaiting{
+					Reason:  reason,
+					Message: "Back-off pulling image",
+				}},
+			}}
+
+			Expect(ClassifyPod(pod, 0, time.Now())).To(BeNil())
+			Expect(ClassifyPod(pod, 2*time.Hour, time.Now())).To(BeNil())
+
+			failure := ClassifyPod(pod, 10*time.Minute, time.Now())
+			Expect(failure.Reason).To(Equal(PodFailureImagePull))
+			Expect(failure.Message).To(Equal("container buildkitd: Back-off pulling image"))
+		},
+		Entry("while backing off", "ImagePullBackOff"),
+		Entry("when the pull failed", "ErrImagePull"),
+	)
+
+	It("detects image names that are invalid", func() {
+		pod := newPod()
+		pod.Status.Phase = core.PodPending
+		pod.Status.InitContainerStatuses = []core.ContainerStatus{{
+			Name:  "builder",
+			State: core.ContainerState{Waiting: &core.ContainerStateWaiting{Reason: "InvalidImageName"}},
+		}}
+
+		Expect(ClassifyPod(pod, 0, time.Now()).Reason).To(Equal(PodFailureImagePull))
+	})
+
+	It("detects containers exiting with an error", func() {
+		pod := newPod()
+		pod.Status.ContainerStatuses = []core.ContainerStatus{{
+			Name:  "buildkitd",
+			State: core.ContainerState{Terminated: &core.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}},
+		}}
+
+		failure := ClassifyPod(pod, 0, time.Now())
+		Expect(failure.Reason).To(Equal(PodFailureContainerExited))
+		Expect(failure.Message).To(ContainSubstring("OOMKilled"))
+	})
+
+	It("fails unschedulable pods once the scheduling deadline elapsed", func() {
+		pod := newPod()
+		pod.Status.Phase = core.PodPending
+		pod.Status.Conditions = []core.PodCondition{{
+			Type:    core.PodScheduled,
+			Status:  core.ConditionFalse,
+			Reason:  core.PodReasonUnschedulable,
+			Message: "0/3 nodes are available",
+		}}
+
+		Expect(ClassifyPod(pod, 0, time.Now())).To(BeNil())
+		Expect(ClassifyPod(pod, 2*time.Hour, time.Now())).To(BeNil())
+
+		failure := ClassifyPod(pod, 10*time.Minute, time.Now())
+		Expect(failure.Reason).To(Equal(PodFailureUnschedulable))
+		Expect(failure.Message).To(Equal("0/3 nodes are available"))
+	})
+})
+
+var _ = Describe("BuilderSucceeded", func() {
+	DescribeTable("only succeeds once the builder exited with code 0",
+		func(state core.ContainerState, succeeded bool) {
+			pod := &core.Pod{Status: core.PodStatus{
+				Phase: core.PodRunning,
+				ContainerStatuses: []core.ContainerStatus{
+					{Name: "sidecar", State: core.ContainerState{Terminated: &core.ContainerStateTerminated{ExitCode: 0}}},
+					{Name: kBuilderContainer, State: state},
+				},
+			}}
+			Expect(BuilderSucceeded(pod)).To(Equal(succeeded))
+		},
+		Entry("running", core.ContainerState{Running: &core.ContainerStateRunning{}}, false),
+		Entry("failed", core.ContainerState{Terminated: &core.ContainerStateTerminated{ExitCode: 1}}, false),
+		Entry("exited", core.ContainerState{Terminated: &core.ContainerStateTerminated{ExitCode: 0, Reason: "Completed"}}, true),
+	)
+
+	It("succeeds once the pod succeeded", func() {
+		Expect(BuilderSucceeded(&core.Pod{Status: core.PodStatus{Phase: core.PodSucceeded}})).To(BeTrue())
+	})
+})
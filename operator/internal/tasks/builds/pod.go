@@ -2,8 +2,11 @@ package builds
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -17,58 +20,137 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+var ErrRepositoryMissing = errors.New("build requires a repository")
+
+// Name of the container running the builder in the builder pod.
+const kBuilderContainer = "buildkit"
+
 type PodDeployment struct {
 	client.Client
 	record.EventRecorder
+
+	// Cluster-wide configuration of the builder pod, the build's own
+	// configuration takes precedence over it.
+	Config spot.BuilderPodSpec
 }
 
-func (p *PodDeployment) Reconcile(ctx context.Context, build *spot.Build, condition *spot.BuildCondition) (ctrl.Result, error) {
-	var secret core.Secret
-	if err := p.Client.Get(ctx, client.ObjectKey{Name: build.Spec.SecretRef, Namespace: build.Namespace}, &secret); err != nil {
-		return ctrl.Result{}, err
+// Configuration of the builder pod when neither the BuilderConfig nor
+// the build configures a field.
+var defaultBuilderPodSpec = spot.BuilderPodSpec{
+	BuilderResources:   defaultResources(),
+	BuildkitResources:  defaultResources(),
+	BuildkitImage:      "moby/buildkit:master",
+	ImagePullPolicy:    core.PullAlways,
+	ServiceAccountName: "spot-controller-manager",
+}
+
+func defaultResources() *core.ResourceRequirements {
+	return &core.ResourceRequirements{
+		Requests: core.ResourceList{
+			"memory": resource.MustParse("1Gi"),
+		},
+		Limits: core.ResourceList{
+			"memory": resource.MustParse("2Gi"),
+		},
+	}
+}
+
+func (p *PodDeployment) Reconcile(ctx context.Context, build *spot.Build, condition *meta.Condition) (ctrl.Result, error) {
+	// Secrets are mounted in the pod, if any of them is missing the pod would never
+	// start so it's better to fail early and let the user know about it.
+	for _, name := range secretNames(build) {
+		var secret core.Secret
+		if err := p.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: build.Namespace}, &secret); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
 	// The Build is just initialized and nothing has been processed, yet. For the Build to actually start, a pod
 	// needs to be scheduled with the right service account so that it can update the state of the Build has it goes
 	// through each of the steps.
-	pod := p.pod(build, &secret)
-	err := p.Client.Create(ctx, pod)
+	pod, err := p.pod(build)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
+	if err := p.Client.Create(ctx, pod); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The scan is optional, its condition is registered up front so the build isn't
+	// considered done before the builder gets to the scan.
+	if build.Spec.Image.Scan != nil {
+		build.Status.SetCondition(meta.Condition{
+			Type:               string(spot.BuildConditionScan),
+			Status:             meta.ConditionUnknown,
+			Reason:             spot.ConditionReasonInitialized,
+			ObservedGeneration: build.Generation,
+		})
+	}
+
 	// It's important to set the condition first before calling conditions.Phase() as otherwise it would
 	// not include the state of this condition when deriving the value.
-	build.Status.SetCondition(spot.BuildCondition{
-		Type:   spot.BuildConditionDeployPod,
-		Status: spot.ConditionInProgress,
+	build.Status.SetCondition(meta.Condition{
+		Type:               string(spot.BuildConditionDeployPod),
+		Status:             meta.ConditionUnknown,
+		Reason:             spot.ConditionReasonStarted,
+		Message:            fmt.Sprintf("Pod %s was created", pod.Name),
+		ObservedGeneration: build.Generation,
 	})
 
 	build.Status.Pod = spot.NewReference(pod)
 	build.Status.Phase = build.Status.Conditions.CurrentPhase()
+	build.Status.QueuePosition = 0
 
-	if err := p.Client.Status().Update(ctx, build); err != nil {
-		return ctrl.Result{}, err
+	return ctrl.Result{}, p.Client.Status().Update(ctx, build)
+}
+
+func (p *PodDeployment) pod(build *spot.Build) (*core.Pod, error) {
+	privileged := true
+
+	arguments, err := marshal(build.Spec.Arguments)
+	if err != nil {
+		return nil, err
 	}
 
-	build.Status.SetCondition(spot.BuildCondition{
-		Type:   spot.BuildConditionDeployPod,
-		Status: spot.ConditionInProgress,
-	})
+	mirrors, err := marshal(build.Spec.Image.Mirrors)
+	if err != nil {
+		return nil, err
+	}
 
-	build.Status.Pod = spot.NewReference(pod)
-	build.Status.Phase = build.Status.Conditions.CurrentPhase()
+	mounts, err := newSecretMounts(build)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := p.Client.Status().Update(ctx, build); err != nil {
-		return ctrl.Result{}, err
+	source, err := sourceEnv(build.Spec.Image.Repository)
+	if err != nil {
+		return nil, err
 	}
 
-	return ctrl.Result{}, nil
-}
+	var target string
+	if build.Spec.Image.Registry.Target != nil {
+		target = *build.Spec.Image.Registry.Target
+	}
 
-func (p *PodDeployment) pod(build *spot.Build, secret *core.Secret) *core.Pod {
-	privileged := true
-	return &core.Pod{
+	var scan []core.EnvVar
+	if spec := build.Spec.Image.Scan; spec != nil {
+		scan = mounts.scanDatabase(spec)
+	}
+
+	var attestations []string
+	if attest := build.Spec.Image.Attestations; attest != nil {
+		if attest.SBOM {
+			attestations = append(attestations, "sbom")
+		}
+		if attest.Provenance {
+			attestations = append(attestations, "provenance")
+		}
+	}
+
+	spec := defaultBuilderPodSpec.Merge(&p.Config).Merge(build.Spec.Builder)
+
+	pod := &core.Pod{
 		ObjectMeta: meta.ObjectMeta{
 			Namespace:    build.Namespace,
 			GenerateName: fmt.Sprintf("build-%s-", build.Name),
@@ -84,94 +166,62 @@ func (p *PodDeployment) pod(build *spot.Build, secret *core.Secret) *core.Pod {
 		},
 		Spec: core.PodSpec{
 			RestartPolicy:      core.RestartPolicyNever,
-			ServiceAccountName: "spot-controller-manager", // TODO: Most likely to change spot-system/default to support the RBAC settings we need instead
+			ServiceAccountName: spec.ServiceAccountName,
 			Affinity:           build.Spec.Affinity,
+			Tolerations:        spec.Tolerations,
+			NodeSelector:       spec.NodeSelector,
+			PriorityClassName:  spec.PriorityClassName,
 			Containers: []core.Container{{
-				Name:            "buildkit",
-				ImagePullPolicy: core.PullAlways,
+				Name:            kBuilderContainer,
+				ImagePullPolicy: spec.ImagePullPolicy,
 				Image:           env.GetString("BUILDER_IMAGE", "builder:dev"),
-				Resources: core.ResourceRequirements{
-					Requests: core.ResourceList{
-						"memory": resource.MustParse("1Gi"),
-					},
-					Limits: core.ResourceList{
-						"memory": resource.MustParse("2Gi"),
-					},
-				},
-				Env: []core.EnvVar{
+				Resources:       *spec.BuilderResources.DeepCopy(),
+				Env: append([]core.EnvVar{
 					{
 						Name:  "BUILD_REFERENCE",
 						Value: build.GetReference().String(),
 					},
 					{
-						Name:  "REPOSITORY_URL",
-						Value: build.Spec.Image.Repository.URL,
+						Name:  "IMAGE_URL",
+						Value: build.Spec.Image.Registry.URL,
 					},
 					{
-						Name:  "REPOSITORY_BRANCH",
-						Value: build.Spec.Image.Repository.Reference.Name,
+						Name:  "IMAGE_TAGS",
+						Value: strings.Join(build.Spec.Image.Registry.Tags, ","),
 					},
 					{
-						Name:  "REPOSITORY_COMMIT",
-						Value: build.Spec.Image.Repository.Reference.Hash,
+						Name:  "IMAGE_MIRRORS",
+						Value: mirrors,
 					},
 					{
-						Name:  "REPOSITORY_CONTEXT",
-						Value: build.Spec.Image.Repository.Context,
+						Name:  "IMAGE_PLATFORMS",
+						Value: strings.Join(build.Spec.Image.Platforms, ","),
 					},
 					{
-						Name:  "IMAGE_URL",
-						Value: build.Spec.Image.Registry.URL,
+						Name:  "IMAGE_TARGET",
+						Value: target,
 					},
 					{
-						Name:  "IMAGE_TAGS",
-						Value: strings.Join(build.Spec.Image.Registry.Tags, ","),
+						Name:  "IMAGE_ATTESTATIONS",
+						Value: strings.Join(attestations, ","),
 					},
 					{
-						Name: "REPOSITORY_SECRETS",
-						ValueFrom: &core.EnvVarSource{
-							SecretKeyRef: &core.SecretKeySelector{
-								LocalObjectReference: core.LocalObjectReference{
-									Name: secret.Name,
-								},
-								Key: spot.BuildSecretRepositories,
-							},
-						},
+						Name:  "BUILD_ARGUMENTS",
+						Value: arguments,
 					},
 					{
-						Name: "REGISTRY_SECRETS",
-						ValueFrom: &core.EnvVarSource{
-							SecretKeyRef: &core.SecretKeySelector{
-								LocalObjectReference: core.LocalObjectReference{
-									Name: secret.Name,
-								},
-								Key: spot.BuildSecretRegistries,
-							},
-						},
+						Name:  "BUILD_SECRETS",
+						Value: mounts.secrets,
 					},
 					{
-						Name: "BUILD_ARGUMENTS",
-						ValueFrom: &core.EnvVarSource{
-							SecretKeyRef: &core.SecretKeySelector{
-								LocalObjectReference: core.LocalObjectReference{
-									Name: secret.Name,
-								},
-								Key: spot.BuildSecretArguments,
-							},
-						},
+						Name:  "REPOSITORY_CREDENTIALS",
+						Value: mounts.repositories,
 					},
 					{
-						Name: "BUILD_SECRETS",
-						ValueFrom: &core.EnvVarSource{
-							SecretKeyRef: &core.SecretKeySelector{
-								LocalObjectReference: core.LocalObjectReference{
-									Name: secret.Name,
-								},
-								Key: spot.BuildSecretSecrets,
-							},
-						},
+						Name:  "REGISTRY_CREDENTIALS",
+						Value: mounts.registries,
 					},
-				},
+				}, append(append(source, mounts.signing...), scan...)...),
 				SecurityContext: &core.SecurityContext{
 					Privileged: &privileged,
 				},
@@ -182,17 +232,11 @@ func (p *PodDeployment) pod(build *spot.Build, secret *core.Secret) *core.Pod {
 				},
 			},
 				{
-					Name:  "buildkitd",
-					Image: "moby/buildkit:master",
-					Resources: core.ResourceRequirements{
-						Requests: core.ResourceList{
-							"memory": resource.MustParse("1Gi"),
-						},
-						Limits: core.ResourceList{
-							"memory": resource.MustParse("2Gi"),
-						},
-					},
-					Env: []core.EnvVar{},
+					Name:            "buildkitd",
+					Image:           spec.BuildkitImage,
+					ImagePullPolicy: spec.ImagePullPolicy,
+					Resources:       *spec.BuildkitResources.DeepCopy(),
+					Env:             []core.EnvVar{},
 					SecurityContext: &core.SecurityContext{
 						Privileged: &privileged,
 					},
@@ -223,4 +267,143 @@ func (p *PodDeployment) pod(build *spot.Build, secret *core.Secret) *core.Pod {
 			}},
 		},
 	}
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, mounts.volumes...)
+	pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, mounts.volumeMounts...)
+
+	// Let the kubelet stop the pod when the build's timeout elapses so the pod doesn't
+	// keep running if the controller is not around to clean it up.
+	if build.Spec.Timeout != nil {
+		remaining := int64(time.Until(build.CreationTimestamp.Add(build.Spec.Timeout.Duration)).Seconds())
+		if remaining < 1 {
+			remaining = 1
+		}
+		pod.Spec.ActiveDeadlineSeconds = &remaining
+	}
+
+	return pod, nil
+}
+
+// Environment variables that tell the builder where to fetch the source from. Only
+// the variables of the repository's type are set.
+func sourceEnv(repository *spot.RepositorySpec) ([]core.EnvVar, error) {
+	if repository == nil {
+		return nil, ErrRepositoryMissing
+	}
+
+	// Builds created before the sources were a union have the git fields inline.
+	repository = repository.DeepCopy()
+	repository.Default()
+
+	if !hasSource(repository) {
+		return nil, fmt.Errorf("%w: %s", spot.ErrSourceMissing, repository.GetType())
+	}
+
+	env := []core.EnvVar{
+		{
+			Name:  "REPOSITORY_TYPE",
+			Value: string(repository.GetType()),
+		},
+		{
+			Name:  "REPOSITORY_CONTEXT",
+			Value: repository.Context,
+		},
+		{
+			Name:  "REPOSITORY_DOCKERFILE",
+			Value: repository.Dockerfile,
+		},
+	}
+
+	switch repository.GetType() {
+	case spot.SourceTypeGit:
+		depth := int32(spot.DefaultRepositoryDepth)
+		if repository.Git.Depth != nil {
+			depth = *repository.Git.Depth
+		}
+
+		env = append(env, []core.EnvVar{
+			{
+				Name:  "REPOSITORY_URL",
+				Value: repository.Git.URL,
+			},
+			{
+				Name:  "REPOSITORY_REF",
+				Value: repository.Git.Reference.Name,
+			},
+			{
+				Name:  "REPOSITORY_COMMIT",
+				Value: repository.Git.Reference.Hash,
+			},
+			{
+				Name:  "REPOSITORY_DEPTH",
+				Value: fmt.Sprint(depth),
+			},
+			{
+				Name:  "REPOSITORY_SPARSE_CHECKOUT",
+				Value: strconv.FormatBool(repository.Git.SparseCheckout),
+			},
+			{
+				Name:  "REPOSITORY_SUBMODULES",
+				Value: strconv.FormatBool(repository.Git.Submodules),
+			},
+			{
+				Name:  "REPOSITORY_LFS",
+				Value: strconv.FormatBool(repository.Git.LFS),
+			},
+		}...)
+
+	case spot.SourceTypeTarball:
+		env = append(env, []core.EnvVar{
+			{
+				Name:  "REPOSITORY_URL",
+				Value: repository.Tarball.URL,
+			},
+			{
+				Name:  "REPOSITORY_CHECKSUM",
+				Value: repository.Tarball.Checksum,
+			},
+		}...)
+
+	case spot.SourceTypeOCI:
+		env = append(env, core.EnvVar{
+			Name:  "REPOSITORY_URL",
+			Value: repository.OCI.Reference,
+		})
+
+	case spot.SourceTypeConfigMap:
+		items, err := marshal(repository.ConfigMap.Items)
+		if err != nil {
+			return nil, err
+		}
+
+		env = append(env, []core.EnvVar{
+			{
+				Name:  "REPOSITORY_CONFIGMAP",
+				Value: repository.ConfigMap.Name,
+			},
+			{
+				Name:  "REPOSITORY_CONFIGMAP_ITEMS",
+				Value: items,
+			},
+		}...)
+	}
+
+	return env, nil
+}
+
+// The webhook rejects repositories without the source of their type, builds
+// created before the webhook was deployed can still be missing it.
+func hasSource(repository *spot.RepositorySpec) bool {
+	switch repository.GetType() {
+	case spot.SourceTypeGit:
+		return repository.Git != nil
+	case spot.SourceTypeTarball:
+		return repository.Tarball != nil
+	case spot.SourceTypeOCI:
+		return repository.OCI != nil
+	case spot.SourceTypeConfigMap:
+		return repository.ConfigMap != nil
+	}
+
+	return false
 }
@@ -0,0 +1,39 @@
+package builds
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	core "k8s.io/api/core/v1"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+var _ = Describe("sourceEnv", func() {
+	It("fails when the source of the repository's type is missing", func() {
+		_, err := sourceEnv(nil)
+		Expect(err).To(MatchError(ErrRepositoryMissing))
+
+		for _, sourceType := range []spot.SourceType{"", spot.SourceTypeTarball, spot.SourceTypeOCI, spot.SourceTypeConfigMap} {
+			_, err = sourceEnv(&spot.RepositorySpec{Type: sourceType})
+			Expect(err).To(MatchError(spot.ErrSourceMissing))
+		}
+	})
+
+	It("reads the deprecated git fields of the builds created before the sources were a union", func() {
+		repository := &spot.RepositorySpec{
+			Context:   "app",
+			URL:       "https://github.com/releasehub-com/spot.git",
+			Reference: &spot.GitReference{Name: "main"},
+		}
+
+		env, err := sourceEnv(repository)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(ContainElements(
+			core.EnvVar{Name: "REPOSITORY_TYPE", Value: "git"},
+			core.EnvVar{Name: "REPOSITORY_URL", Value: "https://github.com/releasehub-com/spot.git"},
+			core.EnvVar{Name: "REPOSITORY_REF", Value: "main"},
+			core.EnvVar{Name: "REPOSITORY_DEPTH", Value: "1"},
+		))
+		Expect(repository.Git).To(BeNil())
+	})
+})
@@ -0,0 +1,147 @@
+package builds
+
+import (
+	"context"
+	"sort"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Queue limits the number of builds that can run at the same time. A build is running
+// once its pod is deployed, every other build waiting for a pod is pending and
+// gets a slot in order: builds with a higher priority first and, for the same priority,
+// the oldest build first.
+type Queue struct {
+	client.Client
+
+	// Maximum number of builds running at the same time across the cluster. Zero means no limit.
+	MaxConcurrentBuilds int
+
+	// Maximum number of builds running at the same time within a namespace. Zero means no limit.
+	MaxConcurrentBuildsPerNamespace int
+}
+
+// Field the builds are indexed by, with their state in the queue. Terminated builds aren't indexed
+// so the queue only goes through the builds that are running or pending.
+const QueueStateField = ".status.queueState"
+
+// States of the builds in the QueueStateField index.
+const (
+	kQueueStateRunning = "running"
+	kQueueStatePending = "pending"
+)
+
+// QueueState returns the state of the build in the queue, the value of its QueueStateField index.
+func QueueState(obj client.Object) []string {
+	build := obj.(*spot.Build)
+	switch {
+	case isRunning(build):
+		return []string{kQueueStateRunning}
+	case isPending(build):
+		return []string{kQueueStatePending}
+	}
+
+	return nil
+}
+
+// Position returns the position of the build in the queue. A position of 0 means the build
+// has a free slot and its pod can be deployed.
+func (q *Queue) Position(ctx context.Context, build *spot.Build) (int, error) {
+	if q.MaxConcurrentBuilds <= 0 && q.MaxConcurrentBuildsPerNamespace <= 0 {
+		return 0, nil
+	}
+
+	var runningList spot.BuildList
+	if err := q.Client.List(ctx, &runningList, client.MatchingFields{QueueStateField: kQueueStateRunning}); err != nil {
+		return 0, err
+	}
+
+	var pendingList spot.BuildList
+	if err := q.Client.List(ctx, &pendingList, client.MatchingFields{QueueStateField: kQueueStatePending}); err != nil {
+		return 0, err
+	}
+
+	running := 0
+	runningPerNamespace := map[string]int{}
+	for _, item := range runningList.Items {
+		if item.UID == build.UID {
+			continue
+		}
+
+		running++
+		runningPerNamespace[item.Namespace]++
+	}
+
+	// The build being reconciled is the most up to date, it replaces its copy from the cache.
+	pending := []*spot.Build{build}
+	for i := range pendingList.Items {
+		if item := &pendingList.Items[i]; item.UID != build.UID {
+			pending = append(pending, item)
+		}
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool {
+		if pending[i].Spec.Priority != pending[j].Spec.Priority {
+			return pending[i].Spec.Priority > pending[j].Spec.Priority
+		}
+
+		return pending[i].CreationTimestamp.Before(&pending[j].CreationTimestamp)
+	})
+
+	// Hand out the free slots to the pending builds in order. A build that can't get
+	// a slot, either because the cluster or its namespace is full, stays in the queue
+	// without blocking the builds behind it from other namespaces.
+	position := 0
+	for _, item := range pending {
+		free := q.MaxConcurrentBuilds <= 0 || running < q.MaxConcurrentBuilds
+		freeInNamespace := q.MaxConcurrentBuildsPerNamespace <= 0 || runningPerNamespace[item.Namespace] < q.MaxConcurrentBuildsPerNamespace
+
+		if free && freeInNamespace {
+			if item.UID == build.UID {
+				return 0, nil
+			}
+
+			running++
+			runningPerNamespace[item.Namespace]++
+			continue
+		}
+
+		position++
+		if item.UID == build.UID {
+			return position, nil
+		}
+	}
+
+	return position, nil
+}
+
+func isTerminated(build *spot.Build) bool {
+	switch build.Status.Phase {
+	case spot.BuildPhaseDone, spot.BuildPhaseError, spot.BuildPhaseCancelled:
+		return true
+	}
+
+	return build.Spec.Cancel
+}
+
+// A build is running when its pod was deployed for the current attempt and the
+// builder didn't exit yet, the pod's condition is completed once it did.
+func isRunning(build *spot.Build) bool {
+	if isTerminated(build) || build.Status.Pod == nil {
+		return false
+	}
+
+	return build.Status.GetCondition(spot.BuildConditionDeployPod).Status == meta.ConditionUnknown
+}
+
+// A build is pending when it's waiting for its pod to be deployed.
+func isPending(build *spot.Build) bool {
+	if isTerminated(build) || build.Status.Pod != nil {
+		return false
+	}
+
+	reason := build.Status.GetCondition(spot.BuildConditionDeployPod).Reason
+	return reason == spot.ConditionReasonInitialized || reason == spot.ConditionReasonWaiting
+}
@@ -0,0 +1,118 @@
+package builds
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+var _ = Describe("Queue", func() {
+	var c client.Client
+	var queue *Queue
+	created := time.Now().Add(-time.Hour)
+
+	// Builds are created a minute apart, in the order they are listed.
+	newBuild := func(namespace, name string, priority int32, running bool) *spot.Build {
+		build := &spot.Build{
+			ObjectMeta: meta.ObjectMeta{
+				Namespace:         namespace,
+				Name:              name,
+				UID:               types.UID(fmt.Sprintf("%s/%s", namespace, name)),
+				CreationTimestamp: meta.NewTime(created),
+			},
+			Spec: spot.BuildSpec{Priority: priority},
+		}
+		created = created.Add(time.Minute)
+
+		build.Status.SetCondition(meta.Condition{Type: string(spot.BuildConditionDeployPod), Status: meta.ConditionUnknown, Reason: spot.ConditionReasonInitialized})
+		if running {
+			build.Status.Pod = &spot.Reference{Namespace: namespace, Name: name}
+			build.Status.SetCondition(meta.Condition{Type: string(spot.BuildConditionDeployPod), Status: meta.ConditionUnknown, Reason: spot.ConditionReasonStarted})
+		}
+
+		return build
+	}
+
+	position := func(namespace, name string) int {
+		var build spot.Build
+		Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, &build)).To(Succeed())
+
+		position, err := queue.Position(context.TODO(), &build)
+		Expect(err).NotTo(HaveOccurred())
+		return position
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(spot.AddToScheme(scheme)).To(Succeed())
+
+		done := newBuild("team", "done", 0, false)
+		done.Status.Phase = spot.BuildPhaseDone
+
+		c = fake.NewClientBuilder().WithScheme(scheme).WithIndex(&spot.Build{}, QueueStateField, QueueState).WithObjects(
+			done,
+			newBuild("team", "running", 0, true),
+			newBuild("team", "oldest", 0, false),
+			newBuild("other", "other", 0, false),
+			newBuild("team", "urgent", 10, false),
+			newBuild("team", "newest", 0, false),
+		).Build()
+
+		queue = &Queue{Client: c, MaxConcurrentBuilds: 2}
+	})
+
+	It("doesn't queue builds without a limit", func() {
+		queue.MaxConcurrentBuilds = 0
+		Expect(position("team", "newest")).To(Equal(0))
+	})
+
+	It("orders the builds by priority, then by age", func() {
+		Expect(position("team", "urgent")).To(Equal(0))
+		Expect(position("team", "oldest")).To(Equal(1))
+		Expect(position("other", "other")).To(Equal(2))
+		Expect(position("team", "newest")).To(Equal(3))
+	})
+
+	It("lets the builds of other namespaces go ahead of a full namespace", func() {
+		queue.MaxConcurrentBuilds = 0
+		queue.MaxConcurrentBuildsPerNamespace = 1
+
+		Expect(position("other", "other")).To(Equal(0))
+		Expect(position("team", "urgent")).To(Equal(1))
+		Expect(position("team", "oldest")).To(Equal(2))
+	})
+
+	It("moves the builds up the queue when a running build finishes", func() {
+		Expect(position("team", "newest")).To(Equal(3))
+
+		var running spot.Build
+		Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: "team", Name: "running"}, &running)).To(Succeed())
+		running.Status.Phase = spot.BuildPhaseDone
+		Expect(c.Update(context.TODO(), &running)).To(Succeed())
+
+		Expect(position("team", "oldest")).To(Equal(0))
+		Expect(position("team", "newest")).To(Equal(2))
+	})
+
+	It("frees the slot of a build whose builder exited", func() {
+		var running spot.Build
+		Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: "team", Name: "running"}, &running)).To(Succeed())
+		running.Status.SetCondition(meta.Condition{Type: string(spot.BuildConditionDeployPod), Status: meta.ConditionTrue, Reason: spot.ConditionReasonSucceeded})
+		Expect(c.Update(context.TODO(), &running)).To(Succeed())
+
+		Expect(QueueState(&running)).To(BeEmpty())
+		Expect(position("team", "oldest")).To(Equal(0))
+	})
+})
@@ -0,0 +1,266 @@
+package builds
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	core "k8s.io/api/core/v1"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+// Paths where the secrets referenced by a build are mounted inside
+// the builder's container.
+const (
+	kBuildSecretsPath          = "/var/run/spot/secrets"
+	kRepositoryCredentialsPath = "/var/run/spot/repositories"
+	kRegistryCredentialsPath   = "/var/run/spot/registries"
+	kSigningKeyPath            = "/var/run/spot/signing"
+	kSigstoreTokenPath         = "/var/run/spot/sigstore"
+	kScanDatabasePath          = "/var/run/spot/scan"
+)
+
+// Lifetime of the service account token exchanged with Fulcio, it's only
+// used once the image is pushed. The kubelet rotates it before it expires.
+const kSigstoreTokenExpiration = 3600
+
+// secretMounts holds the volumes needed to expose the build's secrets to the
+// builder as files. The values are never passed as environment variables, instead
+// the builder receives a JSON payload for each category that maps the
+// secret, or the credential's host, to the path where its value can be read.
+type secretMounts struct {
+	volumes      []core.Volume
+	volumeMounts []core.VolumeMount
+
+	secrets      string
+	repositories string
+	registries   string
+
+	// Environment variables telling the builder how to sign the image,
+	// empty when the image isn't signed.
+	signing []core.EnvVar
+}
+
+type mountedSecret struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type mountedCredential struct {
+	Host string              `json:"host"`
+	Type spot.CredentialType `json:"type"`
+	Path string              `json:"path"`
+}
+
+// Keys of the credential's secret that are mounted for each type of credential.
+var kCredentialKeys = map[spot.CredentialType][]string{
+	spot.CredentialTypeBasicAuth:    {core.BasicAuthUsernameKey, core.BasicAuthPasswordKey},
+	spot.CredentialTypeSSH:          {core.SSHAuthPrivateKey, spot.CredentialSSHKnownHostsKey},
+	spot.CredentialTypeGitHubApp:    {spot.CredentialGitHubAppIDKey, spot.CredentialGitHubInstallationIDKey, spot.CredentialGitHubAppPrivateKeyKey},
+	spot.CredentialTypeDockerConfig: {core.DockerConfigJsonKey},
+}
+
+func newSecretMounts(build *spot.Build) (*secretMounts, error) {
+	mounts := &secretMounts{}
+
+	var secrets []mountedSecret
+	var sources []core.VolumeProjection
+	for i, secret := range build.Spec.Secrets {
+		file := fmt.Sprint(i)
+		secrets = append(secrets, mountedSecret{
+			Name: secret.Name,
+			Path: path.Join(kBuildSecretsPath, file),
+		})
+
+		sources = append(sources, core.VolumeProjection{
+			Secret: &core.SecretProjection{
+				LocalObjectReference: secret.ValueFrom.LocalObjectReference,
+				Items:                []core.KeyToPath{{Key: secret.ValueFrom.Key, Path: file}},
+			},
+		})
+	}
+	mounts.add("build-secrets", kBuildSecretsPath, sources)
+
+	var err error
+	if mounts.secrets, err = marshal(secrets); err != nil {
+		return nil, err
+	}
+
+	if mounts.repositories, err = mounts.credentials("repository-credentials", kRepositoryCredentialsPath, build.Spec.RepositoryCredentials); err != nil {
+		return nil, err
+	}
+
+	if mounts.registries, err = mounts.credentials("registry-credentials", kRegistryCredentialsPath, build.Spec.RegistryCredentials); err != nil {
+		return nil, err
+	}
+
+	if signing := build.Spec.Image.Signing; signing != nil {
+		mounts.signing = mounts.signingKey(signing)
+	}
+
+	return mounts, nil
+}
+
+// The key pair is mounted from its secret. Keyless signing mounts a service account
+// token for the Fulcio audience instead, the token is the identity the certificate is issued for.
+func (m *secretMounts) signingKey(signing *spot.SigningSpec) []core.EnvVar {
+	if signing.Keyless == nil {
+		m.add("signing-key", kSigningKeyPath, []core.VolumeProjection{{
+			Secret: &core.SecretProjection{
+				LocalObjectReference: core.LocalObjectReference{Name: signing.KeyRef},
+				Items: []core.KeyToPath{
+					{Key: spot.SigningKeyKey, Path: spot.SigningKeyKey},
+					{Key: spot.SigningPasswordKey, Path: spot.SigningPasswordKey},
+				},
+			},
+		}})
+
+		return []core.EnvVar{
+			{Name: "SIGNING_KEY", Value: path.Join(kSigningKeyPath, spot.SigningKeyKey)},
+			{Name: "SIGNING_PASSWORD", Value: path.Join(kSigningKeyPath, spot.SigningPasswordKey)},
+		}
+	}
+
+	keyless := *signing.Keyless
+	if keyless.FulcioURL == "" {
+		keyless.FulcioURL = spot.DefaultFulcioURL
+	}
+
+	if keyless.RekorURL == "" {
+		keyless.RekorURL = spot.DefaultRekorURL
+	}
+
+	if keyless.Audience == "" {
+		keyless.Audience = spot.DefaultSigningAudience
+	}
+
+	expiration := int64(kSigstoreTokenExpiration)
+	m.add("sigstore-token", kSigstoreTokenPath, []core.VolumeProjection{{
+		ServiceAccountToken: &core.ServiceAccountTokenProjection{
+			Audience:          keyless.Audience,
+			ExpirationSeconds: &expiration,
+			Path:              "token",
+		},
+	}})
+
+	return []core.EnvVar{
+		{Name: "SIGNING_IDENTITY_TOKEN", Value: path.Join(kSigstoreTokenPath, "token")},
+		{Name: "SIGNING_FULCIO_URL", Value: keyless.FulcioURL},
+		{Name: "SIGNING_REKOR_URL", Value: keyless.RekorURL},
+	}
+}
+
+// The vulnerability database isn't a secret but it's mounted along with them, from its
+// volume. The database is too large to be projected from a ConfigMap.
+func (m *secretMounts) scanDatabase(scan *spot.ScanSpec) []core.EnvVar {
+	m.volumes = append(m.volumes, core.Volume{
+		Name: "scan-database",
+		VolumeSource: core.VolumeSource{
+			PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{ClaimName: scan.Database.ClaimName, ReadOnly: true},
+		},
+	})
+
+	m.volumeMounts = append(m.volumeMounts, core.VolumeMount{
+		Name:      "scan-database",
+		MountPath: kScanDatabasePath,
+		ReadOnly:  true,
+	})
+
+	database := scan.Database.Path
+	if database == "" {
+		database = spot.DefaultScanDatabasePath
+	}
+
+	return []core.EnvVar{
+		{Name: "SCAN_DATABASE", Value: path.Join(kScanDatabasePath, database)},
+		{Name: "SCAN_THRESHOLD", Value: string(scan.Threshold)},
+	}
+}
+
+// Each credential is mounted in its own directory with each of the keys its type
+// requires as separate files.
+func (m *secretMounts) credentials(name, mountPath string, credentials []spot.CredentialSpec) (string, error) {
+	var mounted []mountedCredential
+	var sources []core.VolumeProjection
+
+	for i, credential := range credentials {
+		dir := fmt.Sprint(i)
+		credentialType := credential.Type
+		if credentialType == "" {
+			credentialType = spot.CredentialTypeBasicAuth
+		}
+
+		mounted = append(mounted, mountedCredential{
+			Host: credential.Host,
+			Type: credentialType,
+			Path: path.Join(mountPath, dir),
+		})
+
+		var items []core.KeyToPath
+		for _, key := range kCredentialKeys[credentialType] {
+			items = append(items, core.KeyToPath{Key: key, Path: path.Join(dir, key)})
+		}
+
+		sources = append(sources, core.VolumeProjection{
+			Secret: &core.SecretProjection{
+				LocalObjectReference: core.LocalObjectReference{Name: credential.SecretRef},
+				Items:                items,
+			},
+		})
+	}
+	m.add(name, mountPath, sources)
+
+	return marshal(mounted)
+}
+
+func (m *secretMounts) add(name, mountPath string, sources []core.VolumeProjection) {
+	if len(sources) == 0 {
+		return
+	}
+
+	m.volumes = append(m.volumes, core.Volume{
+		Name: name,
+		VolumeSource: core.VolumeSource{
+			Projected: &core.ProjectedVolumeSource{Sources: sources},
+		},
+	})
+
+	m.volumeMounts = append(m.volumeMounts, core.VolumeMount{
+		Name:      name,
+		MountPath: mountPath,
+		ReadOnly:  true,
+	})
+}
+
+// Returns the name of every secret that the build references.
+func secretNames(build *spot.Build) []string {
+	var names []string
+	for _, secret := range build.Spec.Secrets {
+		names = append(names, secret.ValueFrom.Name)
+	}
+
+	for _, credential := range build.Spec.RepositoryCredentials {
+		names = append(names, credential.SecretRef)
+	}
+
+	for _, credential := range build.Spec.RegistryCredentials {
+		names = append(names, credential.SecretRef)
+	}
+
+	if signing := build.Spec.Image.Signing; signing != nil && signing.KeyRef != "" {
+		names = append(names, signing.KeyRef)
+	}
+
+	return names
+}
+
+// The builder always expects a JSON array, even when there's nothing to mount.
+func marshal[T any](values []T) (string, error) {
+	if values == nil {
+		values = []T{}
+	}
+
+	data, err := json.Marshal(values)
+	return string(data), err
+}
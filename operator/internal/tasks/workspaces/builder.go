@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 
+	"k8s.io/apimachinery/pkg/api/equality"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 
 	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
@@ -17,6 +19,9 @@ import (
 type Builder struct {
 	client.Client
 	record.EventRecorder
+
+	// Pull secrets of the operator, the images are resolved with them along with the workspace's own.
+	ImagePullSecrets []types.NamespacedName
 }
 
 // Reconcile is a sub-reconcile loop that will manage the reconcilation process for the `spot.WorkspaceconditionBuildingImages`.
@@ -30,19 +35,28 @@ type Builder struct {
 // Reconcile takes the workspace it's operating on as well as the condition. The condition could be implied here but since
 // it's already retrieved it to reach this state (the main reconciliation loop need to lookup the condition before calling this
 // sub-reconcile loop), it makes sense to just pass it here.
-func (b *Builder) Reconcile(ctx context.Context, workspace *spot.Workspace, condition *spot.WorkspaceCondition) (ctrl.Result, error) {
+func (b *Builder) Reconcile(ctx context.Context, workspace *spot.Workspace, condition *meta.Condition) (ctrl.Result, error) {
 	// The Builder condition is initialized which means it's ready to build all the image for this workspace.
-	if condition.Status == spot.ConditionInitialized {
+	if condition.Reason == spot.ConditionReasonInitialized {
 		if err := b.Build(ctx, workspace); err != nil {
 			return ctrl.Result{}, err
 		}
 	}
 
+	// The source requested for a component can change while its build is running, the
+	// build is now building an image nobody needs and needs to be replaced.
+	superseded, err := b.Supersede(ctx, workspace)
+	if err != nil || superseded {
+		return ctrl.Result{}, err
+	}
+
 	// At this point, a build has been dispatched for each of the components that needs to be built.
 	// Looking at the build status to see if there's something that needs to be done about them.
 	// At this point, only two states are of interests: Error & Done.
 	// Done means the workspace can move to the next sub-reconcile loop, a failure would mean
 	// the workspace needs to be marked as failed for the user to be notified of the error.
+	progress := &spot.BuildProgress{}
+	workspace.Status.Images = map[string]spot.BuildImage{}
 	for _, ref := range workspace.Status.Builds {
 		var build spot.Build
 		if err := b.Client.Get(ctx, ref.NamespacedName(), &build); err != nil {
@@ -51,25 +65,54 @@ func (b *Builder) Reconcile(ctx context.Context, workspace *spot.Workspace, cond
 
 		switch build.Status.Phase {
 		case spot.BuildPhaseError:
-			return ctrl.Result{}, fmt.Errorf("build failed")
+			for _, condition := range build.Status.Conditions {
+				if condition.Status == meta.ConditionFalse {
+					return ctrl.Result{}, fmt.Errorf("build %s failed at %s: %s", build.Name, condition.Type, condition.Message)
+				}
+			}
+			return ctrl.Result{}, fmt.Errorf("build %s failed", build.Name)
+
+		case spot.BuildPhaseCancelled:
+			return ctrl.Result{}, fmt.Errorf("build was cancelled")
 
 		case spot.BuildPhaseDone:
-			workspace.Status.Images = append(workspace.Status.Images, *build.Status.Image)
+			workspace.Status.Images[build.Labels[spot.BuildComponentLabel]] = *build.Status.Image
 		}
 
+		if build.Status.Progress != nil {
+			progress.Add(*build.Status.Progress)
+		}
 	}
 
 	// If the workspace's images size is not equal to the length
 	// of build references, it means that there are still builds that
 	// needs to be completed and the sub-reconciler needs to run again in
-	// the future.
+	// the future. The progress is only persisted when it changed as the workspace
+	// is reconciled every time one of its builds reports progress.
 	if len(workspace.Status.Images) != len(workspace.Status.Builds) {
-		return ctrl.Result{}, nil
+		if equality.Semantic.DeepEqual(workspace.Status.BuildProgress, progress) {
+			return ctrl.Result{}, nil
+		}
+
+		// Images are only persisted once all the builds are done.
+		workspace.Status.Images = nil
+		workspace.Status.BuildProgress = progress
+		return ctrl.Result{}, b.Status().Update(ctx, workspace)
+	}
+
+	workspace.Status.BuildProgress = progress
+
+	// The images of the components that aren't built are resolved once the builds are done,
+	// as close as possible to their deployment.
+	if err := b.Resolve(ctx, workspace); err != nil {
+		return ctrl.Result{}, err
 	}
 
-	workspace.Status.Conditions.SetCondition(&spot.WorkspaceCondition{
-		Type:   spot.WorkspaceConditionBuildingImages,
-		Status: spot.ConditionSuccess,
+	workspace.Status.Conditions.SetCondition(&meta.Condition{
+		Type:               string(spot.WorkspaceConditionBuildingImages),
+		Status:             meta.ConditionTrue,
+		Reason:             spot.ConditionReasonSucceeded,
+		ObservedGeneration: workspace.Generation,
 	})
 
 	if err := b.Status().Update(ctx, workspace); err != nil {
@@ -94,33 +137,13 @@ func (b *Builder) Build(ctx context.Context, workspace *spot.Workspace) error {
 			continue
 		}
 
-		build := &spot.Build{
-			ObjectMeta: meta.ObjectMeta{
-				Namespace:    workspace.Namespace,
-				GenerateName: fmt.Sprintf("%s-", component.Name),
-				OwnerReferences: []meta.OwnerReference{
-					{
-						Kind:       workspace.Kind,
-						Name:       workspace.Name,
-						APIVersion: workspace.APIVersion,
-						UID:        workspace.UID,
-					},
-				},
-			},
-			Spec: spot.BuildSpec{
-				Image: component.Image,
-			},
-		}
-
-		builds = append(builds, build)
+		builds = append(builds, newBuild(workspace, component))
 	}
 
+	// Without anything to build, the reconciliation goes on to resolve
+	// the images of the components before completing the condition.
 	if len(builds) == 0 {
-		workspace.Status.Conditions.SetCondition(&spot.WorkspaceCondition{
-			Type:   spot.WorkspaceConditionBuildingImages,
-			Status: spot.ConditionSuccess,
-		})
-		return b.Status().Update(ctx, workspace)
+		return nil
 	}
 
 	var references []spot.Reference
@@ -133,11 +156,105 @@ func (b *Builder) Build(ctx context.Context, workspace *spot.Workspace) error {
 		references = append(references, build.GetReference())
 	}
 
-	workspace.Status.Conditions.SetCondition(&spot.WorkspaceCondition{
-		Type:   spot.WorkspaceConditionBuildingImages,
-		Status: spot.ConditionInProgress,
+	workspace.Status.Conditions.SetCondition(&meta.Condition{
+		Type:               string(spot.WorkspaceConditionBuildingImages),
+		Status:             meta.ConditionUnknown,
+		Reason:             spot.ConditionReasonStarted,
+		ObservedGeneration: workspace.Generation,
 	})
 	workspace.Status.Builds = references
 
 	return b.Status().Update(ctx, workspace)
 }
+
+// Supersede cancels the builds that were dispatched for a source that is no longer the one
+// requested by their component (ie. a new commit) and dispatches a new build for the component's current source.
+// It returns true if any build was superseded, in which case the workspace's status was updated.
+func (b *Builder) Supersede(ctx context.Context, workspace *spot.Workspace) (bool, error) {
+	components := map[string]spot.ComponentSpec{}
+	for _, component := range workspace.Spec.Components {
+		components[component.Name] = component
+	}
+
+	superseded := false
+	for i, ref := range workspace.Status.Builds {
+		var build spot.Build
+		if err := b.Client.Get(ctx, ref.NamespacedName(), &build); err != nil {
+			return false, err
+		}
+
+		if build.Status.Phase == spot.BuildPhaseDone || build.Spec.Cancel {
+			continue
+		}
+
+		component, ok := components[build.Labels[spot.BuildComponentLabel]]
+		if !ok || component.Image.Repository == nil || build.Spec.Image.Repository == nil {
+			continue
+		}
+
+		// Either of them can have the deprecated git fields.
+		requested := component.Image.Repository.DeepCopy()
+		requested.Default()
+		built := build.Spec.Image.Repository.DeepCopy()
+		built.Default()
+
+		if equality.Semantic.DeepEqual(requested, built) {
+			continue
+		}
+
+		build.Spec.Cancel = true
+		if err := b.Client.Update(ctx, &build); err != nil {
+			return false, err
+		}
+
+		replacement := newBuild(workspace, component)
+		if err := b.Client.Create(ctx, replacement); err != nil {
+			return false, err
+		}
+
+		b.EventRecorder.Event(workspace, "Normal", string(spot.WorkspaceConditionBuildingImages), fmt.Sprintf("build %s superseded by %s", build.Name, replacement.Name))
+		workspace.Status.Builds[i] = replacement.GetReference()
+		superseded = true
+	}
+
+	if !superseded {
+		return false, nil
+	}
+
+	// Images are only persisted once all the builds are done.
+	workspace.Status.Images = nil
+	return true, b.Status().Update(ctx, workspace)
+}
+
+func newBuild(workspace *spot.Workspace, component spot.ComponentSpec) *spot.Build {
+	// The build doesn't share anything with the spec of the workspace.
+	spec := component.DeepCopy()
+	if spec.Image.Repository != nil {
+		spec.Image.Repository.Default()
+	}
+
+	return &spot.Build{
+		ObjectMeta: meta.ObjectMeta{
+			Namespace:    workspace.Namespace,
+			GenerateName: fmt.Sprintf("%s-", component.Name),
+			Labels: map[string]string{
+				spot.BuildComponentLabel: component.Name,
+			},
+			OwnerReferences: []meta.OwnerReference{
+				{
+					Kind:       workspace.Kind,
+					Name:       workspace.Name,
+					APIVersion: workspace.APIVersion,
+					UID:        workspace.UID,
+				},
+			},
+		},
+		Spec: spot.BuildSpec{
+			Image:                 spec.Image,
+			Arguments:             spec.Arguments,
+			Secrets:               spec.Secrets,
+			RegistryCredentials:   spec.RegistryCredentials,
+			RepositoryCredentials: spec.RepositoryCredentials,
+		},
+	}
+}
@@ -0,0 +1,186 @@
+package workspaces
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+var _ = Describe("Builder", func() {
+	var c client.Client
+	var builder *Builder
+	var workspace *spot.Workspace
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(spot.AddToScheme(scheme)).To(Succeed())
+
+		workspace = &spot.Workspace{ObjectMeta: meta.ObjectMeta{Namespace: "team", Name: "preview"}}
+		c = fake.NewClientBuilder().WithScheme(scheme).WithObjects(workspace).WithStatusSubresource(workspace).Build()
+		builder = &Builder{Client: c, EventRecorder: record.NewFakeRecorder(10)}
+	})
+
+	newBuild := func(component string, repository *spot.RepositorySpec) *spot.Build {
+		build := &spot.Build{
+			ObjectMeta: meta.ObjectMeta{
+				Namespace:    "team",
+				GenerateName: "build-",
+				Labels:       map[string]string{spot.BuildComponentLabel: component},
+			},
+			Spec: spot.BuildSpec{Image: spot.ImageSpec{Repository: repository}},
+		}
+		Expect(c.Create(context.TODO(), build)).To(Succeed())
+
+		workspace.Status.Builds = append(workspace.Status.Builds, build.GetReference())
+		return build
+	}
+
+	gitRepository := func(hash string) *spot.RepositorySpec {
+		return &spot.RepositorySpec{Context: ".", Git: &spot.GitSource{
+			URL:       "https://github.com/releasehub-com/spot.git",
+			Reference: spot.GitReference{Name: "main", Hash: hash},
+		}}
+	}
+
+	Context("Supersede", func() {
+		It("cancels the builds of a source that changed and dispatches a new build", func() {
+			workspace.Spec.Components = []spot.ComponentSpec{{
+				Name:  "app",
+				Image: spot.ImageSpec{Repository: gitRepository("0d1d9a4f2bd5e1b4a1f3e4c9d8b8a6e0f9c2b7a1")},
+			}}
+			previous := newBuild("app", gitRepository("5e2c8f3a9b7d6e1f0a4c3b2d1e9f8a7b6c5d4e3f"))
+
+			superseded, err := builder.Supersede(context.TODO(), workspace)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(superseded).To(BeTrue())
+
+			Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(previous), previous)).To(Succeed())
+			Expect(previous.Spec.Cancel).To(BeTrue())
+
+			Expect(workspace.Status.Builds).To(HaveLen(1))
+			var replacement spot.Build
+			Expect(c.Get(context.TODO(), workspace.Status.Builds[0].NamespacedName(), &replacement)).To(Succeed())
+			Expect(replacement.Name).NotTo(Equal(previous.Name))
+			Expect(replacement.Labels).To(HaveKeyWithValue(spot.BuildComponentLabel, "app"))
+			Expect(replacement.Spec.Image.Repository).To(Equal(workspace.Spec.Components[0].Image.Repository))
+		})
+
+		It("keeps the builds of the same source", func() {
+			workspace.Spec.Components = []spot.ComponentSpec{{
+				Name:  "app",
+				Image: spot.ImageSpec{Repository: gitRepository("0d1d9a4f2bd5e1b4a1f3e4c9d8b8a6e0f9c2b7a1")},
+			}}
+			newBuild("app", gitRepository("0d1d9a4f2bd5e1b4a1f3e4c9d8b8a6e0f9c2b7a1"))
+
+			// Builds created before the sources were a union have the git fields inline.
+			newBuild("app", &spot.RepositorySpec{
+				Context:   ".",
+				URL:       "https://github.com/releasehub-com/spot.git",
+				Reference: &spot.GitReference{Name: "main", Hash: "0d1d9a4f2bd5e1b4a1f3e4c9d8b8a6e0f9c2b7a1"},
+			})
+
+			superseded, err := builder.Supersede(context.TODO(), workspace)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(superseded).To(BeFalse())
+		})
+	})
+
+	Context("Build", func() {
+		It("dispatches the builds with the arguments, secrets and credentials of their component", func() {
+			workspace.Spec.Components = []spot.ComponentSpec{{
+				Name:      "app",
+				Image:     spot.ImageSpec{Repository: gitRepository("0d1d9a4f2bd5e1b4a1f3e4c9d8b8a6e0f9c2b7a1")},
+				Arguments: []spot.BuildArgument{{Name: "RAILS_ENV", Value: "production"}},
+				Secrets: []spot.BuildSecret{{Name: "npmrc", ValueFrom: core.SecretKeySelector{
+					LocalObjectReference: core.LocalObjectReference{Name: "npm"},
+					Key:                  ".npmrc",
+				}}},
+				RegistryCredentials:   []spot.CredentialSpec{{Host: "ghcr.io", SecretRef: "ghcr"}},
+				RepositoryCredentials: []spot.CredentialSpec{{Host: "https://github.com/releasehub-com/spot.git", Type: spot.CredentialTypeSSH, SecretRef: "deploy-key"}},
+			}}
+
+			Expect(builder.Build(context.TODO(), workspace)).To(Succeed())
+			Expect(workspace.Status.Builds).To(HaveLen(1))
+
+			var build spot.Build
+			Expect(c.Get(context.TODO(), workspace.Status.Builds[0].NamespacedName(), &build)).To(Succeed())
+			component := workspace.Spec.Components[0]
+			Expect(build.Spec.Arguments).To(Equal(component.Arguments))
+			Expect(build.Spec.Secrets).To(Equal(component.Secrets))
+			Expect(build.Spec.RegistryCredentials).To(Equal(component.RegistryCredentials))
+			Expect(build.Spec.RepositoryCredentials).To(Equal(component.RepositoryCredentials))
+		})
+	})
+
+	Context("Reconcile", func() {
+		It("records the image of each build under its component", func() {
+			workspace.Spec.Components = []spot.ComponentSpec{
+				{Name: "api", Image: spot.ImageSpec{Repository: gitRepository("0d1d9a4f2bd5e1b4a1f3e4c9d8b8a6e0f9c2b7a1")}},
+				{Name: "web", Image: spot.ImageSpec{Repository: gitRepository("0d1d9a4f2bd5e1b4a1f3e4c9d8b8a6e0f9c2b7a1")}},
+			}
+
+			for _, component := range []string{"api", "web"} {
+				build := newBuild(component, gitRepository("0d1d9a4f2bd5e1b4a1f3e4c9d8b8a6e0f9c2b7a1"))
+				build.Status.Phase = spot.BuildPhaseDone
+				build.Status.Image = &spot.BuildImage{URL: "ghcr.io/org/" + component, Reference: "ghcr.io/org/" + component + "@sha256:" + component}
+				Expect(c.Update(context.TODO(), build)).To(Succeed())
+			}
+
+			condition := &meta.Condition{Type: string(spot.WorkspaceConditionBuildingImages), Status: meta.ConditionUnknown, Reason: spot.ConditionReasonStarted}
+			_, err := builder.Reconcile(context.TODO(), workspace, condition)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(workspace.Status.Images).To(HaveLen(2))
+			Expect(workspace.Status.Images).To(HaveKeyWithValue("api", HaveField("URL", "ghcr.io/org/api")))
+			Expect(workspace.Status.Images).To(HaveKeyWithValue("web", HaveField("URL", "ghcr.io/org/web")))
+			Expect(workspace.Status.Conditions.GetCondition(spot.WorkspaceConditionBuildingImages).Status).To(Equal(meta.ConditionTrue))
+		})
+
+		It("completes the condition when there's nothing to build", func() {
+			server := httptest.NewServer(registry.New())
+			DeferCleanup(server.Close)
+			u, err := url.Parse(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+
+			image, err := random.Image(64, 1)
+			Expect(err).NotTo(HaveOccurred())
+			ref, err := name.ParseReference(u.Host + "/mysql:latest")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.Write(ref, image)).To(Succeed())
+			digest, err := image.Digest()
+			Expect(err).NotTo(HaveOccurred())
+
+			workspace.Spec.Components = []spot.ComponentSpec{{
+				Name:  "mysql",
+				Image: spot.ImageSpec{Registry: spot.RegistrySpec{URL: u.Host + "/mysql"}},
+			}}
+
+			condition := &meta.Condition{Type: string(spot.WorkspaceConditionBuildingImages), Status: meta.ConditionUnknown, Reason: spot.ConditionReasonInitialized}
+			_, err = builder.Reconcile(context.TODO(), workspace, condition)
+			Expect(err).NotTo(HaveOccurred())
+
+			var updated spot.Workspace
+			Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(workspace), &updated)).To(Succeed())
+			Expect(updated.Status.Builds).To(BeEmpty())
+			Expect(updated.Status.Images).To(HaveKeyWithValue("mysql", HaveField("Digest", digest.String())))
+			Expect(updated.Status.Conditions.GetCondition(spot.WorkspaceConditionBuildingImages).Status).To(Equal(meta.ConditionTrue))
+		})
+	})
+})
@@ -29,7 +29,7 @@ type Deployer struct {
 // Reconcile takes the workspace it's operating on as well as the condition. The condition could be implied here but since
 // it's already retrieved it to reach this state (the main reconciliation loop need to lookup the condition before calling this
 // sub-reconcile loop), it makes sense to just pass it here.
-func (d *Deployer) Reconcile(ctx context.Context, workspace *spot.Workspace, condition *spot.WorkspaceCondition) (ctrl.Result, error) {
+func (d *Deployer) Reconcile(ctx context.Context, workspace *spot.Workspace, condition *meta.Condition) (ctrl.Result, error) {
 	d.EventRecorder.Event(workspace, "Normal", "Deploying", "Deploying services and updating routes")
 
 	for _, component := range workspace.Spec.Components {
@@ -38,12 +38,7 @@ func (d *Deployer) Reconcile(ctx context.Context, workspace *spot.Workspace, con
 			return ctrl.Result{}, err
 		}
 
-		registry := component.Image.Registry
-
-		imageName := registry.URL
-		if len(registry.Tags) != 0 {
-			imageName = fmt.Sprintf("%s:%s", imageName, registry.Tags[0])
-		}
+		imageName := imageForComponent(&component, workspace)
 
 		pod := core.Pod{
 			ObjectMeta: meta.ObjectMeta{
@@ -146,3 +141,15 @@ func (d *Deployer) valueForEnvironmentName(name string, workspace *spot.Workspac
 
 	return value, nil
 }
+
+// Components are deployed by the digest of their image, either the image that was built for them or
+// the image their tag was resolved to, so the pod runs exactly that image even if its tags are moved.
+// Components missing from the images fall back to the tag of their registry.
+func imageForComponent(component *spot.ComponentSpec, workspace *spot.Workspace) string {
+	if image, ok := workspace.Status.Images[component.Name]; ok && image.Reference != "" {
+		return image.Reference
+	}
+
+	registry := component.Image.Registry
+	return fmt.Sprintf("%s:%s", registry.URL, registry.DeployTag())
+}
@@ -0,0 +1,62 @@
+package workspaces
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+var _ = Describe("Deployer", func() {
+	const digest = "sha256:0d1d9a4f2bd5e1b4a1f3e4c9d8b8a6e0f9c2b7a10d1d9a4f2bd5e1b4a1f3e4c9"
+
+	It("deploys the components by digest, falling back to the tag of their registry", func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(spot.AddToScheme(scheme)).To(Succeed())
+
+		tag := "8"
+		workspace := &spot.Workspace{
+			ObjectMeta: meta.ObjectMeta{Namespace: "team", Name: "preview"},
+			Spec: spot.WorkspaceSpec{Components: []spot.ComponentSpec{
+				{Name: "app", Image: spot.ImageSpec{Registry: spot.RegistrySpec{URL: "ghcr.io/org/app", Tags: []string{"v1"}}}},
+				{Name: "mysql", Image: spot.ImageSpec{Registry: spot.RegistrySpec{URL: "mysql", Tag: &tag}}},
+				{Name: "redis", Image: spot.ImageSpec{Registry: spot.RegistrySpec{URL: "redis"}}},
+			}},
+			Status: spot.WorkspaceStatus{
+				Namespace: "workspace-preview-1234",
+				Images: map[string]spot.BuildImage{
+					"app":   {URL: "ghcr.io/org/app", Digest: digest, Reference: "ghcr.io/org/app@" + digest},
+					"redis": {URL: "redis"},
+				},
+			},
+		}
+
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(workspace).WithStatusSubresource(workspace).Build()
+		deployer := &Deployer{Client: c, EventRecorder: record.NewFakeRecorder(10)}
+		_, err := deployer.Reconcile(context.TODO(), workspace, &meta.Condition{})
+		Expect(err).NotTo(HaveOccurred())
+
+		images := map[string]string{}
+		for _, name := range []string{"app", "mysql", "redis"} {
+			var pod core.Pod
+			Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: "workspace-preview-1234", Name: name}, &pod)).To(Succeed())
+			images[name] = pod.Spec.Containers[0].Image
+		}
+
+		Expect(images).To(Equal(map[string]string{
+			"app":   "ghcr.io/org/app@" + digest,
+			"mysql": "mysql:8",
+			"redis": "redis:latest",
+		}))
+	})
+})
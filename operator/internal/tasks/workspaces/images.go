@@ -0,0 +1,181 @@
+package workspaces
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	core "k8s.io/api/core/v1"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var (
+	ErrImageUnresolved   = errors.New("couldn't resolve the image")
+	ErrImageURLMissing   = errors.New("image has no registry URL")
+	ErrPullSecretInvalid = errors.New("pull secret is not a valid dockerconfigjson secret")
+
+	// ErrRegistryUnavailable is returned when the image couldn't be resolved because the registry
+	// couldn't be reached or was overloaded, resolving the image again later is likely to succeed.
+	ErrRegistryUnavailable = fmt.Errorf("%w: registry is unavailable", ErrImageUnresolved)
+)
+
+// Resolve pins the image of every component that isn't built to the digest its tag points to
+// right now, so the pods of the workspace run the same image even if the tag is moved or the pods
+// are restarted. Resolving the image also verifies it exists and can be pulled with the
+// workspace's pull secrets before anything is deployed.
+func (b *Builder) Resolve(ctx context.Context, workspace *spot.Workspace) error {
+	logger := log.FromContext(ctx)
+
+	var keychain authn.Keychain
+	for _, component := range workspace.Spec.Components {
+		if component.Image.Repository != nil {
+			continue
+		}
+
+		if keychain == nil {
+			var err error
+			if keychain, err = b.pullKeychain(ctx, workspace); err != nil {
+				return err
+			}
+		}
+
+		image, err := ResolveImage(ctx, component.Image.Registry, keychain)
+		if err != nil {
+			return fmt.Errorf("component %s: %w", component.Name, err)
+		}
+
+		if workspace.Status.Images == nil {
+			workspace.Status.Images = map[string]spot.BuildImage{}
+		}
+		workspace.Status.Images[component.Name] = *image
+
+		logger.Info("Resolved the image", "component", component.Name, "reference", image.Reference)
+	}
+
+	return nil
+}
+
+// ResolveImage looks up the digest of the registry's deploy tag and returns the image pinned to it.
+func ResolveImage(ctx context.Context, registry spot.RegistrySpec, keychain authn.Keychain) (*spot.BuildImage, error) {
+	if registry.URL == "" {
+		return nil, ErrImageURLMissing
+	}
+
+	tag := registry.DeployTag()
+	ref, err := name.ParseReference(fmt.Sprintf("%s:%s", registry.URL, tag))
+	if err != nil {
+		return nil, fmt.Errorf("%w(%s): %s", ErrImageUnresolved, registry.URL, err)
+	}
+
+	// Fetching the manifest, instead of only its head, is what a node does before pulling
+	// the image. Some registries also don't return the digest for a HEAD request.
+	descriptor, err := remote.Get(ref, remote.WithContext(ctx), remote.WithAuthFromKeychain(keychain))
+	if err != nil {
+		if isRegistryUnavailable(err) {
+			return nil, fmt.Errorf("%w(%s): %s", ErrRegistryUnavailable, ref.Name(), err)
+		}
+
+		return nil, fmt.Errorf("%w(%s): %s", ErrImageUnresolved, ref.Name(), err)
+	}
+
+	return &spot.BuildImage{
+		URL:       registry.URL,
+		Digest:    descriptor.Digest.String(),
+		Reference: ref.Context().Digest(descriptor.Digest.String()).Name(),
+		Tags:      []string{tag},
+	}, nil
+}
+
+// The registry is unavailable when it can't be reached, is rate limiting the requests or fails
+// to process them. Any other error, like a missing image or invalid credentials, is final.
+func isRegistryUnavailable(err error) bool {
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) {
+		return transportErr.StatusCode == http.StatusTooManyRequests || transportErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func (b *Builder) pullKeychain(ctx context.Context, workspace *spot.Workspace) (authn.Keychain, error) {
+	var secrets []core.Secret
+	for _, source := range PullSecretSources(workspace, b.ImagePullSecrets) {
+		var secret core.Secret
+		if err := b.Client.Get(ctx, source, &secret); err != nil {
+			return nil, err
+		}
+
+		secrets = append(secrets, secret)
+	}
+
+	return NewPullSecretsKeychain(secrets)
+}
+
+// PullSecretsKeychain resolves the credentials of a registry from the `kubernetes.io/dockerconfigjson`
+// secrets the same way the kubelet does, the first secret that has credentials for the registry wins.
+// Registries without credentials are accessed anonymously.
+type PullSecretsKeychain struct {
+	auths []map[string]authn.AuthConfig
+}
+
+func NewPullSecretsKeychain(secrets []core.Secret) (*PullSecretsKeychain, error) {
+	keychain := &PullSecretsKeychain{}
+	for _, secret := range secrets {
+		data, ok := secret.Data[core.DockerConfigJsonKey]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrPullSecretInvalid, secret.Name)
+		}
+
+		var config struct {
+			Auths map[string]authn.AuthConfig `json:"auths"`
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrPullSecretInvalid, secret.Name)
+		}
+
+		auths := map[string]authn.AuthConfig{}
+		// The `auth` field is decoded in the username and password along with the config.
+		for host, auth := range config.Auths {
+			auths[normalizeRegistry(host)] = auth
+		}
+
+		keychain.auths = append(keychain.auths, auths)
+	}
+
+	return keychain, nil
+}
+
+func (k *PullSecretsKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	registry := normalizeRegistry(target.RegistryStr())
+	for _, auths := range k.auths {
+		if auth, ok := auths[registry]; ok {
+			return authn.FromConfig(auth), nil
+		}
+	}
+
+	return authn.Anonymous, nil
+}
+
+// Docker config files reference DockerHub in many ways (ie. https://index.docker.io/v1/, docker.io).
+func normalizeRegistry(host string) string {
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+
+	switch host {
+	case "docker.io", "registry-1.docker.io":
+		return name.DefaultRegistry
+	}
+
+	return host
+}
@@ -0,0 +1,142 @@
+package workspaces
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func pullSecret(name, config string) core.Secret {
+	return core.Secret{
+		ObjectMeta: meta.ObjectMeta{Name: name},
+		Type:       core.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{core.DockerConfigJsonKey: []byte(config)},
+	}
+}
+
+var _ = Describe("Images", func() {
+	Context("PullSecretsKeychain", func() {
+		It("resolves the credentials of the first secret with the registry", func() {
+			auth := base64.StdEncoding.EncodeToString([]byte("robot:token"))
+			keychain, err := NewPullSecretsKeychain([]core.Secret{
+				pullSecret("hub", `{"auths":{"https://index.docker.io/v1/":{"auth":"`+auth+`"}}}`),
+				pullSecret("ghcr", `{"auths":{"ghcr.io":{"username":"octocat","password":"secret"}}}`),
+				pullSecret("other", `{"auths":{"ghcr.io":{"username":"other","password":"other"}}}`),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			authenticator, err := keychain.Resolve(name.MustParseReference("mysql:8").Context())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(authenticator.Authorization()).To(SatisfyAll(HaveField("Username", "robot"), HaveField("Password", "token")))
+
+			authenticator, err = keychain.Resolve(name.MustParseReference("ghcr.io/org/app").Context())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(authenticator.Authorization()).To(SatisfyAll(HaveField("Username", "octocat"), HaveField("Password", "secret")))
+
+			authenticator, err = keychain.Resolve(name.MustParseReference("quay.io/org/app").Context())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(authenticator).To(Equal(authn.Anonymous))
+		})
+
+		It("rejects secrets that aren't docker configs", func() {
+			_, err := NewPullSecretsKeychain([]core.Secret{{ObjectMeta: meta.ObjectMeta{Name: "opaque"}}})
+			Expect(err).To(MatchError(ErrPullSecretInvalid))
+
+			_, err = NewPullSecretsKeychain([]core.Secret{pullSecret("invalid", "not json")})
+			Expect(err).To(MatchError(ErrPullSecretInvalid))
+		})
+	})
+
+	Context("ResolveImage", func() {
+		var host string
+
+		BeforeEach(func() {
+			handler := registry.New()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if username, password, ok := r.BasicAuth(); !ok || username != "robot" || password != "token" {
+					w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
+				handler.ServeHTTP(w, r)
+			}))
+			DeferCleanup(server.Close)
+
+			u, err := url.Parse(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			host = u.Host
+		})
+
+		It("pins the deploy tag to its digest", func() {
+			keychain, err := NewPullSecretsKeychain([]core.Secret{
+				pullSecret("registry", `{"auths":{"`+host+`":{"username":"robot","password":"token"}}}`),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			image, err := random.Image(64, 1)
+			Expect(err).NotTo(HaveOccurred())
+			digest, err := image.Digest()
+			Expect(err).NotTo(HaveOccurred())
+			ref, err := name.ParseReference(host + "/mysql:8")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.Write(ref, image, remote.WithAuthFromKeychain(keychain))).To(Succeed())
+
+			tag := "8"
+			resolved, err := ResolveImage(context.TODO(), spot.RegistrySpec{URL: host + "/mysql", Tag: &tag, Tags: []string{"latest"}}, keychain)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*resolved).To(Equal(spot.BuildImage{
+				URL:       host + "/mysql",
+				Digest:    digest.String(),
+				Reference: host + "/mysql@" + digest.String(),
+				Tags:      []string{"8"},
+			}))
+		})
+
+		It("fails when the image can't be pulled", func() {
+			_, err := ResolveImage(context.TODO(), spot.RegistrySpec{URL: host + "/mysql"}, authn.DefaultKeychain)
+			Expect(err).To(MatchError(ErrImageUnresolved))
+
+			_, err = ResolveImage(context.TODO(), spot.RegistrySpec{}, authn.DefaultKeychain)
+			Expect(err).To(MatchError(ErrImageURLMissing))
+		})
+
+		It("reports the registries that can't be reached as unavailable", func() {
+			server := httptest.NewServer(http.NotFoundHandler())
+			unreachable := server.Listener.Addr().String()
+			server.Close()
+
+			_, err := ResolveImage(context.TODO(), spot.RegistrySpec{URL: unreachable + "/mysql"}, authn.DefaultKeychain)
+			Expect(err).To(MatchError(ErrRegistryUnavailable))
+			Expect(err).To(MatchError(ErrImageUnresolved))
+
+			_, err = ResolveImage(context.TODO(), spot.RegistrySpec{URL: host + "/mysql"}, authn.DefaultKeychain)
+			Expect(err).NotTo(MatchError(ErrRegistryUnavailable))
+		})
+
+		DescribeTable("classifies the errors of the registry",
+			func(status int, unavailable bool) {
+				Expect(isRegistryUnavailable(fmt.Errorf("wrapped: %w", &transport.Error{StatusCode: status}))).To(Equal(unavailable))
+			},
+			Entry("rate limited", http.StatusTooManyRequests, true),
+			Entry("server error", http.StatusServiceUnavailable, true),
+			Entry("missing image", http.StatusNotFound, false),
+			Entry("unauthorized", http.StatusUnauthorized, false),
+		)
+	})
+})
@@ -7,6 +7,7 @@ import (
 	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -15,6 +16,13 @@ import (
 type Namespacer struct {
 	client.Client
 	record.EventRecorder
+
+	// Reads the pull secrets and their copies. The cache of the manager only holds the pull
+	// secrets, the client reads every secret from the API server.
+	Cache client.Reader
+
+	// Pull secrets copied to the namespace of every workspace, along with the workspace's own.
+	ImagePullSecrets []types.NamespacedName
 }
 
 // Reconcile is a sub-reconcile loop that will manage the reconcilation process for the `spot.WorkspaceconditionNamespace`.
@@ -28,7 +36,7 @@ type Namespacer struct {
 // Reconcile takes the workspace it's operating on as well as the condition. The condition could be implied here but since
 // it's already retrieved it to reach this state (the main reconciliation loop need to lookup the condition before calling this
 // sub-reconcile loop), it makes sense to just pass it here.
-func (n *Namespacer) Reconcile(ctx context.Context, workspace *spot.Workspace, condition *spot.WorkspaceCondition) (ctrl.Result, error) {
+func (n *Namespacer) Reconcile(ctx context.Context, workspace *spot.Workspace, condition *meta.Condition) (ctrl.Result, error) {
 	if len(workspace.Status.Namespace) == 0 {
 		namespace := core.Namespace{
 			ObjectMeta: meta.ObjectMeta{
@@ -40,12 +48,23 @@ func (n *Namespacer) Reconcile(ctx context.Context, workspace *spot.Workspace, c
 			return ctrl.Result{}, err
 		}
 
+		// The namespace is persisted right away so that a failure to sync
+		// the pull secrets doesn't create another namespace when retried.
 		workspace.Status.Namespace = namespace.Name
+		if err := n.Client.Status().Update(ctx, workspace); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := n.SyncPullSecrets(ctx, workspace); err != nil {
+		return ctrl.Result{}, err
 	}
 
-	workspace.Status.Conditions.SetCondition(&spot.WorkspaceCondition{
-		Type:   spot.WorkspaceConditionNamespace,
-		Status: spot.ConditionSuccess,
+	workspace.Status.Conditions.SetCondition(&meta.Condition{
+		Type:               string(spot.WorkspaceConditionNamespace),
+		Status:             meta.ConditionTrue,
+		Reason:             spot.ConditionReasonSucceeded,
+		ObservedGeneration: workspace.Generation,
 	})
 
 	if err := n.Client.Status().Update(ctx, workspace); err != nil {
@@ -38,7 +38,7 @@ const CertClusterIssuerName = "spot-workspace-issuer"
 // Reconcile takes the workspace it's operating on as well as the condition. The condition could be implied here but since
 // it's already retrieved it to reach this state (the main reconciliation loop need to lookup the condition before calling this
 // sub-reconcile loop), it makes sense to just pass it here.
-func (n *Networking) Reconcile(ctx context.Context, workspace *spot.Workspace, condition *spot.WorkspaceCondition) (ctrl.Result, error) {
+func (n *Networking) Reconcile(ctx context.Context, workspace *spot.Workspace, condition *meta.Condition) (ctrl.Result, error) {
 	workspace.Status.Services = make(map[string]spot.Reference)
 	ingressClassName := "nginx"
 	ingress := &networking.Ingress{
@@ -103,9 +103,11 @@ func (n *Networking) Reconcile(ctx context.Context, workspace *spot.Workspace, c
 		SecretName: fmt.Sprintf("%s-ingress-cert", workspace.Name),
 	}}
 
-	workspace.Status.Conditions.SetCondition(&spot.WorkspaceCondition{
-		Type:   spot.WorkspaceConditionNetworking,
-		Status: spot.ConditionSuccess,
+	workspace.Status.Conditions.SetCondition(&meta.Condition{
+		Type:               string(spot.WorkspaceConditionNetworking),
+		Status:             meta.ConditionTrue,
+		Reason:             spot.ConditionReasonSucceeded,
+		ObservedGeneration: workspace.Generation,
 	})
 
 	if err := n.Status().Update(ctx, workspace); err != nil {
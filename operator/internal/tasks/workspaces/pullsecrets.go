@@ -0,0 +1,248 @@
+package workspaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var ErrPullSecretConflict = errors.New("a secret that isn't a copy of the pull secret has its name")
+
+// The service account the pods of the workspace run with.
+const kDefaultServiceAccount = "default"
+
+// Field the workspaces are indexed by, with the name of each of their pull secrets.
+const PullSecretsField = ".spec.imagePullSecrets"
+
+// PullSecretNames returns the name of the workspace's pull secrets, the values of its PullSecretsField index.
+func PullSecretNames(obj client.Object) []string {
+	var names []string
+	for _, ref := range obj.(*spot.Workspace).Spec.ImagePullSecrets {
+		names = append(names, ref.Name)
+	}
+
+	return names
+}
+
+// IsPullSecretSource returns false for the copies of the pull secrets, which are
+// never the source of a workspace's pull secrets.
+func IsPullSecretSource(secret client.Object) bool {
+	_, copied := secret.GetAnnotations()[spot.WorkspacePullSecretSourceAnnotation]
+	return !copied
+}
+
+// PullSecretSources returns the secrets the images of the workspace are pulled with: the secrets of the
+// workspace, followed by the secrets configured for the operator.
+func PullSecretSources(workspace *spot.Workspace, global []types.NamespacedName) []types.NamespacedName {
+	var sources []types.NamespacedName
+	for _, ref := range workspace.Spec.ImagePullSecrets {
+		sources = append(sources, types.NamespacedName{Namespace: workspace.Namespace, Name: ref.Name})
+	}
+
+	return append(sources, global...)
+}
+
+// SyncPullSecrets copies the pull secrets of the workspace in its namespace and attaches them to the
+// namespace's default service account so the pods can pull their images from private registries. The copies
+// are updated when their source changed, which is how rotated credentials reach the workspace, and the copies
+// of the secrets that aren't pull secrets of the workspace anymore are deleted.
+// When two sources have the same name, the first one is used.
+func (n *Namespacer) SyncPullSecrets(ctx context.Context, workspace *spot.Workspace) error {
+	logger := log.FromContext(ctx)
+
+	var refs []core.LocalObjectReference
+	copied := map[string]bool{}
+	for _, source := range PullSecretSources(workspace, n.ImagePullSecrets) {
+		if copied[source.Name] {
+			continue
+		}
+		copied[source.Name] = true
+
+		var secret core.Secret
+		if err := n.Cache.Get(ctx, source, &secret); err != nil {
+			return err
+		}
+
+		if secret.Type != core.SecretTypeDockerConfigJson {
+			return fmt.Errorf("%w: %s", ErrPullSecretInvalid, source)
+		}
+
+		updated, err := n.syncPullSecret(ctx, workspace.Status.Namespace, source, &secret)
+		if err != nil {
+			return err
+		}
+
+		if updated {
+			logger.Info("Synced the pull secret", "source", source, "namespace", workspace.Status.Namespace)
+		}
+
+		refs = append(refs, core.LocalObjectReference{Name: source.Name})
+	}
+
+	pruned, err := n.prunePullSecrets(ctx, workspace.Status.Namespace, copied)
+	if err != nil {
+		return err
+	}
+
+	if len(refs) == 0 && len(pruned) == 0 {
+		return nil
+	}
+
+	return n.attachPullSecrets(ctx, workspace.Status.Namespace, refs, pruned)
+}
+
+// The copy is only updated when it's a copy of a pull secret, a secret of the namespace with the same
+// name that wasn't created by the namespacer is never overwritten.
+func (n *Namespacer) syncPullSecret(ctx context.Context, namespace string, source types.NamespacedName, secret *core.Secret) (bool, error) {
+	var existing core.Secret
+	err := n.Cache.Get(ctx, types.NamespacedName{Namespace: namespace, Name: source.Name}, &existing)
+	if k8sErrors.IsNotFound(err) {
+		return true, n.Client.Create(ctx, &core.Secret{
+			ObjectMeta: meta.ObjectMeta{
+				Name:      source.Name,
+				Namespace: namespace,
+				Annotations: map[string]string{
+					spot.WorkspacePullSecretSourceAnnotation: source.String(),
+				},
+			},
+			Type: secret.Type,
+			Data: secret.Data,
+		})
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if IsPullSecretSource(&existing) {
+		return false, fmt.Errorf("%w: %s/%s", ErrPullSecretConflict, namespace, source.Name)
+	}
+
+	// The source changes when a secret of the workspace with the same name as one of the
+	// operator's pull secrets is added or removed.
+	if existing.Annotations[spot.WorkspacePullSecretSourceAnnotation] == source.String() && equality.Semantic.DeepEqual(existing.Data, secret.Data) {
+		return false, nil
+	}
+
+	existing.Annotations[spot.WorkspacePullSecretSourceAnnotation] = source.String()
+	existing.Data = secret.Data
+	return true, n.Client.Update(ctx, &existing)
+}
+
+// Delete the copies of the secrets that aren't pull secrets of the workspace anymore, the name of
+// the deleted copies is returned so they can be detached from the service account.
+func (n *Namespacer) prunePullSecrets(ctx context.Context, namespace string, copied map[string]bool) (map[string]bool, error) {
+	var secrets core.SecretList
+	if err := n.Cache.List(ctx, &secrets, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+
+	pruned := map[string]bool{}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if IsPullSecretSource(secret) || copied[secret.Name] {
+			continue
+		}
+
+		if err := n.Client.Delete(ctx, secret); err != nil && !k8sErrors.IsNotFound(err) {
+			return nil, err
+		}
+
+		log.FromContext(ctx).Info("Deleted the copy of a pull secret", "secret", secret.Name, "namespace", namespace)
+		pruned[secret.Name] = true
+	}
+
+	return pruned, nil
+}
+
+// The default service account is created by kubernetes shortly after the namespace, the namespacer
+// creates it when it doesn't exist yet. The pull secrets that were added by other means stay attached.
+func (n *Namespacer) attachPullSecrets(ctx context.Context, namespace string, refs []core.LocalObjectReference, pruned map[string]bool) error {
+	var account core.ServiceAccount
+	err := n.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: kDefaultServiceAccount}, &account)
+	if k8sErrors.IsNotFound(err) {
+		if len(refs) == 0 {
+			return nil
+		}
+
+		account = core.ServiceAccount{
+			ObjectMeta:       meta.ObjectMeta{Name: kDefaultServiceAccount, Namespace: namespace},
+			ImagePullSecrets: refs,
+		}
+
+		return n.Client.Create(ctx, &account)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	var attached []core.LocalObjectReference
+	for _, ref := range account.ImagePullSecrets {
+		if pruned[ref.Name] {
+			changed = true
+			continue
+		}
+
+		attached = append(attached, ref)
+	}
+
+	for _, ref := range refs {
+		if !containsRef(attached, ref) {
+			attached = append(attached, ref)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	account.ImagePullSecrets = attached
+	return n.Client.Update(ctx, &account)
+}
+
+func containsRef(refs []core.LocalObjectReference, ref core.LocalObjectReference) bool {
+	for _, r := range refs {
+		if r.Name == ref.Name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WorkspacesForPullSecret returns the workspaces the secret is a pull secret of, the secret being
+// one of the operator's pull secrets makes it a pull secret of every workspace. The workspaces of
+// the secret's namespace are looked up with the PullSecretsField index.
+func WorkspacesForPullSecret(ctx context.Context, c client.Client, secret client.Object, global []types.NamespacedName) ([]spot.Workspace, error) {
+	key := client.ObjectKeyFromObject(secret)
+	for _, source := range global {
+		if source == key {
+			var workspaces spot.WorkspaceList
+			if err := c.List(ctx, &workspaces); err != nil {
+				return nil, err
+			}
+
+			return workspaces.Items, nil
+		}
+	}
+
+	var workspaces spot.WorkspaceList
+	if err := c.List(ctx, &workspaces, client.InNamespace(key.Namespace), client.MatchingFields{PullSecretsField: key.Name}); err != nil {
+		return nil, err
+	}
+
+	return workspaces.Items, nil
+}
@@ -0,0 +1,179 @@
+package workspaces
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Pull secrets", func() {
+	var c client.Client
+	var namespacer *Namespacer
+	var workspace *spot.Workspace
+
+	newSecret := func(namespace, name, config string) *core.Secret {
+		secret := pullSecret(name, config)
+		secret.Namespace = namespace
+		return &secret
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(spot.AddToScheme(scheme)).To(Succeed())
+
+		workspace = &spot.Workspace{
+			ObjectMeta: meta.ObjectMeta{Namespace: "team", Name: "preview"},
+			Spec:       spot.WorkspaceSpec{ImagePullSecrets: []core.LocalObjectReference{{Name: "registry"}}},
+			Status:     spot.WorkspaceStatus{Namespace: "workspace-preview-1234"},
+		}
+
+		c = fake.NewClientBuilder().WithScheme(scheme).WithIndex(&spot.Workspace{}, PullSecretsField, PullSecretNames).WithObjects(
+			workspace.DeepCopy(),
+			&spot.Workspace{ObjectMeta: meta.ObjectMeta{Namespace: "team", Name: "other"}},
+			&spot.Workspace{ObjectMeta: meta.ObjectMeta{Namespace: "elsewhere", Name: "preview"}},
+			newSecret("team", "registry", `{"auths":{"ghcr.io":{"username":"octocat","password":"v1"}}}`),
+			newSecret("spot-system", "mirror", `{"auths":{"mirror.local":{"username":"spot","password":"v1"}}}`),
+			newSecret("spot-system", "registry", `{"auths":{"ghcr.io":{"username":"shadowed","password":"v1"}}}`),
+		).Build()
+
+		namespacer = &Namespacer{
+			Client: c,
+			Cache:  c,
+			ImagePullSecrets: []types.NamespacedName{
+				{Namespace: "spot-system", Name: "mirror"},
+				{Namespace: "spot-system", Name: "registry"},
+			},
+		}
+	})
+
+	It("copies the secrets and attaches them to the default service account", func() {
+		Expect(namespacer.SyncPullSecrets(context.TODO(), workspace)).To(Succeed())
+
+		var copied core.Secret
+		Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: "workspace-preview-1234", Name: "registry"}, &copied)).To(Succeed())
+		Expect(copied.Type).To(Equal(core.SecretTypeDockerConfigJson))
+		Expect(string(copied.Data[core.DockerConfigJsonKey])).To(ContainSubstring("octocat"))
+		Expect(copied.Annotations).To(HaveKeyWithValue(spot.WorkspacePullSecretSourceAnnotation, "team/registry"))
+
+		Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: "workspace-preview-1234", Name: "mirror"}, &copied)).To(Succeed())
+
+		var account core.ServiceAccount
+		Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: "workspace-preview-1234", Name: "default"}, &account)).To(Succeed())
+		Expect(account.ImagePullSecrets).To(Equal([]core.LocalObjectReference{{Name: "registry"}, {Name: "mirror"}}))
+	})
+
+	It("keeps the existing pull secrets of the service account", func() {
+		Expect(c.Create(context.TODO(), &core.ServiceAccount{
+			ObjectMeta:       meta.ObjectMeta{Namespace: "workspace-preview-1234", Name: "default"},
+			ImagePullSecrets: []core.LocalObjectReference{{Name: "existing"}, {Name: "mirror"}},
+		})).To(Succeed())
+
+		Expect(namespacer.SyncPullSecrets(context.TODO(), workspace)).To(Succeed())
+
+		var account core.ServiceAccount
+		Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: "workspace-preview-1234", Name: "default"}, &account)).To(Succeed())
+		Expect(account.ImagePullSecrets).To(Equal([]core.LocalObjectReference{{Name: "existing"}, {Name: "mirror"}, {Name: "registry"}}))
+	})
+
+	It("updates the copies when the source is rotated", func() {
+		Expect(namespacer.SyncPullSecrets(context.TODO(), workspace)).To(Succeed())
+
+		var source core.Secret
+		Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: "team", Name: "registry"}, &source)).To(Succeed())
+		source.Data[core.DockerConfigJsonKey] = []byte(`{"auths":{"ghcr.io":{"username":"octocat","password":"v2"}}}`)
+		Expect(c.Update(context.TODO(), &source)).To(Succeed())
+
+		Expect(namespacer.SyncPullSecrets(context.TODO(), workspace)).To(Succeed())
+
+		var copied core.Secret
+		Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: "workspace-preview-1234", Name: "registry"}, &copied)).To(Succeed())
+		Expect(string(copied.Data[core.DockerConfigJsonKey])).To(ContainSubstring("v2"))
+	})
+
+	It("doesn't overwrite the secrets that aren't copies", func() {
+		existing := newSecret("workspace-preview-1234", "registry", `{"auths":{"ghcr.io":{"username":"someone","password":"else"}}}`)
+		Expect(c.Create(context.TODO(), existing)).To(Succeed())
+
+		Expect(namespacer.SyncPullSecrets(context.TODO(), workspace)).To(MatchError(ErrPullSecretConflict))
+
+		var secret core.Secret
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(existing), &secret)).To(Succeed())
+		Expect(string(secret.Data[core.DockerConfigJsonKey])).To(ContainSubstring("someone"))
+	})
+
+	It("deletes and detaches the copies of the secrets removed from the spec", func() {
+		Expect(c.Create(context.TODO(), &core.ServiceAccount{
+			ObjectMeta:       meta.ObjectMeta{Namespace: "workspace-preview-1234", Name: "default"},
+			ImagePullSecrets: []core.LocalObjectReference{{Name: "existing"}},
+		})).To(Succeed())
+		Expect(c.Create(context.TODO(), newSecret("workspace-preview-1234", "existing", ""))).To(Succeed())
+		Expect(namespacer.SyncPullSecrets(context.TODO(), workspace)).To(Succeed())
+
+		workspace.Spec.ImagePullSecrets = nil
+		namespacer.ImagePullSecrets = nil
+		Expect(namespacer.SyncPullSecrets(context.TODO(), workspace)).To(Succeed())
+
+		var secrets core.SecretList
+		Expect(c.List(context.TODO(), &secrets, client.InNamespace("workspace-preview-1234"))).To(Succeed())
+		Expect(secrets.Items).To(HaveLen(1))
+		Expect(secrets.Items[0].Name).To(Equal("existing"))
+
+		var account core.ServiceAccount
+		Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: "workspace-preview-1234", Name: "default"}, &account)).To(Succeed())
+		Expect(account.ImagePullSecrets).To(Equal([]core.LocalObjectReference{{Name: "existing"}}))
+	})
+
+	It("switches the copy to the workspace's secret when it shadows the operator's", func() {
+		workspace.Spec.ImagePullSecrets = nil
+		Expect(namespacer.SyncPullSecrets(context.TODO(), workspace)).To(Succeed())
+
+		workspace.Spec.ImagePullSecrets = []core.LocalObjectReference{{Name: "registry"}}
+		Expect(namespacer.SyncPullSecrets(context.TODO(), workspace)).To(Succeed())
+
+		var copied core.Secret
+		Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: "workspace-preview-1234", Name: "registry"}, &copied)).To(Succeed())
+		Expect(copied.Annotations).To(HaveKeyWithValue(spot.WorkspacePullSecretSourceAnnotation, "team/registry"))
+		Expect(string(copied.Data[core.DockerConfigJsonKey])).To(ContainSubstring("octocat"))
+	})
+
+	It("rejects secrets that aren't docker configs", func() {
+		Expect(c.Create(context.TODO(), &core.Secret{ObjectMeta: meta.ObjectMeta{Namespace: "team", Name: "opaque"}})).To(Succeed())
+		workspace.Spec.ImagePullSecrets = []core.LocalObjectReference{{Name: "opaque"}}
+
+		Expect(namespacer.SyncPullSecrets(context.TODO(), workspace)).To(MatchError(ErrPullSecretInvalid))
+	})
+
+	It("finds the workspaces using a secret", func() {
+		workspaces, err := WorkspacesForPullSecret(context.TODO(), c, newSecret("team", "registry", ""), namespacer.ImagePullSecrets)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workspaces).To(HaveLen(1))
+		Expect(workspaces[0].Name).To(Equal("preview"))
+
+		workspaces, err = WorkspacesForPullSecret(context.TODO(), c, newSecret("spot-system", "mirror", ""), namespacer.ImagePullSecrets)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workspaces).To(HaveLen(3))
+
+		workspaces, err = WorkspacesForPullSecret(context.TODO(), c, newSecret("team", "unused", ""), namespacer.ImagePullSecrets)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(workspaces).To(BeEmpty())
+	})
+
+	It("doesn't consider the copies as sources", func() {
+		Expect(IsPullSecretSource(newSecret("team", "registry", ""))).To(BeTrue())
+
+		Expect(namespacer.SyncPullSecrets(context.TODO(), workspace)).To(Succeed())
+		var copied core.Secret
+		Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: "workspace-preview-1234", Name: "registry"}, &copied)).To(Succeed())
+		Expect(IsPullSecretSource(&copied)).To(BeFalse())
+	})
+})
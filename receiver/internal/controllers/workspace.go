@@ -96,35 +96,48 @@ func (w *Workspace) workspace(project *spot.Project, request *WorkspaceRequest)
 }
 
 func (w *Workspace) createWorkspace(project *spot.Project, request *WorkspaceRequest) error {
+	workspace := newWorkspace(project, request)
+
+	err := w.Client.
+		Post().
+		Resource("workspaces").
+		Namespace("spot-system").
+		Body(workspace).
+		Do(context.TODO()).
+		Into(workspace)
+
+	return err
+}
+
+// Workspace of the branch, created from the project's template. The images built from
+// a repository are built from the branch and tagged with its ref.
+func newWorkspace(project *spot.Project, request *WorkspaceRequest) *spot.Workspace {
+	// The components are edited for the branch, the project's template stays untouched.
+	template := project.Spec.Template.DeepCopy()
 	workspace := &spot.Workspace{
 		ObjectMeta: v1.ObjectMeta{
 			Name:      request.Branch.Name,
 			Namespace: project.Namespace,
 		},
 		Spec: spot.WorkspaceSpec{
-			Components:   project.Spec.Template.Components,
-			Environments: project.Spec.Template.Environments,
-			Host:         project.Spec.Template.Host,
-			Tag:          request.Branch.Ref, // TODO: Need to figure this out, probably wants it in the BranchSpec.
+			Components:       template.Components,
+			Environments:     template.Environments,
+			Host:             template.Host,
+			ImagePullSecrets: template.ImagePullSecrets,
+			Tag:              request.Branch.Ref, // TODO: Need to figure this out, probably wants it in the BranchSpec.
 		},
 	}
 
 	for i := 0; i < len(workspace.Spec.Components); i++ {
 		component := workspace.Spec.Components[i]
-		if component.Image.Repository != nil {
-			component.Image.Repository.Ref = request.Branch.Ref
-			component.Image.Tag = &request.Branch.Ref
+		if repository := component.Image.Repository; repository != nil {
+			if repository.Git != nil {
+				repository.Git.Reference = spot.GitReference{Name: request.Branch.Ref}
+			}
+			component.Image.Registry.Tag = &request.Branch.Ref
 		}
 		workspace.Spec.Components[i] = component
 	}
 
-	err := w.Client.
-		Post().
-		Resource("workspaces").
-		Namespace("spot-system").
-		Body(workspace).
-		Do(context.TODO()).
-		Into(workspace)
-
-	return err
+	return workspace
 }
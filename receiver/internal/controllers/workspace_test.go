@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	core "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	spot "github.com/releasehub-com/spot/operator/api/v1alpha1"
+)
+
+var _ = Describe("Workspace", func() {
+	It("creates the workspace from the project's template", func() {
+		project := &spot.Project{
+			ObjectMeta: v1.ObjectMeta{Name: "app", Namespace: "spot-system"},
+			Spec: spot.ProjectSpec{Template: spot.ProjectTemplateSpec{
+				Host:             "example.com",
+				ImagePullSecrets: []core.LocalObjectReference{{Name: "registry"}},
+				Components: []spot.ComponentSpec{
+					{Name: "api", Image: spot.ImageSpec{
+						Repository: &spot.RepositorySpec{Git: &spot.GitSource{URL: "https://github.com/org/app"}},
+						Registry:   spot.RegistrySpec{URL: "ghcr.io/org/app"},
+					}},
+					{Name: "redis", Image: spot.ImageSpec{Registry: spot.RegistrySpec{URL: "redis"}}},
+				},
+			}},
+		}
+
+		workspace := newWorkspace(project, &WorkspaceRequest{Branch: BranchRequest{Name: "feature", Ref: "feature"}})
+		Expect(workspace.Name).To(Equal("feature"))
+		Expect(workspace.Namespace).To(Equal("spot-system"))
+		Expect(workspace.Spec.Host).To(Equal("example.com"))
+		Expect(workspace.Spec.ImagePullSecrets).To(Equal([]core.LocalObjectReference{{Name: "registry"}}))
+
+		api := workspace.Spec.Components[0].Image
+		Expect(api.Repository.Git.Reference).To(Equal(spot.GitReference{Name: "feature"}))
+		Expect(api.Registry.Tag).To(HaveValue(Equal("feature")))
+
+		redis := workspace.Spec.Components[1].Image
+		Expect(redis.Registry.Tag).To(BeNil())
+	})
+
+	It("leaves the project's template untouched", func() {
+		project := &spot.Project{
+			ObjectMeta: v1.ObjectMeta{Name: "app", Namespace: "spot-system"},
+			Spec: spot.ProjectSpec{Template: spot.ProjectTemplateSpec{
+				Components: []spot.ComponentSpec{
+					{Name: "api", Image: spot.ImageSpec{
+						Repository: &spot.RepositorySpec{Git: &spot.GitSource{URL: "https://github.com/org/app"}},
+						Registry:   spot.RegistrySpec{URL: "ghcr.io/org/app"},
+					}},
+				},
+			}},
+		}
+		template := project.Spec.Template.DeepCopy()
+
+		newWorkspace(project, &WorkspaceRequest{Branch: BranchRequest{Name: "feature", Ref: "feature"}})
+		newWorkspace(project, &WorkspaceRequest{Branch: BranchRequest{Name: "fix", Ref: "fix"}})
+		Expect(project.Spec.Template).To(Equal(*template))
+	})
+})